@@ -75,9 +75,16 @@ func (a *address) CreateAddress(ctx context.Context, userId string, address *mod
 	id := a.helper.NewId()
 	address.Id = &id
 	address.UserId = &userId
-	_ = a.removeDefaults(ctx, userId, address.IsDefault)
-	query := a.builder.CreateAddress(address.GetFieldMap())
-	_, err := a.postgres.Exec(ctx, query, userId, id)
+	err := a.postgres.WithTx(ctx, func(tx repository.PostgresQueryer) error {
+		err := a.removeDefaults(ctx, tx, userId, address.IsDefault)
+		if err != nil {
+			return err
+		}
+
+		query, args := a.builder.CreateAddress(userId, id, address.GetFieldMap())
+		_, err = tx.Exec(ctx, query, args...)
+		return err
+	})
 	if err != nil {
 		return nil, fmt.Errorf("CreateAddress: unable to execute query: %s", err)
 	}
@@ -85,11 +92,11 @@ func (a *address) CreateAddress(ctx context.Context, userId string, address *mod
 	return address, nil
 }
 
-func (a *address) removeDefaults(ctx context.Context, userId string, isDefault *bool) error {
+func (a *address) removeDefaults(ctx context.Context, tx repository.PostgresQueryer, userId string, isDefault *bool) error {
 	if isDefault != nil {
 		if *isDefault {
 			query := a.builder.RemoveDefaults()
-			_, err := a.postgres.Exec(ctx, query, userId)
+			_, err := tx.Exec(ctx, query, userId)
 
 			return err
 		}
@@ -99,17 +106,28 @@ func (a *address) removeDefaults(ctx context.Context, userId string, isDefault *
 }
 
 func (a *address) UpdateAddress(ctx context.Context, userId, id string, address *models.Address) (*models.Address, error) {
-	_ = a.removeDefaults(ctx, userId, address.IsDefault)
-	query := a.builder.UpdateAddress(address.GetFieldMap())
-	res, err := a.postgres.Exec(ctx, query, userId, id)
+	err := a.postgres.WithTx(ctx, func(tx repository.PostgresQueryer) error {
+		err := a.removeDefaults(ctx, tx, userId, address.IsDefault)
+		if err != nil {
+			return err
+		}
+
+		query, args := a.builder.UpdateAddress(userId, id, address.GetFieldMap())
+		res, err := tx.Exec(ctx, query, args...)
+		if err != nil {
+			return err
+		}
+
+		if res == 0 {
+			return fmt.Errorf("no such address to update")
+		}
+
+		return nil
+	})
 	if err != nil {
 		return nil, fmt.Errorf("UpdateAddress: unable to execute query: %s", err)
 	}
 
-	if res == 0 {
-		return nil, fmt.Errorf("UpdateAddress: no such address to update")
-	}
-
 	address.Id = &id
 	return address, nil
 }
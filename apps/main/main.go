@@ -2,6 +2,7 @@ package main
 
 import (
 	"fmt"
+	"os"
 
 	"github.com/sirupsen/logrus"
 	"github.com/urfave/negroni"
@@ -30,6 +31,15 @@ func main() {
 	}
 
 	f := factory.NewFactory(l, conf)
+	if len(os.Args) > 1 && os.Args[1] == "migrate" {
+		err = migrate(f, l, os.Args[2:])
+		if err != nil {
+			l.Fatalf("Unable to migrate: %s", err)
+		}
+
+		return
+	}
+
 	l.Infof("Running auth service server version: %s", Version)
 
 	n := negroni.New()
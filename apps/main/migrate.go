@@ -0,0 +1,72 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+
+	"github.com/sirupsen/logrus"
+
+	"authservice/factory"
+)
+
+// migrate runs the "migrate up|down [steps]|status" subcommand
+func migrate(f factory.Factory, l *logrus.Logger, args []string) error {
+	if len(args) == 0 {
+		return fmt.Errorf("usage: migrate up|down [steps]|status")
+	}
+
+	ctx := context.Background()
+	migrator := f.Migrator()
+	switch args[0] {
+	case "up":
+		applied, err := migrator.Up(ctx)
+		for _, m := range applied {
+			l.Infof("Applied migration %04d_%s", m.Version, m.Name)
+		}
+
+		if err != nil {
+			return err
+		}
+
+		if len(applied) == 0 {
+			l.Infof("Schema is up to date")
+		}
+	case "down":
+		steps := 1
+		if len(args) > 1 {
+			var err error
+			steps, err = strconv.Atoi(args[1])
+			if err != nil || steps <= 0 {
+				return fmt.Errorf("invalid number of steps: %s", args[1])
+			}
+		}
+
+		reverted, err := migrator.Down(ctx, steps)
+		for _, m := range reverted {
+			l.Infof("Reverted migration %04d_%s", m.Version, m.Name)
+		}
+
+		if err != nil {
+			return err
+		}
+	case "status":
+		statuses, err := migrator.Status(ctx)
+		if err != nil {
+			return err
+		}
+
+		for _, s := range statuses {
+			if s.AppliedAt == nil {
+				l.Infof("%04d_%s: pending", s.Version, s.Name)
+				continue
+			}
+
+			l.Infof("%04d_%s: applied at %s", s.Version, s.Name, s.AppliedAt.Format("2006-01-02 15:04:05"))
+		}
+	default:
+		return fmt.Errorf("unknown migrate command '%s', expected up, down or status", args[0])
+	}
+
+	return nil
+}
@@ -2,53 +2,129 @@ package auth
 
 import (
 	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
 	"fmt"
+	"io"
+	"strings"
 	"time"
 
+	"authservice/client"
+	"authservice/constant"
 	"authservice/helper"
 	"authservice/models"
 	"authservice/repository"
 )
 
 type Authorizer interface {
-	ValidateRefreshToken(ctx context.Context, token string) (map[string]interface{}, error)
+	ValidateRefreshToken(ctx context.Context, token string) (*models.RefreshMeta, error)
 	ValidateBearerToken(ctx context.Context, token string) (map[string]interface{}, error)
-	GetJWT(ctx context.Context, claims map[string]interface{}, oldBearerToken, refreshToken string) (string, error)
+	RefreshTokens(ctx context.Context, refreshMeta *models.RefreshMeta, oldBearerToken, refreshToken string) (*models.AuthUser, error)
 	InvalidateTokens(ctx context.Context, userId, bearerToken string, clearAllTokens bool) error
+	Introspect(ctx context.Context, token, tokenTypeHint string) *models.Introspection
+	RevokeToken(ctx context.Context, token, tokenTypeHint, clientId string) error
+	GetSessions(ctx context.Context, userId, currentBearerToken string) ([]*models.Session, error)
+	RevokeSession(ctx context.Context, userId, sessionId string) error
+	SetSessionPolicy(ctx context.Context, userId string, policy *models.SessionPolicy) error
+	IssueCode(ctx context.Context, grant *models.AuthorizationGrant) (string, error)
+	ExchangeCode(ctx context.Context, code, clientId, redirectURI, verifier string,
+		startSession func(ctx context.Context, userId, clientId string, device models.DeviceInfo) (*models.AuthUser, error)) (*models.TokenResponse, error)
 }
 
+const (
+	accessTokenHint  = "access_token"
+	refreshTokenHint = "refresh_token"
+	codeLifetime     = time.Minute
+	codeSize         = 32
+)
+
 type authorize struct {
-	helper helper.Helper
-	redis  repository.RedisQueryer
+	helper  helper.Helper
+	redis   repository.RedisQueryer
+	clients client.Registry
 }
 
-func NewAuthorizer(h helper.Helper, r repository.RedisQueryer) Authorizer {
+func NewAuthorizer(h helper.Helper, r repository.RedisQueryer, c client.Registry) Authorizer {
 	return &authorize{
-		helper: h,
-		redis: r,
+		helper:  h,
+		redis:   r,
+		clients: c,
+	}
+}
+
+func (a *authorize) ValidateRefreshToken(ctx context.Context, token string) (*models.RefreshMeta, error) {
+	refreshMeta, userMeta, err := a.readRefreshToken(ctx, token)
+	if err != nil {
+		return nil, fmt.Errorf("validateRefreshToken: %w", err)
+	}
+
+	if !userMeta.ContainsRefreshToken(token) {
+		// a genuine token of a live family that is no longer current must have been rotated already,
+		// so it is being replayed and the whole family is considered compromised
+		if userMeta.ContainsSession(refreshMeta.FamilyId) {
+			a.revokeFamily(ctx, fmt.Sprintf("%s", refreshMeta.UserClaims["id"]), refreshMeta.FamilyId)
+			return nil, fmt.Errorf("validateRefreshToken: refresh token reuse detected")
+		}
+
+		return nil, fmt.Errorf("validateRefreshToken: not a valid token")
 	}
+
+	return refreshMeta, nil
 }
 
-func (a *authorize) ValidateRefreshToken(ctx context.Context, token string) (map[string]interface{}, error) {
+// lookupRefreshToken checks the token like ValidateRefreshToken without acting on a replayed one
+func (a *authorize) lookupRefreshToken(ctx context.Context, token string) (*models.RefreshMeta, error) {
+	refreshMeta, userMeta, err := a.readRefreshToken(ctx, token)
+	if err != nil {
+		return nil, fmt.Errorf("lookupRefreshToken: %w", err)
+	}
+
+	if !userMeta.ContainsRefreshToken(token) {
+		return nil, fmt.Errorf("lookupRefreshToken: not a valid token")
+	}
+
+	return refreshMeta, nil
+}
+
+// readRefreshToken decodes an unexpired token and reads the sessions of its user
+func (a *authorize) readRefreshToken(ctx context.Context, token string) (*models.RefreshMeta, *models.UserMeta, error) {
 	refreshMeta, err := a.helper.DecodeToken(token)
 	if err != nil {
-		return nil, fmt.Errorf("validateRefreshToken: unable to validate token: %s", err)
+		return nil, nil, fmt.Errorf("readRefreshToken: unable to validate token: %s", err)
 	}
 
 	if refreshMeta.Expiry <= time.Now().Unix() {
-		return nil, fmt.Errorf("validateRefreshToken: invalid token: token expired")
+		return nil, nil, fmt.Errorf("readRefreshToken: invalid token: token expired")
 	}
 
 	userMeta, err := a.GetActiveTokens(ctx, fmt.Sprintf("%s", refreshMeta.UserClaims["id"]))
 	if err != nil {
-		return nil, fmt.Errorf("validateRefreshToken: %s", err)
+		return nil, nil, fmt.Errorf("readRefreshToken: %s", err)
 	}
 
-	if !userMeta.ContainsRefreshToken(token) {
-		return nil, fmt.Errorf("validateRefreshToken: not a valid token")
+	if userMeta.Deactivated {
+		return nil, nil, fmt.Errorf("readRefreshToken: %w", models.ErrAccountDeactivated)
 	}
 
-	return refreshMeta.UserClaims, err
+	return refreshMeta, userMeta, nil
+}
+
+func (a *authorize) revokeFamily(ctx context.Context, userId, familyId string) {
+	_ = a.updateUserMeta(ctx, userId, func(userMeta *models.UserMeta) (bool, error) {
+		userMeta.ClearSession(familyId)
+		return true, nil
+	})
+
+	_ = a.helper.PublishSecurityEvent(ctx, &models.SecurityEvent{
+		Type:     constant.EventRefreshTokenReuse,
+		UserId:   userId,
+		FamilyId: familyId,
+		Time:     time.Now().UnixMilli(),
+	})
 }
 
 func (a *authorize) ValidateBearerToken(ctx context.Context, token string) (map[string]interface{}, error) {
@@ -62,6 +138,10 @@ func (a *authorize) ValidateBearerToken(ctx context.Context, token string) (map[
 		return nil, fmt.Errorf("validateBearerToken: %s", err)
 	}
 
+	if userMeta.Deactivated {
+		return nil, fmt.Errorf("validateBearerToken: %w", models.ErrAccountDeactivated)
+	}
+
 	if !userMeta.ContainsBearerToken(token) {
 		return nil, fmt.Errorf("validateBearerToken: invalid token, token was invalidated")
 	}
@@ -72,64 +152,344 @@ func (a *authorize) ValidateBearerToken(ctx context.Context, token string) (map[
 func (a *authorize) GetActiveTokens(ctx context.Context, userId string) (*models.UserMeta, error) {
 	userMetaBytes, err := a.redis.GetBytes(ctx, userId)
 	if err != nil {
-		return nil, fmt.Errorf("getActiveTokens: unable to read token metadata")
+		return nil, fmt.Errorf("getActiveTokens: unable to read token metadata: %s", err)
 	}
 
 	var userMeta models.UserMeta
-	a.helper.UnMarshal(userMetaBytes, &userMeta)
+	err = a.helper.UnMarshal(userMetaBytes, &userMeta)
+	if err != nil {
+		return nil, fmt.Errorf("getActiveTokens: %s", err)
+	}
 
 	return &userMeta, nil
 }
 
-func (a *authorize) UpdateActiveTokensWithNewBearerToken(ctx context.Context, userId, oldBearerToken, newBearerToken, refreshToken string) error {
-	userMeta, err := a.GetActiveTokens(ctx, userId)
+// updateUserMeta applies update to the token metadata of the user in a single redis transaction
+func (a *authorize) updateUserMeta(ctx context.Context, userId string, update func(userMeta *models.UserMeta) (bool, error)) error {
+	return a.redis.Update(ctx, userId, 0, func(value []byte) ([]byte, error) {
+		userMeta := models.UserMeta{UserId: userId}
+		if value != nil {
+			err := a.helper.UnMarshal(value, &userMeta)
+			if err != nil {
+				return nil, fmt.Errorf("unable to read token metadata: %s", err)
+			}
+		}
+
+		changed, err := update(&userMeta)
+		if err != nil {
+			return nil, err
+		}
+
+		if !changed || (value == nil && userMeta.Policy == nil && len(userMeta.ActiveTokens) == 0) {
+			return nil, nil
+		}
+
+		return userMeta.GetBytes(), nil
+	})
+}
+
+func (a *authorize) RotateActiveTokens(ctx context.Context, userId, oldBearerToken, refreshToken, newBearerToken, newRefreshToken string) error {
+	return a.updateUserMeta(ctx, userId, func(userMeta *models.UserMeta) (bool, error) {
+		updated := userMeta.RotateTokens(oldBearerToken, refreshToken, newBearerToken, newRefreshToken)
+		if !updated {
+			return false, fmt.Errorf("no access/refresh token pair found")
+		}
+
+		return true, nil
+	})
+}
+
+// RefreshTokens rotates the token pair of the family
+func (a *authorize) RefreshTokens(ctx context.Context, refreshMeta *models.RefreshMeta, oldBearerToken, refreshToken string) (*models.AuthUser, error) {
+	claims := refreshMeta.UserClaims
+	clientId, _ := claims["client_id"].(string)
+	lifetime := a.clients.Lifetime(clientId)
+	sessionStart := refreshMeta.GetSessionStart()
+
+	jwt, err := a.helper.GetJWT(claims, lifetime.AccessTokenExpiry(sessionStart))
 	if err != nil {
-		return err
+		return nil, fmt.Errorf("refreshTokens: unable to create JWT: %s", err)
 	}
 
-	updated := userMeta.ReplaceBearerToken(oldBearerToken, newBearerToken, refreshToken)
-	if !updated {
-		return fmt.Errorf("no access/refresh token pair found")
+	newRefreshToken, err := a.helper.EncodeClaims(claims, refreshMeta.FamilyId, sessionStart, lifetime.RefreshTokenExpiry(sessionStart))
+	if err != nil {
+		return nil, fmt.Errorf("refreshTokens: unable to create refresh token: %s", err)
+	}
+
+	err = a.RotateActiveTokens(ctx, claims["id"].(string), oldBearerToken, refreshToken, jwt, newRefreshToken)
+	if err != nil {
+		return nil, fmt.Errorf("refreshTokens: %s", err)
 	}
 
-	err = a.redis.Set(ctx, userId, userMeta.GetBytes(), 0)
+	return &models.AuthUser{BearerToken: jwt, RefreshToken: newRefreshToken}, nil
+}
+
+func (a *authorize) InvalidateTokens(ctx context.Context, userId, bearerToken string, clearAllTokens bool) error {
+	err := a.updateUserMeta(ctx, userId, func(userMeta *models.UserMeta) (bool, error) {
+		if clearAllTokens {
+			userMeta.ClearAllTokens()
+		} else {
+			userMeta.ClearToken(bearerToken)
+		}
+
+		return true, nil
+	})
 	if err != nil {
-		return err
+		return fmt.Errorf("invalidateTokens: %s", err)
 	}
 
 	return nil
 }
 
-func (a *authorize) GetJWT(ctx context.Context, claims map[string]interface{}, oldBearerToken, refreshToken string) (string, error) {
-	jwt, err := a.helper.GetJWT(claims)
+func (a *authorize) GetSessions(ctx context.Context, userId, currentBearerToken string) ([]*models.Session, error) {
+	userMeta, err := a.GetActiveTokens(ctx, userId)
 	if err != nil {
-		return "", fmt.Errorf("getJWT: unable to create JWT: %s", err)
+		return nil, fmt.Errorf("getSessions: %s", err)
 	}
 
-	err = a.UpdateActiveTokensWithNewBearerToken(ctx, claims["id"].(string), oldBearerToken, jwt, refreshToken)
+	return userMeta.GetSessions(currentBearerToken), nil
+}
+
+func (a *authorize) RevokeSession(ctx context.Context, userId, sessionId string) error {
+	err := a.updateUserMeta(ctx, userId, func(userMeta *models.UserMeta) (bool, error) {
+		if !userMeta.ContainsSession(sessionId) {
+			return false, fmt.Errorf("no such session")
+		}
+
+		userMeta.ClearSession(sessionId)
+		return true, nil
+	})
 	if err != nil {
-		return "", fmt.Errorf("getJWT: %s", err)
+		return fmt.Errorf("revokeSession: %s", err)
 	}
 
-	return jwt, nil
+	return nil
 }
 
-func (a *authorize) InvalidateTokens(ctx context.Context, userId, bearerToken string, clearAllTokens bool) error {
-	userMeta, err := a.GetActiveTokens(ctx, userId)
+// SetSessionPolicy overrides the configured session policy for a single user, a nil policy removes the override
+func (a *authorize) SetSessionPolicy(ctx context.Context, userId string, policy *models.SessionPolicy) error {
+	err := a.updateUserMeta(ctx, userId, func(userMeta *models.UserMeta) (bool, error) {
+		userMeta.Policy = policy
+		return true, nil
+	})
 	if err != nil {
-		return fmt.Errorf("invalidateTokens: %s", err)
+		return fmt.Errorf("setSessionPolicy: %s", err)
 	}
 
-	if clearAllTokens {
-		userMeta.ClearAllTokens()
-	} else {
-		userMeta.ClearToken(bearerToken)
+	return nil
+}
+
+// Introspect describes a bearer or refresh token as per RFC 7662, without side effects
+func (a *authorize) Introspect(ctx context.Context, token, tokenTypeHint string) *models.Introspection {
+	tokenTypes := []string{accessTokenHint, refreshTokenHint}
+	if tokenTypeHint == refreshTokenHint {
+		tokenTypes = []string{refreshTokenHint, accessTokenHint}
 	}
 
-	err = a.redis.Set(ctx, userId, userMeta.GetBytes(), 0)
-	if err != nil {
-		return fmt.Errorf("invalidateTokens: unable to set data to redis: %s", err)
+	for _, tokenType := range tokenTypes {
+		switch tokenType {
+		case accessTokenHint:
+			bearerToken := token
+			if !strings.HasPrefix(bearerToken, "Bearer ") {
+				bearerToken = fmt.Sprintf("Bearer %s", token)
+			}
+
+			claims, err := a.ValidateBearerToken(ctx, bearerToken)
+			if err == nil {
+				res := introspectClaims(claims)
+				res.TokenType = "Bearer"
+				res.Exp = toUnix(claims["exp"])
+				res.Iat = toUnix(claims["iat"])
+				return res
+			}
+		case refreshTokenHint:
+			refreshMeta, err := a.lookupRefreshToken(ctx, token)
+			if err == nil {
+				res := introspectClaims(refreshMeta.UserClaims)
+				res.TokenType = refreshTokenHint
+				res.SessionId = refreshMeta.FamilyId
+				res.Exp = refreshMeta.Expiry
+				res.Iat = refreshMeta.IssuedAt
+				return res
+			}
+		}
+	}
+
+	return &models.Introspection{Active: false}
+}
+
+func introspectClaims(claims map[string]interface{}) *models.Introspection {
+	res := &models.Introspection{
+		Active: true,
+		Sub:    fmt.Sprintf("%s", claims["id"]),
+	}
+	res.Username, _ = claims["name"].(string)
+	res.Scope, _ = claims["scope"].(string)
+	res.ClientId, _ = claims["client_id"].(string)
+	res.SessionId, _ = claims["sid"].(string)
+
+	return res
+}
+
+func toUnix(value interface{}) int64 {
+	switch v := value.(type) {
+	case float64:
+		return int64(v)
+	case int64:
+		return v
+	}
+
+	return 0
+}
+
+// RevokeToken removes the session holding the bearer or refresh token as per RFC 7009
+func (a *authorize) RevokeToken(ctx context.Context, token, tokenTypeHint, clientId string) error {
+	tokenTypes := []string{accessTokenHint, refreshTokenHint}
+	if tokenTypeHint == refreshTokenHint {
+		tokenTypes = []string{refreshTokenHint, accessTokenHint}
+	}
+
+	for _, tokenType := range tokenTypes {
+		var claims map[string]interface{}
+		var err error
+		switch tokenType {
+		case accessTokenHint:
+			if !strings.HasPrefix(token, "Bearer ") {
+				token = fmt.Sprintf("Bearer %s", token)
+			}
+
+			claims, err = a.helper.DecodeExpiredJWT(token)
+		case refreshTokenHint:
+			var refreshMeta *models.RefreshMeta
+			token = strings.TrimPrefix(token, "Bearer ")
+			refreshMeta, err = a.helper.DecodeToken(token)
+			if err == nil {
+				claims = refreshMeta.UserClaims
+			}
+		}
+
+		if err != nil || claims == nil {
+			continue
+		}
+
+		if tokenClientId, _ := claims["client_id"].(string); !a.mayRevoke(tokenClientId, clientId) {
+			return nil
+		}
+
+		userId := fmt.Sprintf("%s", claims["id"])
+		revokedToken := token
+		err = a.updateUserMeta(ctx, userId, func(userMeta *models.UserMeta) (bool, error) {
+			if tokenType == accessTokenHint {
+				if !userMeta.ContainsBearerToken(revokedToken) {
+					return false, nil
+				}
+
+				userMeta.ClearToken(revokedToken)
+				return true, nil
+			}
+
+			if !userMeta.ContainsRefreshToken(revokedToken) {
+				return false, nil
+			}
+
+			userMeta.ClearRefreshToken(revokedToken)
+			return true, nil
+		})
+		if err != nil {
+			return fmt.Errorf("revokeToken: %s", err)
+		}
+
+		return nil
 	}
 
 	return nil
-}
\ No newline at end of file
+}
+
+// mayRevoke reports whether clientId may revoke a token of tokenClientId
+func (a *authorize) mayRevoke(tokenClientId, clientId string) bool {
+	if tokenClientId == "" {
+		return true
+	}
+
+	if c, found := a.clients.Get(tokenClientId); found && c.IsConfidential() {
+		return clientId == tokenClientId
+	}
+
+	return clientId == "" || clientId == tokenClientId
+}
+
+// IssueCode keeps the grant for a short while under a new one-time code, only a hash of the code is stored
+func (a *authorize) IssueCode(ctx context.Context, grant *models.AuthorizationGrant) (string, error) {
+	b := make([]byte, codeSize)
+	if _, err := io.ReadFull(rand.Reader, b); err != nil {
+		return "", fmt.Errorf("issueCode: unable to generate code: %s", err)
+	}
+
+	value, err := json.Marshal(grant)
+	if err != nil {
+		return "", fmt.Errorf("issueCode: unable to encode grant: %s", err)
+	}
+
+	code := base64.RawURLEncoding.EncodeToString(b)
+	err = a.redis.Set(ctx, codeKey(code), string(value), codeLifetime)
+	if err != nil {
+		return "", fmt.Errorf("issueCode: unable to store grant: %s", err)
+	}
+
+	return code, nil
+}
+
+// ExchangeCode spends the code and starts the session of the sign in it was issued for
+func (a *authorize) ExchangeCode(ctx context.Context, code, clientId, redirectURI, verifier string,
+	startSession func(ctx context.Context, userId, clientId string, device models.DeviceInfo) (*models.AuthUser, error)) (*models.TokenResponse, error) {
+	value, err := a.redis.GetDelString(ctx, codeKey(code))
+	if a.redis.IsRedisNil(err) {
+		return nil, fmt.Errorf("exchangeCode: %w: unknown code", models.ErrInvalidGrant)
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("exchangeCode: unable to get grant: %s", err)
+	}
+
+	var grant models.AuthorizationGrant
+	err = json.Unmarshal([]byte(value), &grant)
+	if err != nil {
+		return nil, fmt.Errorf("exchangeCode: unable to decode grant: %s", err)
+	}
+
+	if grant.ClientId != clientId || grant.RedirectURI != redirectURI {
+		return nil, fmt.Errorf("exchangeCode: %w: client or redirect uri does not match", models.ErrInvalidGrant)
+	}
+
+	challenge := sha256.Sum256([]byte(verifier))
+	if subtle.ConstantTimeCompare([]byte(base64.RawURLEncoding.EncodeToString(challenge[:])), []byte(grant.CodeChallenge)) != 1 {
+		return nil, fmt.Errorf("exchangeCode: %w: code verifier does not match", models.ErrInvalidGrant)
+	}
+
+	authUser := grant.AuthUser
+	if grant.UserId != "" {
+		authUser, err = startSession(ctx, grant.UserId, grant.ClientId, grant.Device)
+		if err != nil {
+			return nil, fmt.Errorf("exchangeCode: %w", err)
+		}
+	}
+
+	res := &models.TokenResponse{
+		User:         authUser.User,
+		MFAChallenge: authUser.MFAChallenge,
+		IdentityLink: authUser.IdentityLink,
+	}
+	if authUser.BearerToken != "" {
+		res.AccessToken = authUser.BearerToken
+		res.TokenType = "Bearer"
+		res.RefreshToken = authUser.RefreshToken
+		res.ExpiresIn = int64(a.clients.Lifetime(clientId).AccessTokenTTL.Seconds())
+	}
+
+	return res, nil
+}
+
+func codeKey(code string) string {
+	hash := sha256.Sum256([]byte(code))
+	return fmt.Sprintf("oauth:code:%s", hex.EncodeToString(hash[:]))
+}
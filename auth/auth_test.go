@@ -0,0 +1,214 @@
+package auth
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"authservice/client"
+	"authservice/helper"
+	"authservice/models"
+	"authservice/repository"
+)
+
+// refreshHelper decodes every refresh token as the given one of user "user" and rejects bearer tokens
+type refreshHelper struct {
+	helper.Helper
+	refreshMeta *models.RefreshMeta
+	published   []string
+}
+
+func (h *refreshHelper) DecodeToken(data string) (*models.RefreshMeta, error) {
+	return h.refreshMeta, nil
+}
+
+func (h *refreshHelper) DecodeJWT(token string) (map[string]interface{}, error) {
+	return nil, fmt.Errorf("decodeJWT: invalid JWT")
+}
+
+func (h *refreshHelper) UnMarshal(data []byte, dest interface{}) error {
+	return json.Unmarshal(data, dest)
+}
+
+func (h *refreshHelper) PublishSecurityEvent(ctx context.Context, event *models.SecurityEvent) error {
+	h.published = append(h.published, event.Type)
+	return nil
+}
+
+// sessionsRedis holds the sessions of one user and records the updates
+type sessionsRedis struct {
+	repository.RedisQueryer
+	userMeta *models.UserMeta
+	updated  int
+}
+
+func (r *sessionsRedis) GetBytes(ctx context.Context, key string) ([]byte, error) {
+	return r.userMeta.GetBytes(), nil
+}
+
+func (r *sessionsRedis) Update(ctx context.Context, key string, timeOut time.Duration, update func(value []byte) ([]byte, error)) error {
+	r.updated++
+	return nil
+}
+
+func newRotatedAuthorizer() (Authorizer, *refreshHelper, *sessionsRedis) {
+	h := &refreshHelper{refreshMeta: &models.RefreshMeta{
+		UserClaims: map[string]interface{}{"id": "user"},
+		FamilyId:   "family",
+		Expiry:     time.Now().Add(time.Hour).Unix(),
+	}}
+	redis := &sessionsRedis{userMeta: &models.UserMeta{UserId: "user", ActiveTokens: []models.ActiveToken{
+		{SessionId: "family", RefreshToken: "current"},
+	}}}
+
+	return NewAuthorizer(h, redis, nil), h, redis
+}
+
+func TestIntrospectReportsRotatedRefreshTokenWithoutRevoking(t *testing.T) {
+	a, h, redis := newRotatedAuthorizer()
+	res := a.Introspect(context.Background(), "rotated", refreshTokenHint)
+	if res.Active {
+		t.Fatal("rotated refresh token reported active")
+	}
+
+	if redis.updated != 0 || len(h.published) != 0 {
+		t.Fatalf("introspection changed %d sessions and published %v", redis.updated, h.published)
+	}
+
+	res = a.Introspect(context.Background(), "current", refreshTokenHint)
+	if !res.Active || res.SessionId != "family" {
+		t.Fatalf("current refresh token introspected as %+v", res)
+	}
+}
+
+func TestValidateRefreshTokenRevokesFamilyOnReuse(t *testing.T) {
+	a, h, redis := newRotatedAuthorizer()
+	_, err := a.ValidateRefreshToken(context.Background(), "rotated")
+	if err == nil {
+		t.Fatal("rotated refresh token accepted")
+	}
+
+	if redis.updated != 1 || len(h.published) != 1 {
+		t.Fatalf("reuse changed %d sessions and published %v, want the family revoked", redis.updated, h.published)
+	}
+}
+
+type testClients struct {
+	client.Registry
+	clients map[string]*models.Client
+}
+
+func (c testClients) Get(id string) (*models.Client, bool) {
+	cl, ok := c.clients[id]
+	return cl, ok
+}
+
+func TestRevokeTokenOfConfidentialClientRequiresThatClient(t *testing.T) {
+	clients := testClients{clients: map[string]*models.Client{
+		"backend": {Id: "backend", Secret: "secret"},
+		"spa":     {Id: "spa"},
+	}}
+	tests := []struct {
+		name        string
+		tokenClient string
+		clientId    string
+		revoked     bool
+	}{
+		{"anonymous caller, confidential client", "backend", "", false},
+		{"other client, confidential client", "backend", "spa", false},
+		{"same confidential client", "backend", "backend", true},
+		{"anonymous caller, public client", "spa", "", true},
+		{"other client, public client", "spa", "backend", false},
+		{"anonymous caller, no client", "", "", true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			h := &refreshHelper{refreshMeta: &models.RefreshMeta{
+				UserClaims: map[string]interface{}{"id": "user", "client_id": test.tokenClient},
+				FamilyId:   "family",
+			}}
+			redis := &sessionsRedis{}
+			err := NewAuthorizer(h, redis, clients).RevokeToken(context.Background(), "current", refreshTokenHint, test.clientId)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if revoked := redis.updated != 0; revoked != test.revoked {
+				t.Fatalf("revoked %t, want %t", revoked, test.revoked)
+			}
+		})
+	}
+}
+
+func (c testClients) Lifetime(id string) models.TokenLifetime {
+	return models.TokenLifetime{AccessTokenTTL: time.Minute}
+}
+
+// codesRedis keeps the stored codes in memory
+type codesRedis struct {
+	repository.RedisQueryer
+	values map[string]string
+}
+
+func (r *codesRedis) Set(ctx context.Context, key string, value interface{}, timeOut time.Duration) error {
+	r.values[key] = value.(string)
+	return nil
+}
+
+func (r *codesRedis) GetDelString(ctx context.Context, key string) (string, error) {
+	value, ok := r.values[key]
+	if !ok {
+		return "", fmt.Errorf("getDelString: unable to get value from redis: redis: nil")
+	}
+
+	delete(r.values, key)
+	return value, nil
+}
+
+func (r *codesRedis) IsRedisNil(err error) bool {
+	return err != nil && strings.Contains(err.Error(), "redis: nil")
+}
+
+func TestExchangeCodeStartsTheSessionOnce(t *testing.T) {
+	a := NewAuthorizer(nil, &codesRedis{values: map[string]string{}}, testClients{})
+	verifier := "verifier"
+	challenge := sha256.Sum256([]byte(verifier))
+	device := models.DeviceInfo{IP: "192.0.2.1", UserAgent: "browser"}
+	code, err := a.IssueCode(context.Background(), &models.AuthorizationGrant{ClientId: "app",
+		RedirectURI: "https://app.example.com/callback", CodeChallenge: base64.RawURLEncoding.EncodeToString(challenge[:]),
+		UserId: "user", Device: device})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var sessions []string
+	startSession := func(ctx context.Context, userId, clientId string, d models.DeviceInfo) (*models.AuthUser, error) {
+		if d != device {
+			t.Fatalf("session started for device %+v, want the one that signed in", d)
+		}
+
+		sessions = append(sessions, userId+"@"+clientId)
+		return &models.AuthUser{BearerToken: "bearer", RefreshToken: "refresh"}, nil
+	}
+
+	res, err := a.ExchangeCode(context.Background(), code, "app", "https://app.example.com/callback", verifier, startSession)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if res.AccessToken != "bearer" || res.RefreshToken != "refresh" || len(sessions) != 1 || sessions[0] != "user@app" {
+		t.Fatalf("got %+v and sessions %v, want one session of user for app", res, sessions)
+	}
+
+	_, err = a.ExchangeCode(context.Background(), code, "app", "https://app.example.com/callback", verifier, startSession)
+	if !errors.Is(err, models.ErrInvalidGrant) || len(sessions) != 1 {
+		t.Fatalf("got %v and sessions %v, want the spent code refused", err, sessions)
+	}
+}
@@ -3,19 +3,40 @@ package builder
 import (
 	"fmt"
 	"strings"
+	"time"
 )
 
 type AddressBuilder interface {
 	GetAddresses() string
 	GetAddress() string
-	CreateAddress(addr map[string]interface{}) string
-	UpdateAddress(addr map[string]interface{}) string
+	CreateAddress(userId, id string, addr map[string]interface{}) (string, []interface{})
+	UpdateAddress(userId, id string, addr map[string]interface{}) (string, []interface{})
 	RemoveDefaults() string
 	DeleteAddress() string
 }
 
 type address struct {}
 
+// createAddressFields are the fields of a new address in the order of the columns they are inserted into
+var createAddressFields = []string{"name", "phone", "firstLine", "secondLine", "fullAddress", "city", "state", "country",
+	"pincode", "latitude", "longitude", "isDefault"}
+
+// updatableAddressColumns whitelists the fields of an address that can be changed
+var updatableAddressColumns = map[string]string{
+	"name":        "name",
+	"phone":       "phone",
+	"firstLine":   "first_line",
+	"secondLine":  "second_line",
+	"fullAddress": "address_string",
+	"city":        "city",
+	"state":       "state",
+	"country":     "country",
+	"pincode":     "pincode",
+	"latitude":    "lat",
+	"longitude":   "long",
+	"isDefault":   "is_default",
+}
+
 func NewAddressBuilder() AddressBuilder {
 	return &address{}
 }
@@ -28,40 +49,26 @@ func (a *address) GetAddress() string {
 	return `SELECT * FROM addresses WHERE user_id = $1 AND id = $2 AND deleted = false`
 }
 
-func (a *address) CreateAddress(addr map[string]interface{}) string {
-	return fmt.Sprintf(`INSERT INTO addresses(id, user_id, name, phone, first_line, second_line, address_string, city, state, country,
-                      pincode, lat, long, is_default) VALUES ($2, $1, '%s', '%s', '%s', '%s', '%s', '%s', '%s', '%s', '%s', '%f', '%f', %s)`,
-					  addr["name"], addr["phone"], addr["firstLine"], addr["secondLine"], addr["fullAddress"], addr["city"], addr["state"], addr["country"],
-					  addr["pincode"], addr["latitude"], addr["longitude"], getValue(addr["isDefault"]))
+func (a *address) CreateAddress(userId, id string, addr map[string]interface{}) (string, []interface{}) {
+	args := []interface{}{userId, id}
+	for _, field := range createAddressFields {
+		args = append(args, addr[field])
+	}
+
+	return fmt.Sprintf(`INSERT INTO addresses(user_id, id, name, phone, first_line, second_line, address_string, city, state, country,
+                      pincode, lat, long, is_default) VALUES (%s)`, placeholders(1, len(args))), args
 }
 
 func (a *address) RemoveDefaults() string {
 	return `UPDATE addresses SET is_default = false WHERE is_default = true AND user_id = $1`
 }
 
-func (a *address) UpdateAddress(addr map[string]interface{}) string {
-	var updates []string
-	for key, value := range addr {
-		switch key {
-		case "fullAddress":
-			key = "address_string"
-		case "latitude":
-			key = "lat"
-		case "longitude":
-			key = "long"
-		case "firstLine":
-			key = "first_line"
-		case "secondLine":
-			key = "second_line"
-		case "updatedAt":
-			key = "updated_at"
-		case "isDefault":
-			key = "is_default"
-		}
-		updates = append(updates, fmt.Sprintf("%s = %s", key, getValue(value)))
-	}
+func (a *address) UpdateAddress(userId, id string, addr map[string]interface{}) (string, []interface{}) {
+	updates, args := setClause(addr, updatableAddressColumns, 2)
+	args = append([]interface{}{userId, id}, append(args, time.Now())...)
+	updates = append(updates, fmt.Sprintf("updated_at = $%d", len(args)))
 
-	return fmt.Sprintf("UPDATE addresses SET %s WHERE id = $2 AND user_id = $1", strings.Join(updates, ", "))
+	return fmt.Sprintf("UPDATE addresses SET %s WHERE id = $2 AND user_id = $1", strings.Join(updates, ", ")), args
 }
 
 func (a *address) DeleteAddress() string {
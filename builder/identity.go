@@ -0,0 +1,34 @@
+package builder
+
+type IdentityBuilder interface {
+	GetIdentities() string
+	GetIdentityUser() string
+	AddIdentity() string
+	DeleteIdentity() string
+}
+
+type identity struct{}
+
+func NewIdentityBuilder() IdentityBuilder {
+	return &identity{}
+}
+
+func (i *identity) GetIdentities() string {
+	return `SELECT id, user_id, provider, subject, email, linked_at FROM user_identities WHERE user_id = $1 ORDER BY linked_at`
+}
+
+func (i *identity) GetIdentityUser() string {
+	return `SELECT user_id FROM user_identities WHERE provider = $1 AND subject = $2`
+}
+
+func (i *identity) AddIdentity() string {
+	return `INSERT INTO user_identities(id, user_id, provider, subject, email) VALUES($1, $2, $3, $4, $5)
+			ON CONFLICT (provider, subject) DO NOTHING`
+}
+
+// DeleteIdentity only removes the identity when the user can still sign in with a password or another identity
+func (i *identity) DeleteIdentity() string {
+	return `DELETE FROM user_identities WHERE id = $1 AND user_id = $2
+			AND (EXISTS (SELECT 1 FROM users WHERE id = $2 AND password IS NOT NULL)
+				OR EXISTS (SELECT 1 FROM user_identities WHERE user_id = $2 AND id <> $1))`
+}
@@ -0,0 +1,55 @@
+package builder
+
+type MFABuilder interface {
+	GetTOTP() string
+	UpsertTOTP() string
+	ConfirmTOTP() string
+	UseTOTPStep() string
+	DeleteTOTP() string
+	DeleteRecoveryCodes() string
+	AddRecoveryCodes() string
+	UseRecoveryCode() string
+}
+
+type mfa struct{}
+
+func NewMFABuilder() MFABuilder {
+	return &mfa{}
+}
+
+func (m *mfa) GetTOTP() string {
+	return `SELECT secret, confirmed, last_used_step FROM user_totp WHERE user_id = $1`
+}
+
+// UpsertTOTP replaces a pending enrollment but never an enabled one
+func (m *mfa) UpsertTOTP() string {
+	return `INSERT INTO user_totp(user_id, secret) VALUES($1, $2)
+			ON CONFLICT (user_id) DO UPDATE SET secret = $2, last_used_step = 0, updated_at = now()
+				WHERE user_totp.confirmed = false`
+}
+
+func (m *mfa) ConfirmTOTP() string {
+	return `UPDATE user_totp SET confirmed = true, last_used_step = $2, updated_at = now() WHERE user_id = $1`
+}
+
+// UseTOTPStep records the step of an accepted code, failing when a concurrent request already used it
+func (m *mfa) UseTOTPStep() string {
+	return `UPDATE user_totp SET last_used_step = $2, updated_at = now() WHERE user_id = $1 AND last_used_step < $2`
+}
+
+func (m *mfa) DeleteTOTP() string {
+	return `DELETE FROM user_totp WHERE user_id = $1`
+}
+
+func (m *mfa) DeleteRecoveryCodes() string {
+	return `DELETE FROM user_recovery_codes WHERE user_id = $1`
+}
+
+// AddRecoveryCodes inserts every hash of the $2 array for the user
+func (m *mfa) AddRecoveryCodes() string {
+	return `INSERT INTO user_recovery_codes(user_id, code_hash) SELECT $1, unnest($2::varchar[])`
+}
+
+func (m *mfa) UseRecoveryCode() string {
+	return `UPDATE user_recovery_codes SET used_at = now() WHERE user_id = $1 AND code_hash = $2 AND used_at IS NULL`
+}
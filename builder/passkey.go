@@ -0,0 +1,40 @@
+package builder
+
+type PasskeyBuilder interface {
+	GetPasskeys() string
+	GetPasskey() string
+	AddPasskey() string
+	UsePasskey() string
+	DeletePasskey() string
+}
+
+type passkey struct{}
+
+func NewPasskeyBuilder() PasskeyBuilder {
+	return &passkey{}
+}
+
+func (p *passkey) GetPasskeys() string {
+	return `SELECT id, user_id, name, public_key, sign_count, created_at, last_used_at FROM webauthn_credentials
+			WHERE user_id = $1 ORDER BY created_at`
+}
+
+func (p *passkey) GetPasskey() string {
+	return `SELECT id, user_id, name, public_key, sign_count, created_at, last_used_at FROM webauthn_credentials WHERE id = $1`
+}
+
+func (p *passkey) AddPasskey() string {
+	return `INSERT INTO webauthn_credentials(id, user_id, name, public_key, sign_count) VALUES($1, $2, $3, $4, $5)
+			ON CONFLICT (id) DO NOTHING`
+}
+
+// UsePasskey stores the signature counter of an assertion, failing when it did not move forward. Authenticators
+// that do not implement the counter always report 0 and are let through.
+func (p *passkey) UsePasskey() string {
+	return `UPDATE webauthn_credentials SET sign_count = $2, last_used_at = now()
+			WHERE id = $1 AND (sign_count < $2 OR (sign_count = 0 AND $2 = 0))`
+}
+
+func (p *passkey) DeletePasskey() string {
+	return `DELETE FROM webauthn_credentials WHERE id = $1 AND user_id = $2`
+}
@@ -7,78 +7,105 @@ import (
 )
 
 type UserBuilder interface {
-	Register(user map[string]interface{}) string
+	Register(user map[string]interface{}) (string, []interface{})
 	GetUser() string
-	Login(loginType string) string
+	Login() string
 	OAuthRegister() string
 	ResetPassword() string
+	GetPassword() string
 	ChangePassword() string
-	UpdateUser(user map[string]interface{}) string
+	VerifyEmail() string
+	SetDeactivated() string
+	ReactivateSelf() string
+	UpdateUser(id string, user map[string]interface{}) (string, []interface{})
 }
 
 type user struct{}
 
+// registerFields are the fields of a new user in the order of the columns they are inserted into
+var registerFields = []string{"id", "firstName", "lastName", "dob", "gender", "aadhar", "pan", "email", "fbEmail", "phone",
+	"password", "tAndC"}
+
+// updatableUserColumns whitelists the fields a user can change
+var updatableUserColumns = map[string]string{
+	"firstName":      "first_name",
+	"lastName":       "last_name",
+	"fbEmail":        "fb_email",
+	"defaultAddress": "default_address",
+}
+
 func NewUserBuilder() UserBuilder {
 	return &user{}
 }
 
 func (u *user) GetUser() string {
 	return `SELECT id, first_name, last_name, dob, gender, email, phone, null as address, t_and_c, fb_email, created_at, updated_at,
-			verified, pan, aadhar
+			verified, pan, aadhar, deleted
 				FROM users
 			WHERE id = $1 OR email = $2 OR phone = $3 LIMIT 1`
 }
 
-func (u *user) Register(user map[string]interface{}) string {
+func (u *user) Register(user map[string]interface{}) (string, []interface{}) {
+	var args []interface{}
+	for _, field := range registerFields {
+		args = append(args, user[field])
+	}
+
 	return fmt.Sprintf(`INSERT INTO users(id, first_name, last_name, dob, gender, aadhar, pan, email, fb_email, phone,
-		password, t_and_c) VALUES('%s', '%s', '%s', $1, '%s', '%s', '%s', '%s', '%s', '%s', $2, %t)`,
-		user["id"], user["firstName"], user["lastName"], user["gender"], user["aadhar"], user["pan"], user["email"],
-		user["fbEmail"], user["phone"], user["tAndC"])
+		password, t_and_c) VALUES(%s)`, placeholders(1, len(args))), args
 }
 
-func (u *user) Login(loginType string) string {
-	passwordQuery := "AND password = $3"
-	if loginType == "otp" {
-		passwordQuery = "OR password = $3" // this is to skip pg from complaining about additional parameter
-	}
-	return fmt.Sprintf(`SELECT id, first_name, last_name, dob, gender, email, phone, null as address, t_and_c, fb_email, created_at, updated_at,
-			verified, pan, aadhar
+func (u *user) Login() string {
+	return `SELECT id, first_name, last_name, dob, gender, email, phone, null as address, t_and_c, fb_email, created_at, updated_at,
+			verified, pan, aadhar, deleted, password
 				FROM users
-			WHERE (email = $1 OR phone = $2) %s`, passwordQuery)
+			WHERE email = $1 OR phone = $2 LIMIT 1`
 }
 
+// OAuthRegister creates a user from a provider profile together with the link to the provider account, nothing is
+// returned when the email was registered meanwhile
 func (u *user) OAuthRegister() string {
-	return ``
+	return `WITH new_user AS (
+				INSERT INTO users(id, first_name, last_name, email, verified, t_and_c) VALUES($1, $2, $3, $4, $5, true)
+				ON CONFLICT (email) DO NOTHING
+				RETURNING id, first_name, last_name, dob, gender, email, phone, null as address, t_and_c, fb_email,
+					created_at, updated_at, verified, pan, aadhar, deleted
+			), new_identity AS (
+				INSERT INTO user_identities(id, user_id, provider, subject, email) SELECT $6, id, $7, $8, email FROM new_user
+			)
+			SELECT * FROM new_user`
 }
 
 func (u *user) ResetPassword() string {
-	return `UPDATE users SET password = $1 WHERE phone = $2`
+	return `UPDATE users SET password = $1 WHERE id = $2`
+}
+
+func (u *user) GetPassword() string {
+	return `SELECT password FROM users WHERE id = $1 FOR UPDATE`
 }
 
 func (u *user) ChangePassword() string {
-	return `UPDATE users SET password = $1 WHERE password = $2 AND id = $3`
+	return `UPDATE users SET password = $1 WHERE id = $2`
 }
 
-func (u *user) UpdateUser(user map[string]interface{}) string {
-	var updates []string
-	for key, value := range user {
-		if value != nil {
-			switch key {
-			case "firstName":
-				key = "first_name"
-			case "lastName":
-				key = "last_name"
-			case "fbEmail":
-				key = "fb_email"
-			case "defaultAddress":
-				key = "default_address"
-			default:
-				continue
-			}
-
-			updates = append(updates, fmt.Sprintf("%s = %s", key, getValue(value)))
-		}
-	}
+func (u *user) VerifyEmail() string {
+	return `UPDATE users SET verified = true, updated_at = now() WHERE id = $1 AND email = $2`
+}
+
+func (u *user) SetDeactivated() string {
+	return `UPDATE users SET deleted = $2, deactivated_by = $3, updated_at = now() WHERE id = $1`
+}
 
-	return fmt.Sprintf("UPDATE users SET %s, updated_at = '%s' WHERE id = $1", strings.Join(updates, ", "), time.Now().Format(time.RFC3339))
-}
\ No newline at end of file
+// ReactivateSelf reactivates the account only when it was deactivated by $2, so users can only undo their own deactivation
+func (u *user) ReactivateSelf() string {
+	return `UPDATE users SET deleted = false, deactivated_by = NULL, updated_at = now()
+			WHERE id = $1 AND deleted AND deactivated_by = $2`
+}
+
+func (u *user) UpdateUser(id string, user map[string]interface{}) (string, []interface{}) {
+	updates, args := setClause(user, updatableUserColumns, 1)
+	args = append([]interface{}{id}, append(args, time.Now())...)
+	updates = append(updates, fmt.Sprintf("updated_at = $%d", len(args)))
+
+	return fmt.Sprintf("UPDATE users SET %s WHERE id = $1", strings.Join(updates, ", ")), args
+}
@@ -2,30 +2,38 @@ package builder
 
 import (
 	"fmt"
+	"sort"
 	"strings"
 )
 
-func getValue(value interface{}) string {
-	res := ""
-	switch value.(type) {
-	case string:
-		res = fmt.Sprintf("'%s'", value.(string))
-	case bool:
-		res = fmt.Sprintf("%t", value.(bool))
-	case int64:
-		res = fmt.Sprintf("%d", value.(int64))
-	case float64:
-		res = fmt.Sprintf("%f", value.(float64))
-	case []int64:
-		var values []string
-		for _, val := range value.([]int64) {
-			values = append(values, fmt.Sprintf("%d", val))
+// setClause builds the SET clause of a dynamic UPDATE. Only fields present in columns, which maps the accepted
+// field names to their column, are written and nil values are skipped. Every value is bound to a placeholder
+// numbered after the first offset arguments so that no user input ever ends up in the query text.
+func setClause(fields map[string]interface{}, columns map[string]string, offset int) ([]string, []interface{}) {
+	var names []string
+	for name, value := range fields {
+		if _, ok := columns[name]; ok && value != nil {
+			names = append(names, name)
 		}
+	}
+
+	sort.Strings(names)
+	var updates []string
+	var args []interface{}
+	for _, name := range names {
+		args = append(args, fields[name])
+		updates = append(updates, fmt.Sprintf("%s = $%d", columns[name], offset+len(args)))
+	}
+
+	return updates, args
+}
 
-		res = fmt.Sprintf("ARRAY [%s]", strings.Join(values, ", "))
-	default:
-		res = "''"
+// placeholders returns $from, $from+1... for count arguments
+func placeholders(from, count int) string {
+	var res []string
+	for i := 0; i < count; i++ {
+		res = append(res, fmt.Sprintf("$%d", from+i))
 	}
 
-	return res
+	return strings.Join(res, ", ")
 }
@@ -0,0 +1,116 @@
+package client
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"os"
+	"time"
+
+	"authservice/models"
+)
+
+type Registry interface {
+	Get(id string) (*models.Client, bool)
+	Authenticate(id, secret string) (*models.Client, error)
+	Lifetime(id string) models.TokenLifetime
+	LongestLifetime() time.Duration
+}
+
+type registry struct {
+	clients  map[string]*models.Client
+	lifetime models.TokenLifetime
+}
+
+// LoadRegistry reads the registered clients from a JSON file holding a list of clients,
+// no clients are registered when file is empty. lifetime applies to clients that do not override it.
+func LoadRegistry(file string, lifetime models.TokenLifetime) (Registry, error) {
+	err := lifetime.Validate()
+	if err != nil {
+		return nil, fmt.Errorf("loadRegistry: %s", err)
+	}
+
+	r := &registry{
+		clients:  map[string]*models.Client{},
+		lifetime: lifetime,
+	}
+	if file == "" {
+		return r, nil
+	}
+
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, fmt.Errorf("loadRegistry: unable to read %s: %s", file, err)
+	}
+
+	var clients []*models.Client
+	err = json.Unmarshal(data, &clients)
+	if err != nil {
+		return nil, fmt.Errorf("loadRegistry: unable to decode %s: %s", file, err)
+	}
+
+	for _, c := range clients {
+		if c.Id == "" {
+			return nil, fmt.Errorf("loadRegistry: client without id in %s", file)
+		}
+
+		if _, ok := r.clients[c.Id]; ok {
+			return nil, fmt.Errorf("loadRegistry: duplicate client id %s", c.Id)
+		}
+
+		clientLifetime := lifetime.Override(c)
+		err = clientLifetime.Validate()
+		if err != nil {
+			return nil, fmt.Errorf("loadRegistry: client %s: %s", c.Id, err)
+		}
+
+		r.clients[c.Id] = c
+	}
+
+	return r, nil
+}
+
+func (r *registry) Get(id string) (*models.Client, bool) {
+	c, ok := r.clients[id]
+	return c, ok
+}
+
+func (r *registry) Authenticate(id, secret string) (*models.Client, error) {
+	c, ok := r.clients[id]
+	if !ok {
+		return nil, fmt.Errorf("authenticate: unknown client")
+	}
+
+	if !c.IsConfidential() {
+		return nil, fmt.Errorf("authenticate: client %s is not a confidential client", id)
+	}
+
+	if subtle.ConstantTimeCompare([]byte(secret), []byte(c.Secret)) != 1 {
+		return nil, fmt.Errorf("authenticate: invalid client secret")
+	}
+
+	return c, nil
+}
+
+// Lifetime returns the token lifetimes of the client, unknown or empty ids get the configured ones
+func (r *registry) Lifetime(id string) models.TokenLifetime {
+	c, ok := r.clients[id]
+	if !ok {
+		return r.lifetime
+	}
+
+	return r.lifetime.Override(c)
+}
+
+// LongestLifetime is the longest time any token issued to any client can stay valid
+func (r *registry) LongestLifetime() time.Duration {
+	longest := r.lifetime.Longest()
+	for _, c := range r.clients {
+		lifetime := r.lifetime.Override(c)
+		if lifetime.Longest() > longest {
+			longest = lifetime.Longest()
+		}
+	}
+
+	return longest
+}
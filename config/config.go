@@ -8,12 +8,25 @@ import (
 )
 
 type Config struct {
-	Port          int
-	TokenSecret   string
-	RefreshSecret string
+	Port                      int
+	TokenSigningKeyFile       string
+	TokenVerificationKeyFiles []string
+	RefreshSecret             string
+	KeyRingSecret             string
+	AdminApiKey               string
+	ClientsFile               string
+	TOTPIssuer                string
 
 	PgConfig      *pgConfig
 	RedisConfig   *redisConfig
+	HasherConfig  *hasherConfig
+	SessionConfig *sessionConfig
+	TokenConfig   *tokenConfig
+	Verification  *verificationConfig
+	WebAuthn      *webAuthnConfig
+	OTPConfig     *otpConfig
+	MagicLink     *magicLinkConfig
+	OAuth         *oauthConfig
 	ProvidersConf []*providerConf
 }
 
@@ -37,9 +50,14 @@ func getConfigFromEnv() (*Config, []string, error) {
 		missing = append(missing, "PORT")
 	}
 
-	tokenSecret, found := getEnv("TOKEN_SECRET")
+	tokenSigningKeyFile, found := getEnv("TOKEN_SIGNING_KEY_FILE")
 	if !found {
-		missing = append(missing, "TOKEN_SECRET")
+		missing = append(missing, "TOKEN_SIGNING_KEY_FILE")
+	}
+
+	var tokenVerificationKeyFiles []string
+	if files, found := getEnv("TOKEN_VERIFICATION_KEY_FILES"); found {
+		tokenVerificationKeyFiles = strings.Split(files, ",")
 	}
 
 	refreshSecret, found := getEnv("REFRESH_SECRET")
@@ -47,9 +65,24 @@ func getConfigFromEnv() (*Config, []string, error) {
 		missing = append(missing, "REFRESH_SECRET")
 	}
 
+	keyRingSecret, found := getEnv("KEYRING_SECRET")
+	if !found {
+		keyRingSecret = refreshSecret
+	}
+
+	adminApiKey, _ := getEnv("ADMIN_API_KEY")
+	clientsFile, _ := getEnv("CLIENTS_FILE")
+	totpIssuer, found := getEnv("TOTP_ISSUER")
+	if !found {
+		totpIssuer = "authservice"
+	}
+
 	pgConfig := newPostgresConfig(&missing)
 	redisConfig := newRedisConfig(&missing)
-	googleProvider := newGoogleAuthProvider(&missing)
+	providers, err := newProviderConfs(&missing)
+	if err != nil {
+		return nil, nil, err
+	}
 
 	if len(missing) > 0 {
 		return nil, missing, nil
@@ -79,15 +112,61 @@ func getConfigFromEnv() (*Config, []string, error) {
 	redisConfig.Port = redisPort
 	redisConfig.Database = redisDatabase
 
+	hasherConfig, err := newHasherConfig()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	sessionConfig, err := newSessionConfig()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	tokenConfig, err := newTokenConfig()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	verificationConfig, err := newVerificationConfig()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	otpConfig, err := newOTPConfig()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	magicLinkConfig, err := newMagicLinkConfig()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	oauthConfig, err := newOAuthConfig(port, keyRingSecret)
+	if err != nil {
+		return nil, nil, err
+	}
+
 	return &Config{
-		Port:          port,
-		TokenSecret:   tokenSecret,
-		RefreshSecret: refreshSecret,
-		PgConfig:      pgConfig,
-		RedisConfig:   redisConfig,
-		ProvidersConf: []*providerConf{
-			googleProvider,
-		},
+		Port:                      port,
+		TokenSigningKeyFile:       tokenSigningKeyFile,
+		TokenVerificationKeyFiles: tokenVerificationKeyFiles,
+		RefreshSecret:             refreshSecret,
+		KeyRingSecret:             keyRingSecret,
+		AdminApiKey:               adminApiKey,
+		ClientsFile:               clientsFile,
+		TOTPIssuer:                totpIssuer,
+		PgConfig:                  pgConfig,
+		RedisConfig:               redisConfig,
+		HasherConfig:              hasherConfig,
+		SessionConfig:             sessionConfig,
+		TokenConfig:               tokenConfig,
+		Verification:              verificationConfig,
+		WebAuthn:                  newWebAuthnConfig(),
+		OTPConfig:                 otpConfig,
+		MagicLink:                 magicLinkConfig,
+		OAuth:                     oauthConfig,
+		ProvidersConf:             providers,
 	}, nil, nil
 }
 
@@ -99,3 +178,31 @@ func getEnv(key string) (string, bool) {
 
 	return value, true
 }
+
+func getEnvInt(key string, fallback int) (int, error) {
+	valueString, found := getEnv(key)
+	if !found {
+		return fallback, nil
+	}
+
+	value, err := strconv.Atoi(valueString)
+	if err != nil || value <= 0 {
+		return 0, fmt.Errorf("invalid value provided for %s", key)
+	}
+
+	return value, nil
+}
+
+func getEnvBool(key string, fallback bool) (bool, error) {
+	valueString, found := getEnv(key)
+	if !found {
+		return fallback, nil
+	}
+
+	value, err := strconv.ParseBool(valueString)
+	if err != nil {
+		return false, fmt.Errorf("invalid value provided for %s", key)
+	}
+
+	return value, nil
+}
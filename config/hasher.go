@@ -0,0 +1,52 @@
+package config
+
+import "fmt"
+
+type hasherConfig struct {
+	Algorithm     string
+	Argon2Time    uint32
+	Argon2Memory  uint32
+	Argon2Threads uint8
+	BcryptCost    int
+}
+
+func newHasherConfig() (*hasherConfig, error) {
+	algorithm, found := getEnv("PASSWORD_HASH_ALGORITHM")
+	if !found {
+		algorithm = "argon2id"
+	}
+
+	argon2Time, err := getEnvInt("ARGON2_TIME", 3)
+	if err != nil {
+		return nil, err
+	}
+
+	argon2Memory, err := getEnvInt("ARGON2_MEMORY_KB", 64*1024)
+	if err != nil {
+		return nil, err
+	}
+
+	argon2Threads, err := getEnvInt("ARGON2_THREADS", 2)
+	if err != nil {
+		return nil, err
+	}
+
+	bcryptCost, err := getEnvInt("BCRYPT_COST", 12)
+	if err != nil {
+		return nil, err
+	}
+
+	switch algorithm {
+	case "argon2id", "bcrypt":
+	default:
+		return nil, fmt.Errorf("invalid value provided for PASSWORD_HASH_ALGORITHM")
+	}
+
+	return &hasherConfig{
+		Algorithm:     algorithm,
+		Argon2Time:    uint32(argon2Time),
+		Argon2Memory:  uint32(argon2Memory),
+		Argon2Threads: uint8(argon2Threads),
+		BcryptCost:    bcryptCost,
+	}, nil
+}
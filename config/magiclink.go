@@ -0,0 +1,19 @@
+package config
+
+type magicLinkConfig struct {
+	URL string
+	TTL int
+}
+
+func newMagicLinkConfig() (*magicLinkConfig, error) {
+	url, _ := getEnv("MAGIC_LINK_URL")
+	ttl, err := getEnvInt("MAGIC_LINK_TTL", 15*60)
+	if err != nil {
+		return nil, err
+	}
+
+	return &magicLinkConfig{
+		URL: url,
+		TTL: ttl,
+	}, nil
+}
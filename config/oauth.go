@@ -0,0 +1,38 @@
+package config
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+type oauthConfig struct {
+	PublicURL     string
+	SessionKeys   []string
+	SecureCookies bool
+}
+
+// newOAuthConfig reads the public URL the providers redirect back to and the keys of the OAuth session cookie. The
+// first session key signs new cookies while the others are still accepted, the key ring secret is used without any.
+func newOAuthConfig(port int, keyRingSecret string) (*oauthConfig, error) {
+	publicURL, found := getEnv("PUBLIC_URL")
+	if !found {
+		publicURL = fmt.Sprintf("http://localhost:%d", port)
+	}
+
+	parsed, err := url.Parse(publicURL)
+	if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+		return nil, fmt.Errorf("invalid value provided for PUBLIC_URL")
+	}
+
+	sessionKeys := []string{keyRingSecret}
+	if keys, found := getEnv("OAUTH_SESSION_KEYS"); found {
+		sessionKeys = strings.Split(keys, ",")
+	}
+
+	return &oauthConfig{
+		PublicURL:     strings.TrimSuffix(publicURL, "/"),
+		SessionKeys:   sessionKeys,
+		SecureCookies: parsed.Scheme == "https",
+	}, nil
+}
@@ -0,0 +1,30 @@
+package config
+
+type otpConfig struct {
+	MaxAttempts    int
+	ResendCooldown int
+	DailyLimit     int
+}
+
+func newOTPConfig() (*otpConfig, error) {
+	maxAttempts, err := getEnvInt("OTP_MAX_ATTEMPTS", 5)
+	if err != nil {
+		return nil, err
+	}
+
+	resendCooldown, err := getEnvInt("OTP_RESEND_COOLDOWN", 60)
+	if err != nil {
+		return nil, err
+	}
+
+	dailyLimit, err := getEnvInt("OTP_DAILY_LIMIT", 10)
+	if err != nil {
+		return nil, err
+	}
+
+	return &otpConfig{
+		MaxAttempts:    maxAttempts,
+		ResendCooldown: resendCooldown,
+		DailyLimit:     dailyLimit,
+	}, nil
+}
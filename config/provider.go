@@ -1,25 +1,94 @@
 package config
 
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// provider types with built in endpoints, any other provider is a generic OpenID Connect issuer found by discovery
+const (
+	ProviderGoogle    = "google"
+	ProviderGithub    = "github"
+	ProviderMicrosoft = "microsoft"
+	ProviderApple     = "apple"
+	ProviderFacebook  = "facebook"
+	ProviderOIDC      = "oidc"
+)
+
+var envUnsafe = regexp.MustCompile(`[^A-Z0-9]+`)
+
 type providerConf struct {
 	Name         string
+	Type         string
 	ClientId     string
 	ClientSecret string
+	DiscoveryURL string
+	Scopes       []string
 }
 
-func newGoogleAuthProvider(missing *[]string) *providerConf {
-	clientId, found := getEnv("GOOGLE_CLIENT_ID")
+// newProviderConfs reads the OAuth providers listed in OAUTH_PROVIDERS, each one configured by <NAME>_CLIENT_ID,
+// <NAME>_CLIENT_SECRET, optional <NAME>_SCOPES and, for generic issuers, <NAME>_DISCOVERY_URL. Google stays enabled
+// without the list when GOOGLE_CLIENT_ID is set, as it was the only provider before.
+func newProviderConfs(missing *[]string) ([]*providerConf, error) {
+	names, found := getEnv("OAUTH_PROVIDERS")
 	if !found {
-		*missing = append(*missing, "GOOGLE_CLIENT_ID")
+		if _, found := getEnv("GOOGLE_CLIENT_ID"); !found {
+			return nil, nil
+		}
+
+		names = ProviderGoogle
 	}
 
-	clientSecret, found := getEnv("GOOGLE_CLIENT_SECRET")
+	var providers []*providerConf
+	seen := map[string]bool{}
+	for _, name := range strings.Split(names, ",") {
+		name = strings.ToLower(strings.TrimSpace(name))
+		if name == "" {
+			continue
+		}
+
+		if seen[name] {
+			return nil, fmt.Errorf("provider %s is listed more than once in OAUTH_PROVIDERS", name)
+		}
+
+		seen[name] = true
+		providers = append(providers, newProviderConf(name, missing))
+	}
+
+	return providers, nil
+}
+
+func newProviderConf(name string, missing *[]string) *providerConf {
+	prefix := strings.Trim(envUnsafe.ReplaceAllString(strings.ToUpper(name), "_"), "_")
+	conf := &providerConf{Name: name, Type: name}
+	switch name {
+	case ProviderGoogle, ProviderGithub, ProviderMicrosoft, ProviderApple, ProviderFacebook:
+	default:
+		conf.Type = ProviderOIDC
+		url, found := getEnv(fmt.Sprintf("%s_DISCOVERY_URL", prefix))
+		if !found {
+			*missing = append(*missing, fmt.Sprintf("%s_DISCOVERY_URL", prefix))
+		}
+
+		conf.DiscoveryURL = url
+	}
+
+	clientId, found := getEnv(fmt.Sprintf("%s_CLIENT_ID", prefix))
 	if !found {
-		*missing = append(*missing, "GOOGLE_CLIENT_SECRET")
+		*missing = append(*missing, fmt.Sprintf("%s_CLIENT_ID", prefix))
 	}
 
-	return &providerConf{
-		Name:         "google",
-		ClientId:     clientId,
-		ClientSecret: clientSecret,
+	clientSecret, found := getEnv(fmt.Sprintf("%s_CLIENT_SECRET", prefix))
+	if !found {
+		*missing = append(*missing, fmt.Sprintf("%s_CLIENT_SECRET", prefix))
+	}
+
+	if scopes, found := getEnv(fmt.Sprintf("%s_SCOPES", prefix)); found {
+		conf.Scopes = strings.Split(scopes, ",")
 	}
+
+	conf.ClientId = clientId
+	conf.ClientSecret = clientSecret
+	return conf
 }
@@ -0,0 +1,54 @@
+package config
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+type sessionConfig struct {
+	Mode             string
+	MaxSessions      int
+	ClientTypeLimits map[string]int
+}
+
+func newSessionConfig() (*sessionConfig, error) {
+	mode, found := getEnv("SESSION_POLICY_MODE")
+	if !found {
+		mode = "evict_oldest"
+	}
+
+	maxSessions, err := getEnvInt("SESSION_MAX_ACTIVE", 3)
+	if err != nil {
+		return nil, err
+	}
+
+	clientTypeLimits := map[string]int{}
+	if limits, found := getEnv("SESSION_CLIENT_TYPE_LIMITS"); found {
+		for _, limit := range strings.Split(limits, ",") {
+			parts := strings.SplitN(strings.TrimSpace(limit), "=", 2)
+			if len(parts) != 2 {
+				return nil, fmt.Errorf("invalid value provided for SESSION_CLIENT_TYPE_LIMITS")
+			}
+
+			value, err := strconv.Atoi(parts[1])
+			if err != nil || value <= 0 {
+				return nil, fmt.Errorf("invalid value provided for SESSION_CLIENT_TYPE_LIMITS")
+			}
+
+			clientTypeLimits[parts[0]] = value
+		}
+	}
+
+	switch mode {
+	case "evict_oldest", "deny_new", "unlimited":
+	default:
+		return nil, fmt.Errorf("invalid value provided for SESSION_POLICY_MODE")
+	}
+
+	return &sessionConfig{
+		Mode:             mode,
+		MaxSessions:      maxSessions,
+		ClientTypeLimits: clientTypeLimits,
+	}, nil
+}
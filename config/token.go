@@ -0,0 +1,40 @@
+package config
+
+import "fmt"
+
+type tokenConfig struct {
+	AccessTokenTTL     int
+	RefreshTokenTTL    int
+	SessionMaxLifetime int
+}
+
+func newTokenConfig() (*tokenConfig, error) {
+	accessTokenTTL, err := getEnvInt("ACCESS_TOKEN_TTL", 15*60)
+	if err != nil {
+		return nil, err
+	}
+
+	refreshTokenTTL, err := getEnvInt("REFRESH_TOKEN_TTL", 5*24*60*60)
+	if err != nil {
+		return nil, err
+	}
+
+	sessionMaxLifetime, err := getEnvInt("SESSION_MAX_LIFETIME", 30*24*60*60)
+	if err != nil {
+		return nil, err
+	}
+
+	if accessTokenTTL >= refreshTokenTTL {
+		return nil, fmt.Errorf("ACCESS_TOKEN_TTL should be shorter than REFRESH_TOKEN_TTL")
+	}
+
+	if refreshTokenTTL > sessionMaxLifetime {
+		return nil, fmt.Errorf("REFRESH_TOKEN_TTL should not exceed SESSION_MAX_LIFETIME")
+	}
+
+	return &tokenConfig{
+		AccessTokenTTL:     accessTokenTTL,
+		RefreshTokenTTL:    refreshTokenTTL,
+		SessionMaxLifetime: sessionMaxLifetime,
+	}, nil
+}
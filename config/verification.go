@@ -0,0 +1,39 @@
+package config
+
+import "fmt"
+
+type verificationConfig struct {
+	Required       bool
+	URL            string
+	TTL            int
+	ResendCooldown int
+}
+
+func newVerificationConfig() (*verificationConfig, error) {
+	required, err := getEnvBool("REQUIRE_VERIFIED_EMAIL", false)
+	if err != nil {
+		return nil, err
+	}
+
+	url, _ := getEnv("EMAIL_VERIFICATION_URL")
+	ttl, err := getEnvInt("EMAIL_VERIFICATION_TTL", 24*60*60)
+	if err != nil {
+		return nil, err
+	}
+
+	resendCooldown, err := getEnvInt("EMAIL_VERIFICATION_RESEND_COOLDOWN", 60)
+	if err != nil {
+		return nil, err
+	}
+
+	if resendCooldown >= ttl {
+		return nil, fmt.Errorf("EMAIL_VERIFICATION_RESEND_COOLDOWN should be shorter than EMAIL_VERIFICATION_TTL")
+	}
+
+	return &verificationConfig{
+		Required:       required,
+		URL:            url,
+		TTL:            ttl,
+		ResendCooldown: resendCooldown,
+	}, nil
+}
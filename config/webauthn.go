@@ -0,0 +1,35 @@
+package config
+
+import (
+	"fmt"
+	"strings"
+)
+
+type webAuthnConfig struct {
+	RPID    string
+	RPName  string
+	Origins []string
+}
+
+func newWebAuthnConfig() *webAuthnConfig {
+	rpId, found := getEnv("WEBAUTHN_RP_ID")
+	if !found {
+		rpId = "localhost"
+	}
+
+	rpName, found := getEnv("WEBAUTHN_RP_NAME")
+	if !found {
+		rpName = "authservice"
+	}
+
+	origins := []string{fmt.Sprintf("https://%s", rpId)}
+	if values, found := getEnv("WEBAUTHN_ORIGINS"); found {
+		origins = strings.Split(values, ",")
+	}
+
+	return &webAuthnConfig{
+		RPID:    rpId,
+		RPName:  rpName,
+		Origins: origins,
+	}
+}
@@ -13,4 +13,42 @@ const (
 	LoginPhone    = "phone_password"
 	LoginPhoneOTP = "phone_otp"
 	LoginInvalid  = "invalid"
+
+	EventRefreshTokenReuse  = "REFRESH_TOKEN_REUSE"
+	EventAccountDeactivated = "ACCOUNT_DEACTIVATED"
+	EventAccountReactivated = "ACCOUNT_REACTIVATED"
+	EventMFAEnabled         = "MFA_ENABLED"
+	EventMFADisabled        = "MFA_DISABLED"
+	EventRecoveryCodeUsed   = "RECOVERY_CODE_USED"
+	EventPasskeyAdded       = "PASSKEY_ADDED"
+	EventPasskeyRemoved     = "PASSKEY_REMOVED"
+	EventIdentityLinked     = "IDENTITY_LINKED"
+	EventIdentityUnlinked   = "IDENTITY_UNLINKED"
+
+	SessionEvictOldest = "evict_oldest"
+	SessionDenyNew     = "deny_new"
+	SessionUnlimited   = "unlimited"
+
+	PurposeEmailVerification = "email_verification"
+	PurposeMFAChallenge      = "mfa_challenge"
+	PurposeOTPLogin          = "otp_login"
+	PurposePasswordReset     = "password_reset"
+	PurposeMagicLink         = "magic_link"
+	PurposeIdentityLink      = "identity_link"
+
+	IntentLink = "link"
+
+	DeactivatedBySelf  = "self"
+	DeactivatedByAdmin = "admin"
+
+	NotificationVerifyEmail = "VERIFY_EMAIL"
+	NotificationOTP         = "OTP"
+	NotificationMagicLink   = "MAGIC_LINK"
+
+	ChannelSMS   = "SMS"
+	ChannelEmail = "EMAIL"
+
+	MFATOTP         = "totp"
+	MFARecoveryCode = "recovery_code"
+	MFAPasskey      = "passkey"
 )
@@ -8,9 +8,14 @@ import (
 
 	"github.com/go-redis/redis/v8"
 	pg "github.com/jackc/pgx/v4/pgxpool"
+
+	"authservice/client"
+	"authservice/keys"
+	"authservice/models"
+	"authservice/provider"
 )
 
-var pgSync, redisSync sync.Once
+var pgSync, redisSync, keySetSync, secretSetSync, clientsSync, providersSync sync.Once
 
 func (f *factory) pgDriver() (*pg.Pool, error) {
 	var err error
@@ -65,3 +70,83 @@ func (f *factory) redisDriver() (*redis.Client, error) {
 
 	return f.redisConn, err
 }
+
+func (f *factory) loadKeySet() (keys.KeySet, error) {
+	var err error
+	keySetSync.Do(func() {
+		ks, loadErr := keys.LoadKeySet(context.TODO(), f.RedisQueryer(), f.config.TokenSigningKeyFile,
+			f.config.TokenVerificationKeyFiles, f.config.KeyRingSecret, f.keyRetention())
+		if loadErr != nil {
+			err = loadErr
+			return
+		}
+
+		f.keySet = ks
+	})
+
+	return f.keySet, err
+}
+
+func (f *factory) loadSecretSet() (keys.SecretSet, error) {
+	var err error
+	secretSetSync.Do(func() {
+		ss, loadErr := keys.LoadSecretSet(context.TODO(), f.RedisQueryer(), f.config.RefreshSecret,
+			f.config.KeyRingSecret, f.keyRetention())
+		if loadErr != nil {
+			err = loadErr
+			return
+		}
+
+		f.secretSet = ss
+	})
+
+	return f.secretSet, err
+}
+
+func (f *factory) loadClients() (client.Registry, error) {
+	var err error
+	clientsSync.Do(func() {
+		registry, loadErr := client.LoadRegistry(f.config.ClientsFile, models.TokenLifetime{
+			AccessTokenTTL:     time.Duration(f.config.TokenConfig.AccessTokenTTL) * time.Second,
+			RefreshTokenTTL:    time.Duration(f.config.TokenConfig.RefreshTokenTTL) * time.Second,
+			SessionMaxLifetime: time.Duration(f.config.TokenConfig.SessionMaxLifetime) * time.Second,
+		})
+		if loadErr != nil {
+			err = loadErr
+			return
+		}
+
+		f.clients = registry
+	})
+
+	return f.clients, err
+}
+
+func (f *factory) loadProviders() provider.Registry {
+	providersSync.Do(func() {
+		var settings []*provider.Settings
+		for _, conf := range f.config.ProvidersConf {
+			settings = append(settings, &provider.Settings{
+				Name:         conf.Name,
+				Type:         conf.Type,
+				ClientId:     conf.ClientId,
+				ClientSecret: conf.ClientSecret,
+				DiscoveryURL: conf.DiscoveryURL,
+				Scopes:       conf.Scopes,
+			})
+		}
+
+		f.providers = provider.NewRegistry(f.logger, settings, &provider.Options{
+			PublicURL:     f.config.OAuth.PublicURL,
+			SessionKeys:   f.config.OAuth.SessionKeys,
+			SecureCookies: f.config.OAuth.SecureCookies,
+		})
+	})
+
+	return f.providers
+}
+
+// keyRetention is how long a retired key stays valid, i.e. the longest lifetime of a token it could have signed
+func (f *factory) keyRetention() time.Duration {
+	return f.Clients().LongestLifetime()
+}
@@ -2,6 +2,7 @@ package factory
 
 import (
 	"log"
+	"time"
 
 	"github.com/aws/aws-sdk-go/aws/session"
 	"github.com/go-redis/redis/v8"
@@ -11,11 +12,21 @@ import (
 	"authservice/address"
 	"authservice/auth"
 	"authservice/builder"
+	"authservice/client"
 	"authservice/config"
+	"authservice/hasher"
 	"authservice/helper"
+	"authservice/identity"
+	"authservice/keys"
+	"authservice/mfa"
 	"authservice/middleware"
+	"authservice/migrations"
+	"authservice/models"
+	"authservice/passkey"
+	"authservice/provider"
 	"authservice/repository"
 	"authservice/user"
+	"authservice/webauthn"
 )
 
 type Factory interface {
@@ -24,9 +35,24 @@ type Factory interface {
 	RedisQueryer() repository.RedisQueryer
 	User() user.User
 	Address() address.Address
+	MFA() mfa.MFA
+	Passkey() passkey.Passkey
+	Identity() identity.Identity
+	Providers() provider.Registry
 	Helper() helper.Helper
+	PasswordHasher() hasher.Hasher
+	KeySet() keys.KeySet
+	SecretSet() keys.SecretSet
+	Clients() client.Registry
+	Migrator() migrations.Migrator
+	SessionPolicy() *models.SessionPolicy
+	EmailVerification() *models.EmailVerification
+	OTPPolicy() *models.OTPPolicy
+	MagicLink() *models.MagicLink
 	Authorizer() auth.Authorizer
 	TokenValidator() *middleware.TokenValidator
+	AdminValidator() *middleware.AdminValidator
+	ClientValidator() *middleware.ClientValidator
 }
 
 type factory struct {
@@ -35,6 +61,10 @@ type factory struct {
 	pgConn     *pg.Pool
 	awsSession *session.Session
 	redisConn  *redis.Client
+	keySet     keys.KeySet
+	secretSet  keys.SecretSet
+	clients    client.Registry
+	providers  provider.Registry
 	config     *config.Config
 }
 
@@ -68,7 +98,35 @@ func (f *factory) RedisQueryer() repository.RedisQueryer {
 }
 
 func (f *factory) User() user.User {
-	return user.NewUser(builder.NewUserBuilder(), f.PostgresQueryer(), f.RedisQueryer(), f.Helper())
+	return user.NewUser(builder.NewUserBuilder(), f.PostgresQueryer(), f.RedisQueryer(), f.Helper(), f.PasswordHasher(), f.Clients(),
+		f.SessionPolicy(), f.EmailVerification(), f.MFA(),
+		f.Passkey(), f.OTPPolicy(), f.MagicLink(), f.Identity())
+}
+
+func (f *factory) MFA() mfa.MFA {
+	m, err := mfa.NewMFA(builder.NewMFABuilder(), f.PostgresQueryer(), f.RedisQueryer(), f.Helper(), f.config.TOTPIssuer,
+		f.config.KeyRingSecret)
+	if err != nil {
+		log.Fatalf("Unable to create MFA: %s", err)
+	}
+
+	return m
+}
+
+func (f *factory) Passkey() passkey.Passkey {
+	return passkey.NewPasskey(builder.NewPasskeyBuilder(), f.PostgresQueryer(), f.RedisQueryer(), f.Helper(), &webauthn.RelyingParty{
+		ID:      f.config.WebAuthn.RPID,
+		Name:    f.config.WebAuthn.RPName,
+		Origins: f.config.WebAuthn.Origins,
+	})
+}
+
+func (f *factory) Identity() identity.Identity {
+	return identity.NewIdentity(builder.NewIdentityBuilder(), f.PostgresQueryer(), f.Helper())
+}
+
+func (f *factory) Providers() provider.Registry {
+	return f.loadProviders()
 }
 
 func (f *factory) Address() address.Address {
@@ -76,13 +134,108 @@ func (f *factory) Address() address.Address {
 }
 
 func (f *factory) Helper() helper.Helper {
-	return helper.NewHelper(f.logger, f.RedisQueryer(), f.config.TokenSecret, f.config.RefreshSecret)
+	return helper.NewHelper(f.logger, f.RedisQueryer(), f.KeySet(), f.SecretSet(), f.config.RefreshSecret)
+}
+
+func (f *factory) PasswordHasher() hasher.Hasher {
+	h, err := hasher.NewHasher(f.config.HasherConfig.Algorithm, hasher.Params{
+		Argon2Time:    f.config.HasherConfig.Argon2Time,
+		Argon2Memory:  f.config.HasherConfig.Argon2Memory,
+		Argon2Threads: f.config.HasherConfig.Argon2Threads,
+		BcryptCost:    f.config.HasherConfig.BcryptCost,
+	})
+	if err != nil {
+		log.Fatalf("Unable to create password hasher: %s", err)
+	}
+
+	return h
+}
+
+func (f *factory) KeySet() keys.KeySet {
+	ks, err := f.loadKeySet()
+	if err != nil {
+		log.Fatalf("Unable to load token signing keys: %s", err)
+	}
+
+	return ks
+}
+
+func (f *factory) SecretSet() keys.SecretSet {
+	ss, err := f.loadSecretSet()
+	if err != nil {
+		log.Fatalf("Unable to load refresh token secrets: %s", err)
+	}
+
+	return ss
+}
+
+func (f *factory) Clients() client.Registry {
+	registry, err := f.loadClients()
+	if err != nil {
+		log.Fatalf("Unable to load clients: %s", err)
+	}
+
+	return registry
+}
+
+func (f *factory) Migrator() migrations.Migrator {
+	d, err := f.pgDriver()
+	if err != nil {
+		log.Fatalf("Unable to establish connection to postgres: %s", err)
+	}
+
+	m, err := migrations.NewMigrator(d)
+	if err != nil {
+		log.Fatalf("Unable to load migrations: %s", err)
+	}
+
+	return m
+}
+
+func (f *factory) SessionPolicy() *models.SessionPolicy {
+	return &models.SessionPolicy{
+		Mode:             f.config.SessionConfig.Mode,
+		MaxSessions:      f.config.SessionConfig.MaxSessions,
+		ClientTypeLimits: f.config.SessionConfig.ClientTypeLimits,
+	}
+}
+
+func (f *factory) EmailVerification() *models.EmailVerification {
+	return &models.EmailVerification{
+		Required:       f.config.Verification.Required,
+		URL:            f.config.Verification.URL,
+		TTL:            time.Duration(f.config.Verification.TTL) * time.Second,
+		ResendCooldown: time.Duration(f.config.Verification.ResendCooldown) * time.Second,
+	}
+}
+
+func (f *factory) OTPPolicy() *models.OTPPolicy {
+	return &models.OTPPolicy{
+		MaxAttempts:    f.config.OTPConfig.MaxAttempts,
+		ResendCooldown: time.Duration(f.config.OTPConfig.ResendCooldown) * time.Second,
+		DailyLimit:     f.config.OTPConfig.DailyLimit,
+	}
+}
+
+func (f *factory) MagicLink() *models.MagicLink {
+	return &models.MagicLink{
+		URL: f.config.MagicLink.URL,
+		TTL: time.Duration(f.config.MagicLink.TTL) * time.Second,
+	}
 }
 
 func (f *factory) Authorizer() auth.Authorizer {
-	return auth.NewAuthorizer(f.Helper(), f.RedisQueryer())
+	return auth.NewAuthorizer(f.Helper(), f.RedisQueryer(), f.Clients())
 }
 
 func (f *factory) TokenValidator() *middleware.TokenValidator {
 	return middleware.NewTokenValidator(f.logger, f.Authorizer())
-}
\ No newline at end of file
+}
+
+func (f *factory) AdminValidator() *middleware.AdminValidator {
+	return middleware.NewAdminValidator(f.logger, f.config.AdminApiKey)
+}
+
+func (f *factory) ClientValidator() *middleware.ClientValidator {
+	return middleware.NewClientValidator(f.logger, f.Clients())
+}
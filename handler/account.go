@@ -0,0 +1,111 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/gorilla/mux"
+	"github.com/sirupsen/logrus"
+
+	"authservice/constant"
+	"authservice/factory"
+	"authservice/models"
+	"authservice/response"
+)
+
+func DeactivateUser(f factory.Factory, l *logrus.Logger) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		us := f.User()
+		err := us.Deactivate(r.Context(), r.Header.Get("userId"), constant.DeactivatedBySelf)
+		if err != nil {
+			l.Errorf("DeactivateUser: unable to deactivate user: %s", err)
+			response.Error{Error: "unexpected error happened"}.ServerError(w)
+			return
+		}
+
+		response.Success{Success: "account deactivated successfully"}.Send(w)
+	}
+}
+
+// ReactivateUser lets deactivated users restore their account with their credentials, they sign in again afterwards
+func ReactivateUser(f factory.Factory, l *logrus.Logger) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var user models.LoginUser
+		err := json.NewDecoder(r.Body).Decode(&user)
+		if err != nil {
+			l.Errorf("ReactivateUser: invalid request payload: %s", err)
+			response.Error{Error: "invalid request"}.ClientError(w)
+			return
+		}
+
+		if !(user.IsEmailValid() || user.IsPhoneValid()) || !user.IsPasswordValid() {
+			l.Errorf("ReactivateUser: payload should not have empty values")
+			response.Error{Error: "invalid request"}.ClientError(w)
+			return
+		}
+
+		user.LoginType = strings.ToLower(user.LoginType)
+		if user.LoginType == "otp" {
+			l.Errorf("ReactivateUser: reactivation requires a password")
+			response.Error{Error: "invalid request"}.ClientError(w)
+			return
+		}
+
+		us := f.User()
+		err = us.ReactivateWithCredentials(r.Context(), &user)
+		if errors.Is(err, models.ErrReactivationDenied) {
+			l.Errorf("ReactivateUser: %s", err)
+			response.Error{Error: models.ErrReactivationDenied.Error()}.Forbidden(w)
+			return
+		}
+
+		if err != nil {
+			l.Errorf("ReactivateUser: unable to reactivate user: %s", err)
+			response.Error{Error: "unauthorized"}.UnAuthorized(w)
+			return
+		}
+
+		response.Success{Success: "account reactivated successfully"}.Send(w)
+	}
+}
+
+func SetUserDeactivated(f factory.Factory, l *logrus.Logger, deactivated bool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		vars := mux.Vars(r)
+		userId, ok := vars["userId"]
+		if !ok {
+			l.Errorf("SetUserDeactivated: unable to read 'userId' from path")
+			response.Error{Error: "invalid request"}.ClientError(w)
+			return
+		}
+
+		us := f.User()
+		var err error
+		if deactivated {
+			err = us.Deactivate(r.Context(), userId, constant.DeactivatedByAdmin)
+		} else {
+			err = us.Reactivate(r.Context(), userId)
+		}
+
+		if errors.Is(err, models.ErrUserNotFound) {
+			l.Errorf("SetUserDeactivated: %s", err)
+			response.Error{Error: models.ErrUserNotFound.Error()}.ClientError(w)
+			return
+		}
+
+		if err != nil {
+			l.Errorf("SetUserDeactivated: unable to update user: %s", err)
+			response.Error{Error: "unexpected error happened"}.ServerError(w)
+			return
+		}
+
+		if deactivated {
+			response.Success{Success: "account deactivated successfully"}.Send(w)
+			return
+		}
+
+		response.Success{Success: "account reactivated successfully"}.Send(w)
+	}
+}
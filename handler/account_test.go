@@ -0,0 +1,58 @@
+package handler
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/mux"
+
+	"authservice/constant"
+	"authservice/models"
+	"authservice/user"
+)
+
+// recordingUser records who deactivated a user
+type recordingUser struct {
+	user.User
+	deactivatedBy []string
+	reactivateErr error
+}
+
+func (u *recordingUser) Deactivate(ctx context.Context, userId, by string) error {
+	u.deactivatedBy = append(u.deactivatedBy, by)
+	return nil
+}
+
+func (u *recordingUser) ReactivateWithCredentials(ctx context.Context, user *models.LoginUser) error {
+	return u.reactivateErr
+}
+
+func TestAdminDeactivationIsRecordedAsAdmin(t *testing.T) {
+	us := &recordingUser{}
+	r := mux.SetURLVars(httptest.NewRequest(http.MethodPost, "/admin/users/user/deactivate", nil),
+		map[string]string{"userId": "user"})
+	w := httptest.NewRecorder()
+	SetUserDeactivated(&fakeFactory{user: us}, testLogger(), true)(w, r)
+	if w.Code != http.StatusOK {
+		t.Fatalf("status %d", w.Code)
+	}
+
+	if len(us.deactivatedBy) != 1 || us.deactivatedBy[0] != constant.DeactivatedByAdmin {
+		t.Fatalf("deactivated by %v, want admin", us.deactivatedBy)
+	}
+}
+
+func TestReactivateUserRefusesAdminDeactivation(t *testing.T) {
+	us := &recordingUser{reactivateErr: fmt.Errorf("reactivateWithCredentials: %w", models.ErrReactivationDenied)}
+	r := httptest.NewRequest(http.MethodPost, "/users/reactivate",
+		strings.NewReader(`{"email":"user@example.com","password":"Password@123"}`))
+	w := httptest.NewRecorder()
+	ReactivateUser(&fakeFactory{user: us}, testLogger())(w, r)
+	if w.Code != http.StatusForbidden {
+		t.Fatalf("status %d, want %d", w.Code, http.StatusForbidden)
+	}
+}
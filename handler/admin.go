@@ -0,0 +1,108 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/gorilla/mux"
+	"github.com/sirupsen/logrus"
+
+	"authservice/factory"
+	"authservice/models"
+	"authservice/response"
+)
+
+func RotateKeys(f factory.Factory, l *logrus.Logger) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		vars := mux.Vars(r)
+		keyType := vars["keyType"]
+
+		var keyId interface{}
+		switch keyType {
+		case "signing":
+			key, err := f.KeySet().Rotate(r.Context())
+			if err != nil {
+				l.Errorf("RotateKeys: unable to rotate signing key: %s", err)
+				response.Error{Error: "unexpected error happened"}.ServerError(w)
+				return
+			}
+
+			keyId = key.Id
+		case "refresh":
+			version, err := f.SecretSet().Rotate(r.Context())
+			if err != nil {
+				l.Errorf("RotateKeys: unable to rotate refresh secret: %s", err)
+				response.Error{Error: "unexpected error happened"}.ServerError(w)
+				return
+			}
+
+			keyId = version
+		default:
+			l.Errorf("RotateKeys: unknown key type '%s'", keyType)
+			response.Error{Error: "invalid request"}.ClientError(w)
+			return
+		}
+
+		l.Infof("RotateKeys: rotated %s key, new key id: %v", keyType, keyId)
+		response.Success{Success: map[string]interface{}{"type": keyType, "id": keyId}}.Send(w)
+	}
+}
+
+func SetSessionPolicy(f factory.Factory, l *logrus.Logger) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		vars := mux.Vars(r)
+		userId, ok := vars["userId"]
+		if !ok {
+			l.Errorf("SetSessionPolicy: unable to read 'userId' from path")
+			response.Error{Error: "invalid request"}.ClientError(w)
+			return
+		}
+
+		var policy models.SessionPolicy
+		err := json.NewDecoder(r.Body).Decode(&policy)
+		if err != nil {
+			l.Errorf("SetSessionPolicy: unable to decode payload: %s", err)
+			response.Error{Error: "invalid request payload"}.ClientError(w)
+			return
+		}
+
+		err = policy.Validate()
+		if err != nil {
+			l.Errorf("SetSessionPolicy: invalid session policy: %s", err)
+			response.Error{Error: err.Error()}.ClientError(w)
+			return
+		}
+
+		authorizer := f.Authorizer()
+		err = authorizer.SetSessionPolicy(r.Context(), userId, &policy)
+		if err != nil {
+			l.Errorf("SetSessionPolicy: unable to set session policy: %s", err)
+			response.Error{Error: "unexpected error happened"}.ServerError(w)
+			return
+		}
+
+		response.Success{Success: policy}.Send(w)
+	}
+}
+
+func DeleteSessionPolicy(f factory.Factory, l *logrus.Logger) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		vars := mux.Vars(r)
+		userId, ok := vars["userId"]
+		if !ok {
+			l.Errorf("DeleteSessionPolicy: unable to read 'userId' from path")
+			response.Error{Error: "invalid request"}.ClientError(w)
+			return
+		}
+
+		authorizer := f.Authorizer()
+		err := authorizer.SetSessionPolicy(r.Context(), userId, nil)
+		if err != nil {
+			l.Errorf("DeleteSessionPolicy: unable to remove session policy: %s", err)
+			response.Error{Error: "unexpected error happened"}.ServerError(w)
+			return
+		}
+
+		response.Success{Success: "session policy removed successfully"}.Send(w)
+	}
+}
@@ -2,6 +2,7 @@ package handler
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
 	"strings"
@@ -9,6 +10,7 @@ import (
 	"github.com/gorilla/mux"
 	"github.com/sirupsen/logrus"
 
+	"authservice/constant"
 	"authservice/factory"
 	"authservice/models"
 	"authservice/response"
@@ -30,6 +32,12 @@ func LoginUser(f factory.Factory, l *logrus.Logger) http.HandlerFunc {
 			return
 		}
 
+		if _, ok := f.Clients().Get(user.ClientId); user.ClientId != "" && !ok {
+			l.Errorf("LoginUser: unknown client '%s'", user.ClientId)
+			response.Error{Error: "invalid request"}.ClientError(w)
+			return
+		}
+
 		user.LoginType = strings.ToLower(user.LoginType)
 		if user.LoginType != "otp"{
 			if !user.IsPasswordValid() {
@@ -40,13 +48,56 @@ func LoginUser(f factory.Factory, l *logrus.Logger) http.HandlerFunc {
 		}
 
 		us := f.User()
+		user.Device = getDeviceInfo(r, user.DeviceName)
 		var res interface{}
 		if user.LoginType == "otp" {
-			res, err = us.LoginWithOTP(r.Context(), &user)
+			res, err = us.SendOTP(r.Context(), constant.PurposeOTPLogin, &user)
 		} else {
 			res, err = us.Login(r.Context(), &user)
 		}
 
+		if errors.Is(err, models.ErrInvalidCredentials) {
+			l.Errorf("LoginUser: unable to login user: %s", err)
+			response.Error{Error: models.ErrInvalidCredentials.Error()}.UnAuthorized(w)
+			return
+		}
+
+		if errors.Is(err, models.ErrAccountDeactivated) {
+			l.Errorf("LoginUser: unable to login user: %s", err)
+			response.Error{Error: models.ErrAccountDeactivated.Error()}.Forbidden(w)
+			return
+		}
+
+		if errors.Is(err, models.ErrEmailNotVerified) {
+			l.Errorf("LoginUser: unable to login user: %s", err)
+			response.Error{Error: models.ErrEmailNotVerified.Error()}.Forbidden(w)
+			return
+		}
+
+		if errors.Is(err, models.ErrPhoneNotSet) {
+			l.Errorf("LoginUser: unable to send OTP: %s", err)
+			response.Error{Error: models.ErrPhoneNotSet.Error()}.ClientError(w)
+			return
+		}
+
+		if errors.Is(err, models.ErrOTPResendCooldown) {
+			l.Errorf("LoginUser: unable to send OTP: %s", err)
+			response.Error{Error: models.ErrOTPResendCooldown.Error()}.TooManyRequests(w)
+			return
+		}
+
+		if errors.Is(err, models.ErrOTPDailyLimit) {
+			l.Errorf("LoginUser: unable to send OTP: %s", err)
+			response.Error{Error: models.ErrOTPDailyLimit.Error()}.TooManyRequests(w)
+			return
+		}
+
+		if errors.Is(err, models.ErrSessionLimitReached) {
+			l.Errorf("LoginUser: unable to login user: %s", err)
+			response.Error{Error: models.ErrSessionLimitReached.Error()}.Conflict(w)
+			return
+		}
+
 		if err != nil {
 			l.Errorf("LoginUser: unable to login user: %s", err)
 			response.Error{Error: "unexpected error happened"}.ServerError(w)
@@ -67,15 +118,26 @@ func VerifyOTP(f factory.Factory, l *logrus.Logger, isLogin bool) http.HandlerFu
 			return
 		}
 
+		purpose := constant.PurposePasswordReset
+		if isLogin {
+			purpose = constant.PurposeOTPLogin
+		}
+
 		usr := f.User()
-		valid, err := usr.VerifyOTP(r.Context(), &user)
+		otp, err := usr.VerifyOTP(r.Context(), purpose, &user)
+		if errors.Is(err, models.ErrTooManyAttempts) {
+			l.Errorf("VerifyOTP: unable to verify OTP: %s", err)
+			response.Error{Error: models.ErrTooManyAttempts.Error()}.TooManyRequests(w)
+			return
+		}
+
 		if err != nil  {
 			l.Errorf("VerifyOTP: unable to verify OTP: %s", err)
 			response.Error{Error: "unexpected error happened"}.ServerError(w)
 			return
 		}
 
-		if !valid {
+		if otp == nil {
 			l.Errorf("VerifyOTP: unable to verify OTP: Invalid OTP")
 			response.Error{Error: "invalid request"}.ClientError(w)
 			return
@@ -84,9 +146,29 @@ func VerifyOTP(f factory.Factory, l *logrus.Logger, isLogin bool) http.HandlerFu
 		var res interface{}
 		if isLogin {
 			user.LoginType = "otp"
+			user.UserId = otp.UserId
+			user.Device = getDeviceInfo(r, user.DeviceName)
 			res, err = usr.Login(r.Context(), &user)
 		} else {
-			res, err = usr.GetResetSecret(r.Context(), user.Phone)
+			res, err = usr.GetResetSecret(r.Context(), otp.UserId)
+		}
+
+		if errors.Is(err, models.ErrAccountDeactivated) {
+			l.Errorf("VerifyOTP: unable to login user: %s", err)
+			response.Error{Error: models.ErrAccountDeactivated.Error()}.Forbidden(w)
+			return
+		}
+
+		if errors.Is(err, models.ErrEmailNotVerified) {
+			l.Errorf("VerifyOTP: unable to login user: %s", err)
+			response.Error{Error: models.ErrEmailNotVerified.Error()}.Forbidden(w)
+			return
+		}
+
+		if errors.Is(err, models.ErrSessionLimitReached) {
+			l.Errorf("VerifyOTP: unable to login user: %s", err)
+			response.Error{Error: models.ErrSessionLimitReached.Error()}.Conflict(w)
+			return
 		}
 
 		if err != nil {
@@ -130,6 +212,12 @@ func RegisterUser(f factory.Factory, l *logrus.Logger) http.HandlerFunc {
 		}
 
 		res, err := us.Register(r.Context(), &user)
+		if errors.Is(err, models.ErrUserExists) {
+			l.Errorf("RegisterUser: unable to register user: %s", err)
+			response.Error{Error: models.ErrUserExists.Error()}.Conflict(w)
+			return
+		}
+
 		if err != nil {
 			l.Errorf("RegisterUser: unable to register user: %s", err)
 			response.Error{Error: "unexpected error happened"}.ServerError(w)
@@ -237,7 +325,31 @@ func ResetPassword(f factory.Factory, l *logrus.Logger) http.HandlerFunc {
 		}
 
 		user := f.User()
-		nonce, err := user.LoginWithOTP(r.Context(), &resetUser)
+		nonce, err := user.SendOTP(r.Context(), constant.PurposePasswordReset, &resetUser)
+		if errors.Is(err, models.ErrAccountDeactivated) {
+			l.Errorf("ResetPassword: unable to reset password: %s", err)
+			response.Error{Error: models.ErrAccountDeactivated.Error()}.Forbidden(w)
+			return
+		}
+
+		if errors.Is(err, models.ErrPhoneNotSet) {
+			l.Errorf("ResetPassword: unable to send OTP: %s", err)
+			response.Error{Error: models.ErrPhoneNotSet.Error()}.ClientError(w)
+			return
+		}
+
+		if errors.Is(err, models.ErrOTPResendCooldown) {
+			l.Errorf("ResetPassword: unable to send OTP: %s", err)
+			response.Error{Error: models.ErrOTPResendCooldown.Error()}.TooManyRequests(w)
+			return
+		}
+
+		if errors.Is(err, models.ErrOTPDailyLimit) {
+			l.Errorf("ResetPassword: unable to send OTP: %s", err)
+			response.Error{Error: models.ErrOTPDailyLimit.Error()}.TooManyRequests(w)
+			return
+		}
+
 		if err != nil {
 			l.Errorf("ResetPassword: unable to reset password: %s", err)
 			response.Error{Error: "unexpected error happened"}.ServerError(w)
@@ -298,21 +410,27 @@ func RefreshToken(f factory.Factory, l *logrus.Logger) http.HandlerFunc {
 
 		ctx := r.Context()
 		authorizer := f.Authorizer()
-		claims, err := authorizer.ValidateRefreshToken(ctx, user.RefreshToken)
+		refreshMeta, err := authorizer.ValidateRefreshToken(ctx, user.RefreshToken)
+		if errors.Is(err, models.ErrAccountDeactivated) {
+			l.Errorf("RefreshToken: invalid refresh token: %s", err)
+			response.Error{Error: models.ErrAccountDeactivated.Error()}.Forbidden(w)
+			return
+		}
+
 		if err != nil {
 			l.Errorf("RefreshToken: invalid refresh token: %s", err)
 			response.Error{Error: "unauthorized"}.UnAuthorized(w)
 			return
 		}
 
-		token, err := authorizer.GetJWT(ctx, claims, bearerToken, user.RefreshToken)
+		tokens, err := authorizer.RefreshTokens(ctx, refreshMeta, bearerToken, user.RefreshToken)
 		if err != nil {
-			l.Errorf("RefreshToken: unable to generate bearer token: %s", err)
+			l.Errorf("RefreshToken: unable to generate tokens: %s", err)
 			response.Error{Error: "unexpected error happened"}.ServerError(w)
 			return
 		}
 
-		response.Success{Success: token}.Send(w)
+		response.Success{Success: tokens}.Send(w)
 	}
 }
 
@@ -0,0 +1,25 @@
+package handler
+
+import (
+	"net"
+	"net/http"
+	"strings"
+
+	"authservice/models"
+)
+
+// getDeviceInfo describes the device a login request came from, the forwarded address is only informational
+func getDeviceInfo(r *http.Request, name string) models.DeviceInfo {
+	ip := r.RemoteAddr
+	if forwarded := r.Header.Get("X-Forwarded-For"); forwarded != "" {
+		ip = strings.TrimSpace(strings.Split(forwarded, ",")[0])
+	} else if host, _, err := net.SplitHostPort(r.RemoteAddr); err == nil {
+		ip = host
+	}
+
+	return models.DeviceInfo{
+		IP:        ip,
+		UserAgent: r.UserAgent(),
+		Name:      name,
+	}
+}
@@ -0,0 +1,38 @@
+package handler
+
+import (
+	"io"
+
+	"github.com/sirupsen/logrus"
+
+	"authservice/auth"
+	"authservice/factory"
+	"authservice/provider"
+	"authservice/user"
+)
+
+// fakeFactory serves the services a test sets, calling any other one panics
+type fakeFactory struct {
+	factory.Factory
+	user       user.User
+	authorizer auth.Authorizer
+	providers  provider.Registry
+}
+
+func (f *fakeFactory) User() user.User {
+	return f.user
+}
+
+func (f *fakeFactory) Authorizer() auth.Authorizer {
+	return f.authorizer
+}
+
+func (f *fakeFactory) Providers() provider.Registry {
+	return f.providers
+}
+
+func testLogger() *logrus.Logger {
+	l := logrus.New()
+	l.SetOutput(io.Discard)
+	return l
+}
@@ -0,0 +1,85 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/gorilla/mux"
+	"github.com/sirupsen/logrus"
+
+	"authservice/factory"
+	"authservice/models"
+	"authservice/response"
+)
+
+func ListIdentities(f factory.Factory, l *logrus.Logger) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		identities, err := f.Identity().List(r.Context(), r.Header.Get("userId"))
+		if err != nil {
+			l.Errorf("ListIdentities: unable to list identities: %s", err)
+			response.Error{Error: "unexpected error happened"}.ServerError(w)
+			return
+		}
+
+		response.Success{Success: identities}.Send(w)
+	}
+}
+
+// LinkIdentity links the provider account of a link token, handed out by the OAuth callback, to the signed in user
+func LinkIdentity(f factory.Factory, l *logrus.Logger) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var req models.IdentityLinkRequest
+		err := json.NewDecoder(r.Body).Decode(&req)
+		if err != nil || req.Token == "" {
+			l.Errorf("LinkIdentity: invalid request payload: %v", err)
+			response.Error{Error: "invalid request"}.ClientError(w)
+			return
+		}
+
+		userId := r.Header.Get("userId")
+		err = f.Identity().Link(r.Context(), userId, req.Token)
+		switch {
+		case errors.Is(err, models.ErrInvalidIdentityLink):
+			l.Errorf("LinkIdentity: %s", err)
+			response.Error{Error: models.ErrInvalidIdentityLink.Error()}.ClientError(w)
+			return
+		case errors.Is(err, models.ErrIdentityInUse):
+			l.Errorf("LinkIdentity: %s", err)
+			response.Error{Error: models.ErrIdentityInUse.Error()}.Conflict(w)
+			return
+		case err != nil:
+			l.Errorf("LinkIdentity: unable to link identity: %s", err)
+			response.Error{Error: "unexpected error happened"}.ServerError(w)
+			return
+		}
+
+		identities, err := f.Identity().List(r.Context(), userId)
+		if err != nil {
+			l.Errorf("LinkIdentity: unable to list identities: %s", err)
+			response.Error{Error: "unexpected error happened"}.ServerError(w)
+			return
+		}
+
+		response.Success{Success: identities}.Send(w)
+	}
+}
+
+func UnlinkIdentity(f factory.Factory, l *logrus.Logger) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		err := f.Identity().Unlink(r.Context(), r.Header.Get("userId"), mux.Vars(r)["identityId"])
+		switch {
+		case err == nil:
+			response.Success{Success: "account unlinked"}.Send(w)
+		case errors.Is(err, models.ErrIdentityNotFound):
+			l.Errorf("UnlinkIdentity: %s", err)
+			response.Error{Error: models.ErrIdentityNotFound.Error()}.NotFound(w)
+		case errors.Is(err, models.ErrLastSignInMethod):
+			l.Errorf("UnlinkIdentity: %s", err)
+			response.Error{Error: models.ErrLastSignInMethod.Error()}.Conflict(w)
+		default:
+			l.Errorf("UnlinkIdentity: unable to unlink identity: %s", err)
+			response.Error{Error: "unexpected error happened"}.ServerError(w)
+		}
+	}
+}
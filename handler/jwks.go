@@ -0,0 +1,15 @@
+package handler
+
+import (
+	"net/http"
+
+	"authservice/factory"
+	"authservice/response"
+)
+
+func JWKS(f factory.Factory) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Cache-Control", "public, max-age=300")
+		response.Raw{Body: f.KeySet().JWKS()}.Send(w)
+	}
+}
@@ -0,0 +1,82 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/sirupsen/logrus"
+
+	"authservice/factory"
+	"authservice/models"
+	"authservice/response"
+)
+
+func SendMagicLink(f factory.Factory, l *logrus.Logger) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var req models.MagicLinkRequest
+		err := json.NewDecoder(r.Body).Decode(&req)
+		if err != nil || !req.IsEmailValid() {
+			l.Errorf("SendMagicLink: invalid request payload: %v", err)
+			response.Error{Error: "invalid request"}.ClientError(w)
+			return
+		}
+
+		if _, ok := f.Clients().Get(req.ClientId); req.ClientId != "" && !ok {
+			l.Errorf("SendMagicLink: unknown client '%s'", req.ClientId)
+			response.Error{Error: "invalid request"}.ClientError(w)
+			return
+		}
+
+		err = f.User().SendMagicLink(r.Context(), &req)
+		switch {
+		case err == nil, errors.Is(err, models.ErrUserNotFound), errors.Is(err, models.ErrAccountDeactivated):
+			// unknown and deactivated accounts get the same answer so that the endpoint cannot be used to find accounts
+			if err != nil {
+				l.Errorf("SendMagicLink: %s", err)
+			}
+
+			response.Success{Success: "login link sent"}.Send(w)
+		case errors.Is(err, models.ErrOTPResendCooldown):
+			l.Errorf("SendMagicLink: %s", err)
+			response.Error{Error: models.ErrOTPResendCooldown.Error()}.TooManyRequests(w)
+		case errors.Is(err, models.ErrOTPDailyLimit):
+			l.Errorf("SendMagicLink: %s", err)
+			response.Error{Error: models.ErrOTPDailyLimit.Error()}.TooManyRequests(w)
+		default:
+			l.Errorf("SendMagicLink: unable to send login link: %s", err)
+			response.Error{Error: "unexpected error happened"}.ServerError(w)
+		}
+	}
+}
+
+func MagicLinkLogin(f factory.Factory, l *logrus.Logger) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var req models.MagicLinkLogin
+		err := json.NewDecoder(r.Body).Decode(&req)
+		if err != nil || req.Token == "" {
+			l.Errorf("MagicLinkLogin: invalid request payload: %v", err)
+			response.Error{Error: "invalid request"}.ClientError(w)
+			return
+		}
+
+		req.Device = getDeviceInfo(r, req.DeviceName)
+		res, err := f.User().LoginWithMagicLink(r.Context(), &req)
+		switch {
+		case err == nil:
+			response.Success{Success: res}.Send(w)
+		case errors.Is(err, models.ErrInvalidMagicLink):
+			l.Errorf("MagicLinkLogin: unable to login user: %s", err)
+			response.Error{Error: models.ErrInvalidMagicLink.Error()}.UnAuthorized(w)
+		case errors.Is(err, models.ErrAccountDeactivated):
+			l.Errorf("MagicLinkLogin: unable to login user: %s", err)
+			response.Error{Error: models.ErrAccountDeactivated.Error()}.Forbidden(w)
+		case errors.Is(err, models.ErrSessionLimitReached):
+			l.Errorf("MagicLinkLogin: unable to login user: %s", err)
+			response.Error{Error: models.ErrSessionLimitReached.Error()}.Conflict(w)
+		default:
+			l.Errorf("MagicLinkLogin: unable to login user: %s", err)
+			response.Error{Error: "unexpected error happened"}.ServerError(w)
+		}
+	}
+}
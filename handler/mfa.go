@@ -0,0 +1,157 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/sirupsen/logrus"
+
+	"authservice/factory"
+	"authservice/models"
+	"authservice/response"
+)
+
+func EnrollTOTP(f factory.Factory, l *logrus.Logger) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userId := r.Header.Get("userId")
+		exists, user, err := f.User().GetUser(r.Context(), userId, "", "")
+		if err != nil || !exists {
+			l.Errorf("EnrollTOTP: unable to get user: %v", err)
+			response.Error{Error: "unexpected error happened"}.ServerError(w)
+			return
+		}
+
+		account := user.GetEmail()
+		if account == "" {
+			account = user.GetPhone()
+		}
+
+		enrollment, err := f.MFA().EnrollTOTP(r.Context(), userId, account)
+		if errors.Is(err, models.ErrMFAAlreadyEnabled) {
+			l.Errorf("EnrollTOTP: %s", err)
+			response.Error{Error: models.ErrMFAAlreadyEnabled.Error()}.Conflict(w)
+			return
+		}
+
+		if err != nil {
+			l.Errorf("EnrollTOTP: unable to enroll TOTP: %s", err)
+			response.Error{Error: "unexpected error happened"}.ServerError(w)
+			return
+		}
+
+		response.Success{Success: enrollment}.Send(w)
+	}
+}
+
+// ConfirmTOTP enables TOTP with a code from the authenticator, the recovery codes are only ever shown in its response
+func ConfirmTOTP(f factory.Factory, l *logrus.Logger) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var req models.MFACode
+		err := json.NewDecoder(r.Body).Decode(&req)
+		if err != nil || req.Code == "" {
+			l.Errorf("ConfirmTOTP: invalid request payload: %v", err)
+			response.Error{Error: "invalid request"}.ClientError(w)
+			return
+		}
+
+		codes, err := f.MFA().ConfirmTOTP(r.Context(), r.Header.Get("userId"), req.Code)
+		if err != nil {
+			l.Errorf("ConfirmTOTP: unable to confirm TOTP: %s", err)
+			sendMFAError(w, err)
+			return
+		}
+
+		response.Success{Success: codes}.Send(w)
+	}
+}
+
+func DisableTOTP(f factory.Factory, l *logrus.Logger) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var req models.MFACode
+		err := json.NewDecoder(r.Body).Decode(&req)
+		if err != nil || req.Code == "" {
+			l.Errorf("DisableTOTP: invalid request payload: %v", err)
+			response.Error{Error: "invalid request"}.ClientError(w)
+			return
+		}
+
+		err = f.MFA().DisableTOTP(r.Context(), r.Header.Get("userId"), req.Code)
+		if err != nil {
+			l.Errorf("DisableTOTP: unable to disable TOTP: %s", err)
+			sendMFAError(w, err)
+			return
+		}
+
+		response.Success{Success: "two-factor authentication disabled"}.Send(w)
+	}
+}
+
+func RegenerateRecoveryCodes(f factory.Factory, l *logrus.Logger) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var req models.MFACode
+		err := json.NewDecoder(r.Body).Decode(&req)
+		if err != nil || req.Code == "" {
+			l.Errorf("RegenerateRecoveryCodes: invalid request payload: %v", err)
+			response.Error{Error: "invalid request"}.ClientError(w)
+			return
+		}
+
+		codes, err := f.MFA().RegenerateRecoveryCodes(r.Context(), r.Header.Get("userId"), req.Code)
+		if err != nil {
+			l.Errorf("RegenerateRecoveryCodes: unable to regenerate recovery codes: %s", err)
+			sendMFAError(w, err)
+			return
+		}
+
+		response.Success{Success: codes}.Send(w)
+	}
+}
+
+// CompleteMFALogin exchanges the challenge returned by LoginUser and a TOTP code, recovery code or passkey for the session
+func CompleteMFALogin(f factory.Factory, l *logrus.Logger) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var req models.MFALogin
+		err := json.NewDecoder(r.Body).Decode(&req)
+		if err != nil || req.ChallengeToken == "" || (req.Code == "" && req.Passkey == nil) {
+			l.Errorf("CompleteMFALogin: invalid request payload: %v", err)
+			response.Error{Error: "invalid request"}.ClientError(w)
+			return
+		}
+
+		req.Device = getDeviceInfo(r, req.DeviceName)
+		res, err := f.User().CompleteMFALogin(r.Context(), &req)
+		switch {
+		case err == nil:
+			response.Success{Success: res}.Send(w)
+		case errors.Is(err, models.ErrInvalidMFAChallenge), errors.Is(err, models.ErrInvalidMFACode),
+			errors.Is(err, models.ErrInvalidPasskey):
+			l.Errorf("CompleteMFALogin: unable to login user: %s", err)
+			response.Error{Error: "unauthorized"}.UnAuthorized(w)
+		case errors.Is(err, models.ErrAccountDeactivated):
+			l.Errorf("CompleteMFALogin: unable to login user: %s", err)
+			response.Error{Error: models.ErrAccountDeactivated.Error()}.Forbidden(w)
+		case errors.Is(err, models.ErrSessionLimitReached):
+			l.Errorf("CompleteMFALogin: unable to login user: %s", err)
+			response.Error{Error: models.ErrSessionLimitReached.Error()}.Conflict(w)
+		default:
+			l.Errorf("CompleteMFALogin: unable to login user: %s", err)
+			sendMFAError(w, err)
+		}
+	}
+}
+
+func sendMFAError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, models.ErrInvalidMFACode):
+		response.Error{Error: models.ErrInvalidMFACode.Error()}.ClientError(w)
+	case errors.Is(err, models.ErrMFANotEnrolled):
+		response.Error{Error: models.ErrMFANotEnrolled.Error()}.ClientError(w)
+	case errors.Is(err, models.ErrMFAAlreadyEnabled):
+		response.Error{Error: models.ErrMFAAlreadyEnabled.Error()}.Conflict(w)
+	case errors.Is(err, models.ErrTooManyAttempts):
+		response.Error{Error: models.ErrTooManyAttempts.Error()}.TooManyRequests(w)
+	default:
+		response.Error{Error: "unexpected error happened"}.ServerError(w)
+	}
+}
@@ -1,37 +1,23 @@
 package handler
 
 import (
+	"errors"
 	"net/http"
-	"time"
+	"net/url"
 
-	"github.com/gorilla/sessions"
-	"github.com/markbates/goth"
-	"github.com/markbates/goth/gothic"
-	"github.com/markbates/goth/providers/google"
+	"github.com/gorilla/mux"
 	"github.com/sirupsen/logrus"
 
+	"authservice/constant"
 	"authservice/factory"
 	"authservice/models"
 	"authservice/response"
 )
 
-func InitProviders(f factory.Factory) {
-	providers := make([]goth.Provider, 0)
-	callbackUrl := "http://localhost:9003/user/callback"
-	for _, provider := range f.Config().ProvidersConf {
-		switch provider.Name {
-		case "google":
-			pr := google.New(provider.ClientId, provider.ClientSecret, callbackUrl, "email", "profile")
-			providers = append(providers, pr)
-		}
-	}
-
-	goth.UseProviders(providers...)
-}
-
-func Logout(l *logrus.Logger) http.HandlerFunc {
+// Logout drops an OAuth sign in the browser did not finish
+func Logout(f factory.Factory, l *logrus.Logger) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		err := gothic.Logout(w, r)
+		err := f.Providers().Clear(w, r)
 		if err != nil {
 			l.Errorf("Logout: unable to logout user: %s", err)
 			response.Error{Error: "unexpected error happened"}.ServerError(w)
@@ -42,44 +28,166 @@ func Logout(l *logrus.Logger) http.HandlerFunc {
 	}
 }
 
-func OAuth() http.HandlerFunc {
+// OAuth sends the browser to the provider, intent=link asks for a link token instead of a sign in
+func OAuth(f factory.Factory, l *logrus.Logger) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		key := time.Now().String()
-		maxAge := 1 * 30
-		store := sessions.NewCookieStore([]byte(key))
-		store.MaxAge(maxAge)
-		store.Options.Path = "/"
-		store.Options.HttpOnly = true // HttpOnly should always be enabled
-		store.Options.Secure = false
-		gothic.Store = store
-		w.Header().Set("Content-Type", "application/json; charset=utf-8")
-		gothic.BeginAuthHandler(w, r)
+		query := r.URL.Query()
+		flow := &models.OAuthFlow{Provider: mux.Vars(r)["provider"]}
+		if query.Get("intent") == constant.IntentLink {
+			flow.Intent = constant.IntentLink
+		}
+
+		redirectURI := query.Get("redirect_uri")
+		c, found := f.Clients().Get(query.Get("client_id"))
+		if !found || !c.AllowsRedirect(redirectURI) {
+			l.Errorf("OAuth: %s: client '%s', uri '%s'", models.ErrInvalidRedirectURI, query.Get("client_id"), redirectURI)
+			response.Error{Error: models.ErrInvalidRedirectURI.Error()}.ClientError(w)
+			return
+		}
+
+		if query.Get("code_challenge") == "" || query.Get("code_challenge_method") != "S256" {
+			l.Errorf("OAuth: invalid request: S256 code challenge is not present")
+			response.Error{Error: "invalid request"}.ClientError(w)
+			return
+		}
+
+		flow.ClientId = c.Id
+		flow.RedirectURI = redirectURI
+		flow.CodeChallenge = query.Get("code_challenge")
+		flow.ClientState = query.Get("state")
+
+		authURL, err := f.Providers().Begin(w, r, flow)
+		if errors.Is(err, models.ErrUnknownProvider) {
+			response.Error{Error: models.ErrUnknownProvider.Error()}.NotFound(w)
+			return
+		}
+
+		if err != nil {
+			l.Errorf("OAuth: unable to begin sign in: %s", err)
+			response.Error{Error: "unexpected error happened"}.ServerError(w)
+			return
+		}
+
+		http.Redirect(w, r, authURL, http.StatusTemporaryRedirect)
 	}
 }
 
 func OAuthCallback(f factory.Factory, l *logrus.Logger) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		gothUser, err := gothic.CompleteUserAuth(w, r)
+		user, flow, err := f.Providers().Complete(w, r)
 		if err != nil {
 			l.Errorf("OAuthCallback: unable to authenticate user: %s", err)
 			response.Error{Error: "unauthorized"}.UnAuthorized(w)
 			return
 		}
 
-		user := models.User{
-			Email:      &gothUser.Email,
-			LastName:   &gothUser.LastName,
-			FirstName:  &gothUser.FirstName,
+		if flow.RedirectURI == "" {
+			l.Errorf("OAuthCallback: %s: sign in was started without one", models.ErrInvalidRedirectURI)
+			response.Error{Error: models.ErrInvalidRedirectURI.Error()}.ClientError(w)
+			return
+		}
+
+		var authUser *models.AuthUser
+		if flow.Intent == constant.IntentLink {
+			var link *models.IdentityLink
+			link, err = f.Identity().PendingLink(user)
+			authUser = &models.AuthUser{IdentityLink: link}
+		} else {
+			authUser, err = f.User().OAuthLogin(r.Context(), user, flow.ClientId)
+		}
+
+		redirectOAuth(f, l, w, r, flow, authUser, err)
+	}
+}
+
+// ExchangeCode trades the code an OAuth sign in was handed back with for its outcome (RFC 6749 section 4.1.3)
+func ExchangeCode(f factory.Factory, l *logrus.Logger) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		code, verifier := r.PostFormValue("code"), r.PostFormValue("code_verifier")
+		if r.PostFormValue("grant_type") != "authorization_code" || code == "" || verifier == "" {
+			l.Errorf("ExchangeCode: invalid request: grant type, code or verifier is not present")
+			response.Error{Error: "invalid_request"}.ClientError(w)
+			return
+		}
+
+		clientId := r.Header.Get("clientId")
+		res, err := f.Authorizer().ExchangeCode(r.Context(), code, clientId, r.PostFormValue("redirect_uri"), verifier,
+			f.User().StartSession)
+		if errors.Is(err, models.ErrInvalidGrant) || isOAuthError(err) {
+			l.Errorf("ExchangeCode: %s", err)
+			response.Error{Error: "invalid_grant"}.ClientError(w)
+			return
 		}
 
-		us := f.User()
-		authUser, err := us.OAuthLogin(r.Context(), user)
 		if err != nil {
-			l.Errorf("OAuthCallback: unable to save user info: %s", err)
-			response.Error{Error: "unexpected error happened"}.ServerError(w)
+			l.Errorf("ExchangeCode: unable to exchange code: %s", err)
+			response.Error{Error: "server_error"}.ServerError(w)
 			return
 		}
 
-		response.Success{Success: authUser}.Send(w)
+		w.Header().Set("Cache-Control", "no-store")
+		response.Raw{Body: res}.Send(w)
+	}
+}
+
+// redirectOAuth hands the outcome of a sign in back to the client's redirect URI, as a one-time code or an error
+func redirectOAuth(f factory.Factory, l *logrus.Logger, w http.ResponseWriter, r *http.Request, flow *models.OAuthFlow,
+	authUser *models.AuthUser, err error) {
+	params := url.Values{}
+	if flow.ClientState != "" {
+		params.Set("state", flow.ClientState)
+	}
+
+	if err == nil {
+		grant := &models.AuthorizationGrant{
+			ClientId:      flow.ClientId,
+			RedirectURI:   flow.RedirectURI,
+			CodeChallenge: flow.CodeChallenge,
+			Device:        getDeviceInfo(r, ""),
+		}
+		if authUser.User != nil {
+			grant.UserId = authUser.User.GetId()
+		} else {
+			grant.AuthUser = authUser
+		}
+
+		var code string
+		code, err = f.Authorizer().IssueCode(r.Context(), grant)
+		params.Set("code", code)
+	}
+
+	if err != nil {
+		l.Errorf("OAuthCallback: unable to login user: %s", err)
+		params.Del("code")
+		params.Set("error", "server_error")
+		for _, e := range oauthErrors {
+			if errors.Is(err, e) {
+				params.Set("error", "access_denied")
+				params.Set("error_description", e.Error())
+			}
+		}
+	}
+
+	target, _ := url.Parse(flow.RedirectURI)
+	query := target.Query()
+	for key := range params {
+		query.Set(key, params.Get(key))
 	}
+
+	target.RawQuery = query.Encode()
+	http.Redirect(w, r, target.String(), http.StatusFound)
+}
+
+// oauthErrors are the reasons a sign in with a provider is refused, anything else is a server error
+var oauthErrors = []error{models.ErrOAuthEmailMissing, models.ErrIdentityInUse, models.ErrEmailNotVerified,
+	models.ErrAccountDeactivated, models.ErrSessionLimitReached}
+
+func isOAuthError(err error) bool {
+	for _, e := range oauthErrors {
+		if errors.Is(err, e) {
+			return true
+		}
+	}
+
+	return false
 }
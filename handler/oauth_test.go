@@ -0,0 +1,89 @@
+package handler
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"authservice/auth"
+	"authservice/models"
+	"authservice/provider"
+	"authservice/user"
+)
+
+// completedProviders completes every callback with the given flow
+type completedProviders struct {
+	provider.Registry
+	flow *models.OAuthFlow
+}
+
+func (p *completedProviders) Complete(w http.ResponseWriter, r *http.Request) (*models.OAuthUser, *models.OAuthFlow, error) {
+	return &models.OAuthUser{Provider: "oidc", Subject: "subject"}, p.flow, nil
+}
+
+// signingInUser signs every provider account in as "user" and counts the sign ins and sessions
+type signingInUser struct {
+	user.User
+	logins   int
+	sessions int
+}
+
+func (u *signingInUser) OAuthLogin(ctx context.Context, oauthUser *models.OAuthUser, clientId string) (*models.AuthUser, error) {
+	u.logins++
+	id := "user"
+	return &models.AuthUser{User: &models.User{Id: &id}}, nil
+}
+
+func (u *signingInUser) StartSession(ctx context.Context, userId, clientId string, device models.DeviceInfo) (*models.AuthUser, error) {
+	u.sessions++
+	return &models.AuthUser{BearerToken: "bearer", RefreshToken: "refresh"}, nil
+}
+
+// grantAuthorizer records the grants codes were issued for
+type grantAuthorizer struct {
+	auth.Authorizer
+	grants []*models.AuthorizationGrant
+}
+
+func (a *grantAuthorizer) IssueCode(ctx context.Context, grant *models.AuthorizationGrant) (string, error) {
+	a.grants = append(a.grants, grant)
+	return "code", nil
+}
+
+func TestOAuthCallbackWithoutRedirectURISendsNoTokens(t *testing.T) {
+	us := &signingInUser{}
+	authorizer := &grantAuthorizer{}
+	f := &fakeFactory{user: us, authorizer: authorizer, providers: &completedProviders{flow: &models.OAuthFlow{}}}
+	w := httptest.NewRecorder()
+	OAuthCallback(f, testLogger())(w, httptest.NewRequest(http.MethodGet, "/user/callback", nil))
+	if w.Code != http.StatusBadRequest {
+		t.Fatalf("status %d, want %d", w.Code, http.StatusBadRequest)
+	}
+
+	if us.logins != 0 || us.sessions != 0 || len(authorizer.grants) != 0 || strings.Contains(w.Body.String(), "bearer") {
+		t.Fatalf("signed in without a redirect uri: %s", w.Body.String())
+	}
+}
+
+func TestOAuthCallbackLeavesSessionToCodeExchange(t *testing.T) {
+	us := &signingInUser{}
+	authorizer := &grantAuthorizer{}
+	flow := &models.OAuthFlow{ClientId: "app", RedirectURI: "https://app.example.com/callback", CodeChallenge: "challenge",
+		ClientState: "state"}
+	f := &fakeFactory{user: us, authorizer: authorizer, providers: &completedProviders{flow: flow}}
+	w := httptest.NewRecorder()
+	OAuthCallback(f, testLogger())(w, httptest.NewRequest(http.MethodGet, "/user/callback", nil))
+	if w.Code != http.StatusFound || w.Header().Get("Location") != "https://app.example.com/callback?code=code&state=state" {
+		t.Fatalf("status %d, location %s", w.Code, w.Header().Get("Location"))
+	}
+
+	if us.sessions != 0 {
+		t.Fatal("session started before the code was exchanged")
+	}
+
+	if len(authorizer.grants) != 1 || authorizer.grants[0].UserId != "user" || authorizer.grants[0].AuthUser != nil {
+		t.Fatalf("got grants %+v, want one for user without an outcome", authorizer.grants)
+	}
+}
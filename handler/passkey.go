@@ -0,0 +1,182 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/gorilla/mux"
+	"github.com/sirupsen/logrus"
+
+	"authservice/factory"
+	"authservice/models"
+	"authservice/response"
+)
+
+func ListPasskeys(f factory.Factory, l *logrus.Logger) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		passkeys, err := f.Passkey().List(r.Context(), r.Header.Get("userId"))
+		if err != nil {
+			l.Errorf("ListPasskeys: unable to list passkeys: %s", err)
+			response.Error{Error: "unexpected error happened"}.ServerError(w)
+			return
+		}
+
+		response.Success{Success: passkeys}.Send(w)
+	}
+}
+
+func BeginPasskeyRegistration(f factory.Factory, l *logrus.Logger) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		exists, user, err := f.User().GetUser(r.Context(), r.Header.Get("userId"), "", "")
+		if err != nil || !exists {
+			l.Errorf("BeginPasskeyRegistration: unable to get user: %v", err)
+			response.Error{Error: "unexpected error happened"}.ServerError(w)
+			return
+		}
+
+		options, err := f.Passkey().BeginRegistration(r.Context(), user)
+		if err != nil {
+			l.Errorf("BeginPasskeyRegistration: unable to begin registration: %s", err)
+			response.Error{Error: "unexpected error happened"}.ServerError(w)
+			return
+		}
+
+		response.Success{Success: options}.Send(w)
+	}
+}
+
+func FinishPasskeyRegistration(f factory.Factory, l *logrus.Logger) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var req models.PasskeyRegistration
+		err := json.NewDecoder(r.Body).Decode(&req)
+		if err != nil {
+			l.Errorf("FinishPasskeyRegistration: invalid request payload: %s", err)
+			response.Error{Error: "invalid request"}.ClientError(w)
+			return
+		}
+
+		pk, err := f.Passkey().FinishRegistration(r.Context(), r.Header.Get("userId"), &req)
+		if errors.Is(err, models.ErrInvalidPasskey) {
+			l.Errorf("FinishPasskeyRegistration: %s", err)
+			response.Error{Error: models.ErrInvalidPasskey.Error()}.ClientError(w)
+			return
+		}
+
+		if err != nil {
+			l.Errorf("FinishPasskeyRegistration: unable to register passkey: %s", err)
+			response.Error{Error: "unexpected error happened"}.ServerError(w)
+			return
+		}
+
+		response.Success{Success: pk}.Send(w)
+	}
+}
+
+func DeletePasskey(f factory.Factory, l *logrus.Logger) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		err := f.Passkey().Delete(r.Context(), r.Header.Get("userId"), mux.Vars(r)["passkeyId"])
+		if errors.Is(err, models.ErrPasskeyNotFound) {
+			l.Errorf("DeletePasskey: %s", err)
+			response.Error{Error: models.ErrPasskeyNotFound.Error()}.ClientError(w)
+			return
+		}
+
+		if err != nil {
+			l.Errorf("DeletePasskey: unable to delete passkey: %s", err)
+			response.Error{Error: "unexpected error happened"}.ServerError(w)
+			return
+		}
+
+		response.Success{Success: "passkey removed"}.Send(w)
+	}
+}
+
+// BeginPasskeyLogin starts a passwordless login that any passkey discoverable by the browser can answer
+func BeginPasskeyLogin(f factory.Factory, l *logrus.Logger) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		options, err := f.Passkey().BeginLogin(r.Context(), "", false)
+		if err != nil {
+			l.Errorf("BeginPasskeyLogin: unable to begin login: %s", err)
+			response.Error{Error: "unexpected error happened"}.ServerError(w)
+			return
+		}
+
+		response.Success{Success: options}.Send(w)
+	}
+}
+
+func PasskeyLogin(f factory.Factory, l *logrus.Logger) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var req models.PasskeyLogin
+		err := json.NewDecoder(r.Body).Decode(&req)
+		if err != nil || req.SessionId == "" || req.Id == "" {
+			l.Errorf("PasskeyLogin: invalid request payload: %v", err)
+			response.Error{Error: "invalid request"}.ClientError(w)
+			return
+		}
+
+		if _, ok := f.Clients().Get(req.ClientId); req.ClientId != "" && !ok {
+			l.Errorf("PasskeyLogin: unknown client '%s'", req.ClientId)
+			response.Error{Error: "invalid request"}.ClientError(w)
+			return
+		}
+
+		req.Device = getDeviceInfo(r, req.DeviceName)
+		res, err := f.User().LoginWithPasskey(r.Context(), &req)
+		switch {
+		case err == nil:
+			response.Success{Success: res}.Send(w)
+		case errors.Is(err, models.ErrInvalidPasskey):
+			l.Errorf("PasskeyLogin: unable to login user: %s", err)
+			response.Error{Error: "unauthorized"}.UnAuthorized(w)
+		case errors.Is(err, models.ErrAccountDeactivated):
+			l.Errorf("PasskeyLogin: unable to login user: %s", err)
+			response.Error{Error: models.ErrAccountDeactivated.Error()}.Forbidden(w)
+		case errors.Is(err, models.ErrEmailNotVerified):
+			l.Errorf("PasskeyLogin: unable to login user: %s", err)
+			response.Error{Error: models.ErrEmailNotVerified.Error()}.Forbidden(w)
+		case errors.Is(err, models.ErrSessionLimitReached):
+			l.Errorf("PasskeyLogin: unable to login user: %s", err)
+			response.Error{Error: models.ErrSessionLimitReached.Error()}.Conflict(w)
+		default:
+			l.Errorf("PasskeyLogin: unable to login user: %s", err)
+			response.Error{Error: "unexpected error happened"}.ServerError(w)
+		}
+	}
+}
+
+// BeginMFAPasskey starts the passkey ceremony answering an MFA challenge, limited to the passkeys of its user
+func BeginMFAPasskey(f factory.Factory, l *logrus.Logger) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var req models.PasskeyMFAOptions
+		err := json.NewDecoder(r.Body).Decode(&req)
+		if err != nil || req.ChallengeToken == "" {
+			l.Errorf("BeginMFAPasskey: invalid request payload: %v", err)
+			response.Error{Error: "invalid request"}.ClientError(w)
+			return
+		}
+
+		claims, err := f.MFA().ReadChallenge(req.ChallengeToken)
+		if err != nil {
+			l.Errorf("BeginMFAPasskey: %s", err)
+			response.Error{Error: "unauthorized"}.UnAuthorized(w)
+			return
+		}
+
+		options, err := f.Passkey().BeginLogin(r.Context(), claims.UserId, true)
+		if errors.Is(err, models.ErrPasskeyNotFound) {
+			l.Errorf("BeginMFAPasskey: %s", err)
+			response.Error{Error: models.ErrPasskeyNotFound.Error()}.ClientError(w)
+			return
+		}
+
+		if err != nil {
+			l.Errorf("BeginMFAPasskey: unable to begin login: %s", err)
+			response.Error{Error: "unexpected error happened"}.ServerError(w)
+			return
+		}
+
+		response.Success{Success: options}.Send(w)
+	}
+}
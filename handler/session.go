@@ -0,0 +1,47 @@
+package handler
+
+import (
+	"net/http"
+
+	"github.com/gorilla/mux"
+	"github.com/sirupsen/logrus"
+
+	"authservice/factory"
+	"authservice/response"
+)
+
+func GetSessions(f factory.Factory, l *logrus.Logger) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		authorizer := f.Authorizer()
+		res, err := authorizer.GetSessions(r.Context(), r.Header.Get("userId"), r.Header.Get("Authorization"))
+		if err != nil {
+			l.Errorf("GetSessions: unable to get sessions: %s", err)
+			response.Error{Error: "unexpected error happened"}.ServerError(w)
+			return
+		}
+
+		response.Success{Success: res}.Send(w)
+	}
+}
+
+func DeleteSession(f factory.Factory, l *logrus.Logger) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		vars := mux.Vars(r)
+		sessionId, ok := vars["sessionId"]
+		if !ok {
+			l.Errorf("DeleteSession: unable to read 'sessionId' from path")
+			response.Error{Error: "invalid request"}.ClientError(w)
+			return
+		}
+
+		authorizer := f.Authorizer()
+		err := authorizer.RevokeSession(r.Context(), r.Header.Get("userId"), sessionId)
+		if err != nil {
+			l.Errorf("DeleteSession: unable to revoke session: %s", err)
+			response.Error{Error: "unexpected error happened"}.ServerError(w)
+			return
+		}
+
+		response.Success{Success: "session revoked successfully"}.Send(w)
+	}
+}
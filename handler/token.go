@@ -0,0 +1,49 @@
+package handler
+
+import (
+	"net/http"
+
+	"github.com/sirupsen/logrus"
+
+	"authservice/factory"
+	"authservice/response"
+)
+
+func IntrospectToken(f factory.Factory, l *logrus.Logger) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		token := r.PostFormValue("token")
+		if token == "" {
+			l.Errorf("IntrospectToken: invalid request: token is not present")
+			response.Error{Error: "invalid_request"}.ClientError(w)
+			return
+		}
+
+		authorizer := f.Authorizer()
+		res := authorizer.Introspect(r.Context(), token, r.PostFormValue("token_type_hint"))
+
+		w.Header().Set("Cache-Control", "no-store")
+		response.Raw{Body: res}.Send(w)
+	}
+}
+
+func RevokeToken(f factory.Factory, l *logrus.Logger) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		token := r.PostFormValue("token")
+		if token == "" {
+			l.Errorf("RevokeToken: invalid request: token is not present")
+			response.Error{Error: "invalid_request"}.ClientError(w)
+			return
+		}
+
+		authorizer := f.Authorizer()
+		err := authorizer.RevokeToken(r.Context(), token, r.PostFormValue("token_type_hint"), r.Header.Get("clientId"))
+		if err != nil {
+			l.Errorf("RevokeToken: unable to revoke token: %s", err)
+			response.Error{Error: "server_error"}.ServerError(w)
+			return
+		}
+
+		w.Header().Set("Cache-Control", "no-store")
+		response.Raw{Body: struct{}{}}.Send(w)
+	}
+}
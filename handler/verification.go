@@ -0,0 +1,74 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/sirupsen/logrus"
+
+	"authservice/factory"
+	"authservice/models"
+	"authservice/response"
+)
+
+func VerifyEmail(f factory.Factory, l *logrus.Logger) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var req models.VerifyEmailRequest
+		err := json.NewDecoder(r.Body).Decode(&req)
+		if err != nil || req.Token == "" {
+			l.Errorf("VerifyEmail: invalid request payload: %v", err)
+			response.Error{Error: "invalid request"}.ClientError(w)
+			return
+		}
+
+		us := f.User()
+		user, err := us.VerifyEmail(r.Context(), req.Token)
+		if errors.Is(err, models.ErrInvalidVerificationToken) {
+			l.Errorf("VerifyEmail: unable to verify email: %s", err)
+			response.Error{Error: models.ErrInvalidVerificationToken.Error()}.ClientError(w)
+			return
+		}
+
+		if err != nil {
+			l.Errorf("VerifyEmail: unable to verify email: %s", err)
+			response.Error{Error: "unexpected error happened"}.ServerError(w)
+			return
+		}
+
+		response.Success{Success: user}.Send(w)
+	}
+}
+
+func ResendVerificationEmail(f factory.Factory, l *logrus.Logger) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var req models.VerifyEmailRequest
+		err := json.NewDecoder(r.Body).Decode(&req)
+		if err != nil || req.Email == "" {
+			l.Errorf("ResendVerificationEmail: invalid request payload: %v", err)
+			response.Error{Error: "invalid request"}.ClientError(w)
+			return
+		}
+
+		us := f.User()
+		err = us.SendVerificationEmail(r.Context(), req.Email)
+		switch {
+		case err == nil, errors.Is(err, models.ErrUserNotFound):
+			// unknown addresses get the same answer so that the endpoint cannot be used to find accounts
+			if err != nil {
+				l.Errorf("ResendVerificationEmail: %s", err)
+			}
+
+			response.Success{Success: "verification email sent"}.Send(w)
+		case errors.Is(err, models.ErrEmailAlreadyVerified):
+			l.Errorf("ResendVerificationEmail: %s", err)
+			response.Error{Error: models.ErrEmailAlreadyVerified.Error()}.Conflict(w)
+		case errors.Is(err, models.ErrResendCooldown):
+			l.Errorf("ResendVerificationEmail: %s", err)
+			response.Error{Error: models.ErrResendCooldown.Error()}.TooManyRequests(w)
+		default:
+			l.Errorf("ResendVerificationEmail: unable to send verification email: %s", err)
+			response.Error{Error: "unexpected error happened"}.ServerError(w)
+		}
+	}
+}
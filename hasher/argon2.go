@@ -0,0 +1,113 @@
+package hasher
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"fmt"
+	"strings"
+
+	"golang.org/x/crypto/argon2"
+)
+
+const (
+	argon2SaltLength = 16
+	argon2KeyLength  = 32
+)
+
+type argon2id struct {
+	time    uint32
+	memory  uint32
+	threads uint8
+}
+
+type argon2Hash struct {
+	time    uint32
+	memory  uint32
+	threads uint8
+	salt    []byte
+	key     []byte
+}
+
+func newArgon2id(time, memory uint32, threads uint8) algorithm {
+	return &argon2id{
+		time:    time,
+		memory:  memory,
+		threads: threads,
+	}
+}
+
+func (a *argon2id) hash(password string) (string, error) {
+	salt := make([]byte, argon2SaltLength)
+	if _, err := rand.Read(salt); err != nil {
+		return "", fmt.Errorf("argon2id: unable to generate salt: %s", err)
+	}
+
+	key := argon2.IDKey([]byte(password), salt, a.time, a.memory, a.threads, argon2KeyLength)
+
+	return fmt.Sprintf("$argon2id$v=%d$m=%d,t=%d,p=%d$%s$%s",
+		argon2.Version,
+		a.memory,
+		a.time,
+		a.threads,
+		base64.RawStdEncoding.EncodeToString(salt),
+		base64.RawStdEncoding.EncodeToString(key),
+	), nil
+}
+
+func (a *argon2id) verify(password, encodedHash string) (bool, error) {
+	h, err := decodeArgon2Hash(encodedHash)
+	if err != nil {
+		return false, err
+	}
+
+	key := argon2.IDKey([]byte(password), h.salt, h.time, h.memory, h.threads, uint32(len(h.key)))
+
+	return subtle.ConstantTimeCompare(key, h.key) == 1, nil
+}
+
+func (a *argon2id) needsRehash(encodedHash string) bool {
+	h, err := decodeArgon2Hash(encodedHash)
+	if err != nil {
+		return true
+	}
+
+	return h.time < a.time || h.memory < a.memory || h.threads < a.threads
+}
+
+// decodeArgon2Hash parses a PHC string of the form $argon2id$v=19$m=65536,t=3,p=2$<salt>$<key>
+func decodeArgon2Hash(encodedHash string) (*argon2Hash, error) {
+	parts := strings.Split(encodedHash, "$")
+	if len(parts) != 6 {
+		return nil, fmt.Errorf("argon2id: invalid hash format")
+	}
+
+	var version int
+	if _, err := fmt.Sscanf(parts[2], "v=%d", &version); err != nil {
+		return nil, fmt.Errorf("argon2id: invalid version: %s", err)
+	}
+
+	if version != argon2.Version {
+		return nil, fmt.Errorf("argon2id: unsupported version: %d", version)
+	}
+
+	var h argon2Hash
+	if _, err := fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &h.memory, &h.time, &h.threads); err != nil {
+		return nil, fmt.Errorf("argon2id: invalid parameters: %s", err)
+	}
+
+	salt, err := base64.RawStdEncoding.DecodeString(parts[4])
+	if err != nil {
+		return nil, fmt.Errorf("argon2id: invalid salt: %s", err)
+	}
+
+	key, err := base64.RawStdEncoding.DecodeString(parts[5])
+	if err != nil {
+		return nil, fmt.Errorf("argon2id: invalid key: %s", err)
+	}
+
+	h.salt = salt
+	h.key = key
+
+	return &h, nil
+}
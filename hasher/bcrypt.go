@@ -0,0 +1,49 @@
+package hasher
+
+import (
+	"errors"
+	"fmt"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+type bcryptHasher struct {
+	cost int
+}
+
+func newBcrypt(cost int) algorithm {
+	return &bcryptHasher{
+		cost: cost,
+	}
+}
+
+func (b *bcryptHasher) hash(password string) (string, error) {
+	res, err := bcrypt.GenerateFromPassword([]byte(password), b.cost)
+	if err != nil {
+		return "", fmt.Errorf("bcrypt: unable to generate hash: %s", err)
+	}
+
+	return string(res), nil
+}
+
+func (b *bcryptHasher) verify(password, encodedHash string) (bool, error) {
+	err := bcrypt.CompareHashAndPassword([]byte(encodedHash), []byte(password))
+	if errors.Is(err, bcrypt.ErrMismatchedHashAndPassword) {
+		return false, nil
+	}
+
+	if err != nil {
+		return false, fmt.Errorf("bcrypt: unable to compare hash: %s", err)
+	}
+
+	return true, nil
+}
+
+func (b *bcryptHasher) needsRehash(encodedHash string) bool {
+	cost, err := bcrypt.Cost([]byte(encodedHash))
+	if err != nil {
+		return true
+	}
+
+	return cost < b.cost
+}
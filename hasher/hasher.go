@@ -0,0 +1,119 @@
+package hasher
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"fmt"
+	"strings"
+)
+
+const (
+	Argon2id = "argon2id"
+	Bcrypt   = "bcrypt"
+	legacy   = "sha256"
+)
+
+type Hasher interface {
+	Hash(password string) (string, error)
+	Verify(password, encodedHash string) (bool, error)
+	NeedsRehash(encodedHash string) bool
+}
+
+type Params struct {
+	Argon2Time    uint32
+	Argon2Memory  uint32
+	Argon2Threads uint8
+	BcryptCost    int
+}
+
+type algorithm interface {
+	hash(password string) (string, error)
+	verify(password, encodedHash string) (bool, error)
+	needsRehash(encodedHash string) bool
+}
+
+type hasher struct {
+	name       string
+	algorithms map[string]algorithm
+}
+
+func NewHasher(name string, params Params) (Hasher, error) {
+	h := &hasher{
+		name: name,
+		algorithms: map[string]algorithm{
+			Argon2id: newArgon2id(params.Argon2Time, params.Argon2Memory, params.Argon2Threads),
+			Bcrypt:   newBcrypt(params.BcryptCost),
+		},
+	}
+
+	if _, ok := h.algorithms[name]; !ok {
+		return nil, fmt.Errorf("newHasher: unsupported algorithm: %s", name)
+	}
+
+	return h, nil
+}
+
+func (h *hasher) Hash(password string) (string, error) {
+	encodedHash, err := h.algorithms[h.name].hash(password)
+	if err != nil {
+		return "", fmt.Errorf("hash: %s", err)
+	}
+
+	return encodedHash, nil
+}
+
+func (h *hasher) Verify(password, encodedHash string) (bool, error) {
+	if encodedHash == "" {
+		return false, nil
+	}
+
+	name := identify(encodedHash)
+	if name == legacy {
+		return verifyLegacy(password, encodedHash), nil
+	}
+
+	alg, ok := h.algorithms[name]
+	if !ok {
+		return false, fmt.Errorf("verify: unrecognised hash format")
+	}
+
+	valid, err := alg.verify(password, encodedHash)
+	if err != nil {
+		return false, fmt.Errorf("verify: %s", err)
+	}
+
+	return valid, nil
+}
+
+// NeedsRehash reports whether the stored hash was produced by a different algorithm or
+// with weaker parameters than the configured one, so it can be upgraded after a successful login.
+func (h *hasher) NeedsRehash(encodedHash string) bool {
+	name := identify(encodedHash)
+	if name != h.name {
+		return true
+	}
+
+	return h.algorithms[name].needsRehash(encodedHash)
+}
+
+func identify(encodedHash string) string {
+	switch {
+	case strings.HasPrefix(encodedHash, "$argon2id$"):
+		return Argon2id
+	case strings.HasPrefix(encodedHash, "$2a$"), strings.HasPrefix(encodedHash, "$2b$"), strings.HasPrefix(encodedHash, "$2y$"):
+		return Bcrypt
+	case len(encodedHash) == sha256.Size*2:
+		if _, err := hex.DecodeString(encodedHash); err == nil {
+			return legacy
+		}
+	}
+
+	return ""
+}
+
+// verifyLegacy checks passwords stored as bare SHA-256 hex digests before the hasher was introduced.
+func verifyLegacy(password, encodedHash string) bool {
+	sum := sha256.Sum256([]byte(password))
+	return subtle.ConstantTimeCompare([]byte(hex.EncodeToString(sum[:])), []byte(strings.ToLower(encodedHash))) == 1
+}
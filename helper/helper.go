@@ -6,7 +6,6 @@ import (
 	"crypto/cipher"
 	"crypto/md5"
 	"crypto/rand"
-	"crypto/sha256"
 	"encoding/base64"
 	"encoding/hex"
 	"encoding/json"
@@ -20,42 +19,54 @@ import (
 	uuid "github.com/nu7hatch/gouuid"
 	"github.com/sirupsen/logrus"
 
+	"authservice/constant"
+	"authservice/keys"
 	"authservice/models"
 	"authservice/repository"
 )
 
 type Helper interface {
-	UnMarshal(data []byte, dest interface{})
+	UnMarshal(data []byte, dest interface{}) error
 	Marshal(src interface{}) []byte
-	SendOTP(ctx context.Context, phone string) (string, error)
-	SendEmail(ctx context.Context, to []string, message string) error
-	GetJWT(userClaims map[string]interface{}) (string, error)
+	SendOTP(ctx context.Context, otp *models.OTP) (string, error)
+	SendEmail(ctx context.Context, notificationType, subject string, to []string, message string) error
+	PublishSecurityEvent(ctx context.Context, event *models.SecurityEvent) error
+	GetJWT(userClaims map[string]interface{}, expiry time.Time) (string, error)
 	DecodeJWT(token string) (map[string]interface{}, error)
-	EncodeClaims(userClaims map[string]interface{}) (string, error)
+	DecodeExpiredJWT(token string) (map[string]interface{}, error)
+	EncodeClaims(userClaims map[string]interface{}, familyId string, sessionStart, expiry time.Time) (string, error)
 	DecodeToken(data string) (*models.RefreshMeta, error)
-	Hash(input string) string
+	Sign(purpose string, data interface{}, expiry time.Time) (string, error)
+	VerifySigned(purpose, token string, dest interface{}) error
 	NewId() string
 }
 
 type helper struct {
-	tokenSecret   string
+	keySet        keys.KeySet
+	secretSet     keys.SecretSet
 	refreshSecret string
 
 	logger *logrus.Logger
 	redis  repository.RedisQueryer
 }
 
-func NewHelper(l *logrus.Logger, r repository.RedisQueryer, ts, rs string) Helper {
+func NewHelper(l *logrus.Logger, r repository.RedisQueryer, ks keys.KeySet, ss keys.SecretSet, rs string) Helper {
 	return &helper{
 		redis:         r,
 		logger:        l,
-		tokenSecret:   ts,
+		keySet:        ks,
+		secretSet:     ss,
 		refreshSecret: rs,
 	}
 }
 
-func (h *helper) UnMarshal(data []byte, dest interface{}) {
-	_ = json.Unmarshal(data, dest)
+func (h *helper) UnMarshal(data []byte, dest interface{}) error {
+	err := json.Unmarshal(data, dest)
+	if err != nil {
+		return fmt.Errorf("unMarshal: unable to decode json: %s", err)
+	}
+
+	return nil
 }
 
 func (h *helper) Marshal(src interface{}) []byte {
@@ -63,22 +74,34 @@ func (h *helper) Marshal(src interface{}) []byte {
 	return res
 }
 
-func (h *helper) SendOTP(ctx context.Context, phone string) (string, error) {
-	key, otp := h.generateOTPKeyPair(6)
-	sms := &models.SMS{
-		To:      []string{phone},
-		Message: fmt.Sprintf("%s is your POUSHAK authentication code.", otp),
-	}
-	err := h.redis.PushToChannel(ctx, &models.ChannelMessage{
-		Medium:       "SMS",
-		Type:         "OTP",
-		Notification: sms.GetBytes(),
-	})
-	if err != nil {
-		return "", fmt.Errorf("SendOTP: unable to publish OTP: %s", err)
+// SendOTP sends a new code to otp.SentTo over otp.Channel and stores the record under the returned nonce
+func (h *helper) SendOTP(ctx context.Context, otp *models.OTP) (string, error) {
+	key, code := h.generateOTPKeyPair(6)
+	message := fmt.Sprintf("%s is your POUSHAK authentication code.", code)
+	if otp.Channel == constant.ChannelEmail {
+		err := h.SendEmail(ctx, constant.NotificationOTP, "Your authentication code", []string{otp.SentTo}, message)
+		if err != nil {
+			return "", fmt.Errorf("SendOTP: %s", err)
+		}
+	} else {
+		sms := &models.SMS{
+			To:      []string{otp.SentTo},
+			Message: message,
+		}
+		err := h.redis.PushToChannel(ctx, &models.ChannelMessage{
+			Medium:       constant.ChannelSMS,
+			Type:         constant.NotificationOTP,
+			Notification: sms.GetBytes(),
+		})
+		if err != nil {
+			return "", fmt.Errorf("SendOTP: unable to publish OTP: %s", err)
+		}
 	}
 
-	err = h.redis.Set(ctx, key, otp, 120*time.Second)
+	otp.Code = code
+	otp.Attempts = 0
+	otp.ExpiresAt = time.Now().Add(models.OTPLifetime).Unix()
+	err := h.redis.Set(ctx, key, h.Marshal(otp), models.OTPLifetime)
 	if err != nil {
 		return "", fmt.Errorf("sendOTP: unable to save OTP: %s", err)
 	}
@@ -86,20 +109,34 @@ func (h *helper) SendOTP(ctx context.Context, phone string) (string, error) {
 	return key, nil
 }
 
-func (h *helper) SendEmail(ctx context.Context, to []string, message string) error {
-	const emailTemplate = "From: Poushak Care\r\nTo: %s\r\nSubject: Poushak OTP\r\n\r\n%s\r\n"
+func (h *helper) SendEmail(ctx context.Context, notificationType, subject string, to []string, message string) error {
+	const emailTemplate = "From: Poushak Care\r\nTo: %s\r\nSubject: %s\r\n\r\n%s\r\n"
 	email := &models.Email{
 		To:      to,
 		From:    "poushak.care@gmail.com",
-		Message: []byte(fmt.Sprintf(emailTemplate, strings.Join(to, ","), message)),
+		Message: []byte(fmt.Sprintf(emailTemplate, strings.Join(to, ","), subject, message)),
 	}
 	err := h.redis.PushToChannel(ctx, &models.ChannelMessage{
 		Medium:       "EMAIL",
-		Type:         "OTP",
+		Type:         notificationType,
 		Notification: email.GetBytes(),
 	})
 	if err != nil {
-		return fmt.Errorf("SendEmail: unable to publish OTP: %s", err)
+		return fmt.Errorf("SendEmail: unable to publish %s: %s", notificationType, err)
+	}
+
+	return nil
+}
+
+func (h *helper) PublishSecurityEvent(ctx context.Context, event *models.SecurityEvent) error {
+	h.logger.Warnf("security event %s for user %s", event.Type, event.UserId)
+	err := h.redis.PushToChannel(ctx, &models.ChannelMessage{
+		Medium:       "EVENT",
+		Type:         event.Type,
+		Notification: event.GetBytes(),
+	})
+	if err != nil {
+		return fmt.Errorf("PublishSecurityEvent: unable to publish event: %s", err)
 	}
 
 	return nil
@@ -123,12 +160,14 @@ func (h *helper) generateOTPKeyPair(digits int) (string, string) {
 	return key.String(), string(b)
 }
 
-func (h *helper) GetJWT(userClaims map[string]interface{}) (string, error) {
+func (h *helper) GetJWT(userClaims map[string]interface{}, expiry time.Time) (string, error) {
 	claims := jwt.MapClaims(userClaims)
 	claims["iat"] = time.Now().Unix()
-	claims["exp"] = time.Now().Add(time.Hour * 24 * 7).Unix()
-	token := jwt.NewWithClaims(jwt.SigningMethodHS512, claims)
-	signedToken, err := token.SignedString([]byte(h.tokenSecret))
+	claims["exp"] = expiry.Unix()
+	signingKey := h.keySet.SigningKey()
+	token := jwt.NewWithClaims(signingKey.SigningMethod(), claims)
+	token.Header["kid"] = signingKey.Id
+	signedToken, err := token.SignedString(signingKey.PrivateKey())
 	if err != nil {
 		return "", fmt.Errorf("getJWT: unable to sign token: %s", err)
 	}
@@ -139,13 +178,7 @@ func (h *helper) GetJWT(userClaims map[string]interface{}) (string, error) {
 func (h *helper) DecodeJWT(bearerToken string) (map[string]interface{}, error) {
 	token := strings.Split(bearerToken, "Bearer ")[1]
 	claims := jwt.MapClaims{}
-	decodedToken, err := jwt.ParseWithClaims(token, claims, func(t *jwt.Token) (interface{}, error) {
-		if _, ok := t.Method.(*jwt.SigningMethodHMAC); !ok {
-			return nil, fmt.Errorf("unexpected signing method: %v", t.Header["alg"])
-		}
-
-		return []byte(h.tokenSecret), nil
-	})
+	decodedToken, err := jwt.ParseWithClaims(token, claims, h.verificationKey)
 	if err != nil {
 		return claims, fmt.Errorf("decodeJWT: unable to decode JWT: %s", err)
 	}
@@ -157,17 +190,50 @@ func (h *helper) DecodeJWT(bearerToken string) (map[string]interface{}, error) {
 	return claims, nil
 }
 
-func (h *helper) EncodeClaims(userClaims map[string]interface{}) (string, error) {
+// DecodeExpiredJWT verifies the signature of the token like DecodeJWT but accepts tokens that have expired
+func (h *helper) DecodeExpiredJWT(bearerToken string) (map[string]interface{}, error) {
+	token := strings.TrimPrefix(bearerToken, "Bearer ")
+	claims := jwt.MapClaims{}
+	_, err := jwt.ParseWithClaims(token, claims, h.verificationKey)
+	if err != nil {
+		validationErr, ok := err.(*jwt.ValidationError)
+		if !ok || validationErr.Errors != jwt.ValidationErrorExpired {
+			return claims, fmt.Errorf("decodeExpiredJWT: unable to decode JWT: %s", err)
+		}
+	}
+
+	return claims, nil
+}
+
+func (h *helper) verificationKey(t *jwt.Token) (interface{}, error) {
+	kid, _ := t.Header["kid"].(string)
+	key, err := h.keySet.VerificationKey(kid)
+	if err != nil {
+		return nil, err
+	}
+
+	if t.Method.Alg() != key.Algorithm {
+		return nil, fmt.Errorf("unexpected signing method: %v", t.Header["alg"])
+	}
+
+	return key.PublicKey(), nil
+}
+
+func (h *helper) EncodeClaims(userClaims map[string]interface{}, familyId string, sessionStart, expiry time.Time) (string, error) {
 	dataBytes := h.Marshal(&models.RefreshMeta{
-		UserClaims: userClaims,
-		Expiry:     time.Now().Add(time.Hour * 24 * 5).Unix(),
+		UserClaims:   userClaims,
+		FamilyId:     familyId,
+		IssuedAt:     time.Now().Unix(),
+		Expiry:       expiry.Unix(),
+		SessionStart: sessionStart.Unix(),
 	})
-	refreshToken, err := h.encrypt(h.refreshSecret, dataBytes)
+	version, secret := h.secretSet.ActiveSecret()
+	refreshToken, err := h.encrypt(secret, dataBytes)
 	if err != nil {
 		return "", fmt.Errorf("encodeClaims: unable to encrypt data: %s", err)
 	}
 
-	return hex.EncodeToString(refreshToken), nil
+	return hex.EncodeToString(append([]byte{version}, refreshToken...)), nil
 }
 
 func (h *helper) DecodeToken(data string) (*models.RefreshMeta, error) {
@@ -176,13 +242,29 @@ func (h *helper) DecodeToken(data string) (*models.RefreshMeta, error) {
 		return nil, fmt.Errorf("decodeToken: cannot decode from hex: %s", err)
 	}
 
-	claimBytes, err := h.decrypt(h.refreshSecret, dataBytes)
+	if len(dataBytes) == 0 {
+		return nil, fmt.Errorf("decodeToken: empty token")
+	}
+
+	var claimBytes []byte
+	if secret, ok := h.secretSet.Secret(dataBytes[0]); ok {
+		claimBytes, err = h.decrypt(secret, dataBytes[1:])
+	}
+
+	// tokens issued before the secret ring was introduced carry no version byte
+	if claimBytes == nil {
+		claimBytes, err = h.decrypt(h.hash(h.refreshSecret), dataBytes)
+	}
+
 	if err != nil {
 		return nil, fmt.Errorf("decodeToken: unable to decode token: %s", err)
 	}
 
 	var claims models.RefreshMeta
-	h.UnMarshal(claimBytes, &claims)
+	err = h.UnMarshal(claimBytes, &claims)
+	if err != nil {
+		return nil, fmt.Errorf("decodeToken: %s", err)
+	}
 
 	return &claims, nil
 }
@@ -193,8 +275,8 @@ func (h *helper) hash(key string) []byte {
 	return hasher.Sum(nil)
 }
 
-func (h *helper) encrypt(key string, text []byte) ([]byte, error) {
-	block, err := aes.NewCipher(h.hash(key))
+func (h *helper) encrypt(key []byte, text []byte) ([]byte, error) {
+	block, err := aes.NewCipher(key)
 	if err != nil {
 		return nil, fmt.Errorf("encrypt: unable to create block: %s", err)
 	}
@@ -212,8 +294,8 @@ func (h *helper) encrypt(key string, text []byte) ([]byte, error) {
 	return ciphertext, nil
 }
 
-func (h *helper) decrypt(key string, text []byte) ([]byte, error) {
-	block, err := aes.NewCipher(h.hash(key))
+func (h *helper) decrypt(key []byte, text []byte) ([]byte, error) {
+	block, err := aes.NewCipher(key)
 	if err != nil {
 		return nil, fmt.Errorf("decrypt: unable to create block: %s", err)
 	}
@@ -222,11 +304,11 @@ func (h *helper) decrypt(key string, text []byte) ([]byte, error) {
 		return nil, fmt.Errorf("decrypt: cypher text too short")
 	}
 
-	iv := text[:aes.BlockSize]
-	text = text[aes.BlockSize:]
-	cfb := cipher.NewCFBDecrypter(block, iv)
-	cfb.XORKeyStream(text, text)
-	data, err := base64.StdEncoding.DecodeString(string(text))
+	// decrypted into a buffer of its own, the caller may retry the same text with another key
+	plain := make([]byte, len(text)-aes.BlockSize)
+	cfb := cipher.NewCFBDecrypter(block, text[:aes.BlockSize])
+	cfb.XORKeyStream(plain, text[aes.BlockSize:])
+	data, err := base64.StdEncoding.DecodeString(string(plain))
 	if err != nil {
 		return nil, fmt.Errorf("decrypt: unable to decode data: %s", err)
 	}
@@ -234,14 +316,6 @@ func (h *helper) decrypt(key string, text []byte) ([]byte, error) {
 	return data, nil
 }
 
-func (h *helper) Hash(input string) string {
-	hasher := sha256.New()
-	hasher.Write([]byte(input))
-	res := hasher.Sum(nil)
-
-	return fmt.Sprintf("%x", res)
-}
-
 func (h *helper) NewId() string {
 	uid, _ := uuid.NewV4()
 	return uid.String()
@@ -0,0 +1,96 @@
+package helper
+
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"testing"
+	"time"
+
+	"authservice/keys"
+	"authservice/models"
+)
+
+// staticSecrets holds fixed secrets by version, claiming every version when any is set
+type staticSecrets struct {
+	keys.SecretSet
+	version byte
+	secret  []byte
+	any     bool
+}
+
+func (s *staticSecrets) ActiveSecret() (byte, []byte) {
+	return s.version, s.secret
+}
+
+func (s *staticSecrets) Secret(version byte) ([]byte, bool) {
+	if s.any || version == s.version {
+		return s.secret, true
+	}
+
+	return nil, false
+}
+
+func (s *staticSecrets) Rotate(ctx context.Context) (byte, error) {
+	return s.version, nil
+}
+
+func newTestHelper(secrets *staticSecrets) *helper {
+	return &helper{secretSet: secrets, refreshSecret: "legacy-secret"}
+}
+
+func TestDecodeTokenFallsBackToLegacyTokensUntouched(t *testing.T) {
+	// every first byte looks like a known version, so the legacy token is always tried with the ring first
+	h := newTestHelper(&staticSecrets{version: 1, secret: bytes.Repeat([]byte{7}, 32), any: true})
+	legacy, err := h.encrypt(h.hash(h.refreshSecret), h.Marshal(&models.RefreshMeta{FamilyId: "family", Expiry: 42}))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	claims, err := h.DecodeToken(hex.EncodeToString(legacy))
+	if err != nil {
+		t.Fatalf("got %v, want the legacy token decoded", err)
+	}
+
+	if claims.FamilyId != "family" || claims.Expiry != 42 {
+		t.Fatalf("decoded %+v", claims)
+	}
+}
+
+func TestDecodeTokenRejectsUndecodableClaims(t *testing.T) {
+	h := newTestHelper(&staticSecrets{version: 1, secret: bytes.Repeat([]byte{7}, 32)})
+	encrypted, err := h.encrypt(bytes.Repeat([]byte{7}, 32), []byte("not json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = h.DecodeToken(hex.EncodeToString(append([]byte{1}, encrypted...)))
+	if err == nil {
+		t.Fatal("token with undecodable claims accepted")
+	}
+}
+
+func TestEncodeClaimsRoundTrip(t *testing.T) {
+	h := newTestHelper(&staticSecrets{version: 3, secret: bytes.Repeat([]byte{7}, 32)})
+	start, expiry := time.Unix(1000, 0), time.Unix(2000, 0)
+	token, err := h.EncodeClaims(map[string]interface{}{"id": "user"}, "family", start, expiry)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	claims, err := h.DecodeToken(token)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if claims.UserClaims["id"] != "user" || claims.FamilyId != "family" || claims.SessionStart != 1000 ||
+		claims.Expiry != 2000 || claims.IssuedAt == 0 {
+		t.Fatalf("decoded %+v", claims)
+	}
+
+	// a token of a version that left the ring is not decoded with the legacy secret either
+	_, err = newTestHelper(&staticSecrets{version: 4, secret: bytes.Repeat([]byte{8}, 32)}).DecodeToken(token)
+	if err == nil {
+		t.Fatal("token decoded without its secret")
+	}
+}
@@ -0,0 +1,67 @@
+package helper
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+)
+
+type signedData struct {
+	UserId string `json:"userId"`
+}
+
+func TestSignRoundTrip(t *testing.T) {
+	h := newTestHelper(&staticSecrets{version: 1, secret: bytes.Repeat([]byte{7}, 32)})
+	token, err := h.Sign("purpose", &signedData{UserId: "user"}, time.Now().Add(time.Minute))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var data signedData
+	err = h.VerifySigned("purpose", token, &data)
+	if err != nil || data.UserId != "user" {
+		t.Fatalf("got %+v, %v", data, err)
+	}
+}
+
+func TestVerifySignedRejects(t *testing.T) {
+	secrets := &staticSecrets{version: 1, secret: bytes.Repeat([]byte{7}, 32)}
+	h := newTestHelper(secrets)
+	token, err := h.Sign("purpose", &signedData{UserId: "user"}, time.Now().Add(time.Minute))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expired, err := h.Sign("purpose", &signedData{UserId: "user"}, time.Now().Add(-time.Second))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	parts := strings.Split(token, ".")
+	forged, err := newTestHelper(&staticSecrets{version: 1, secret: bytes.Repeat([]byte{8}, 32)}).Sign("purpose",
+		&signedData{UserId: "victim"}, time.Now().Add(time.Minute))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := map[string]struct {
+		purpose string
+		token   string
+	}{
+		"another purpose":     {purpose: "other", token: token},
+		"expired":             {purpose: "purpose", token: expired},
+		"another secret":      {purpose: "purpose", token: forged},
+		"swapped payload":     {purpose: "purpose", token: strings.Split(forged, ".")[0] + "." + parts[1]},
+		"missing signature":   {purpose: "purpose", token: parts[0]},
+		"unknown version":     {purpose: "purpose", token: parts[0] + ".AgAA"},
+		"malformed signature": {purpose: "purpose", token: parts[0] + ".!!"},
+	}
+
+	for name, test := range tests {
+		var data signedData
+		if err := h.VerifySigned(test.purpose, test.token, &data); err == nil {
+			t.Errorf("%s: token accepted", name)
+		}
+	}
+}
@@ -0,0 +1,178 @@
+package identity
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"authservice/builder"
+	"authservice/constant"
+	"authservice/helper"
+	"authservice/models"
+	"authservice/repository"
+)
+
+const linkLifetime = 10 * time.Minute
+
+type Identity interface {
+	List(ctx context.Context, userId string) ([]*models.Identity, error)
+	Find(ctx context.Context, provider, subject string) (string, error)
+	Add(ctx context.Context, userId string, oauthUser *models.OAuthUser) error
+	PendingLink(oauthUser *models.OAuthUser) (*models.IdentityLink, error)
+	Link(ctx context.Context, userId, token string) error
+	Unlink(ctx context.Context, userId, id string) error
+}
+
+type identity struct {
+	builder  builder.IdentityBuilder
+	postgres repository.PostgresQueryer
+	helper   helper.Helper
+}
+
+func NewIdentity(b builder.IdentityBuilder, p repository.PostgresQueryer, h helper.Helper) Identity {
+	return &identity{
+		builder:  b,
+		postgres: p,
+		helper:   h,
+	}
+}
+
+func (i *identity) List(ctx context.Context, userId string) ([]*models.Identity, error) {
+	res, err := i.postgres.QueryScan(ctx, i.builder.GetIdentities(), userId)
+	if err != nil {
+		return nil, fmt.Errorf("list: unable to fetch identities: %s", err)
+	}
+
+	defer res.Close()
+	identities := []*models.Identity{}
+	for res.Next() {
+		var id models.Identity
+		err = res.Scan(&id)
+		if err != nil {
+			return nil, fmt.Errorf("list: unable to decode identity: %s", err)
+		}
+
+		identities = append(identities, &id)
+	}
+
+	return identities, nil
+}
+
+// Find returns the user the provider account is linked to, or an empty id when it is not linked
+func (i *identity) Find(ctx context.Context, provider, subject string) (string, error) {
+	res, err := i.postgres.QueryScan(ctx, i.builder.GetIdentityUser(), provider, subject)
+	if err != nil {
+		return "", fmt.Errorf("find: unable to fetch identity: %s", err)
+	}
+
+	defer res.Close()
+	if !res.Next() {
+		return "", nil
+	}
+
+	var userId string
+	err = res.Scan(&userId)
+	if err != nil {
+		return "", fmt.Errorf("find: unable to decode identity: %s", err)
+	}
+
+	return userId, nil
+}
+
+// Add links the provider account to the user, linking it again to the same user is a no-op
+func (i *identity) Add(ctx context.Context, userId string, oauthUser *models.OAuthUser) error {
+	affected, err := i.postgres.Exec(ctx, i.builder.AddIdentity(), i.helper.NewId(), userId, oauthUser.Provider,
+		oauthUser.Subject, oauthUser.Email)
+	if err != nil {
+		return fmt.Errorf("add: unable to add identity: %s", err)
+	}
+
+	if affected > 0 {
+		i.publish(ctx, constant.EventIdentityLinked, userId)
+		return nil
+	}
+
+	owner, err := i.Find(ctx, oauthUser.Provider, oauthUser.Subject)
+	if err != nil {
+		return fmt.Errorf("add: %s", err)
+	}
+
+	if owner != userId {
+		return fmt.Errorf("add: %w", models.ErrIdentityInUse)
+	}
+
+	return nil
+}
+
+// PendingLink signs the provider account into a token that a signed in user exchanges on Link, proving they own
+// both the account and the provider account
+func (i *identity) PendingLink(oauthUser *models.OAuthUser) (*models.IdentityLink, error) {
+	expiry := time.Now().Add(linkLifetime)
+	token, err := i.helper.Sign(constant.PurposeIdentityLink, &models.IdentityLinkClaims{
+		Provider: oauthUser.Provider,
+		Subject:  oauthUser.Subject,
+		Email:    oauthUser.Email,
+	}, expiry)
+	if err != nil {
+		return nil, fmt.Errorf("pendingLink: unable to sign link: %s", err)
+	}
+
+	return &models.IdentityLink{
+		Token:     token,
+		Provider:  oauthUser.Provider,
+		Email:     oauthUser.Email,
+		ExpiresAt: expiry.Unix(),
+	}, nil
+}
+
+func (i *identity) Link(ctx context.Context, userId, token string) error {
+	var claims models.IdentityLinkClaims
+	err := i.helper.VerifySigned(constant.PurposeIdentityLink, token, &claims)
+	if err != nil {
+		return fmt.Errorf("link: %w: %s", models.ErrInvalidIdentityLink, err)
+	}
+
+	err = i.Add(ctx, userId, &models.OAuthUser{
+		Provider: claims.Provider,
+		Subject:  claims.Subject,
+		Email:    claims.Email,
+	})
+	if err != nil {
+		return fmt.Errorf("link: %w", err)
+	}
+
+	return nil
+}
+
+func (i *identity) Unlink(ctx context.Context, userId, id string) error {
+	affected, err := i.postgres.Exec(ctx, i.builder.DeleteIdentity(), id, userId)
+	if err != nil {
+		return fmt.Errorf("unlink: unable to delete identity: %s", err)
+	}
+
+	if affected > 0 {
+		i.publish(ctx, constant.EventIdentityUnlinked, userId)
+		return nil
+	}
+
+	identities, err := i.List(ctx, userId)
+	if err != nil {
+		return fmt.Errorf("unlink: %s", err)
+	}
+
+	for _, identity := range identities {
+		if identity.Id == id {
+			return fmt.Errorf("unlink: %w", models.ErrLastSignInMethod)
+		}
+	}
+
+	return fmt.Errorf("unlink: %w", models.ErrIdentityNotFound)
+}
+
+func (i *identity) publish(ctx context.Context, event, userId string) {
+	_ = i.helper.PublishSecurityEvent(ctx, &models.SecurityEvent{
+		Type:   event,
+		UserId: userId,
+		Time:   time.Now().UnixMilli(),
+	})
+}
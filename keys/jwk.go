@@ -0,0 +1,95 @@
+package keys
+
+import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"math/big"
+)
+
+type JWK struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	Alg string `json:"alg"`
+	Crv string `json:"crv,omitempty"`
+	N   string `json:"n,omitempty"`
+	E   string `json:"e,omitempty"`
+	X   string `json:"x,omitempty"`
+	Y   string `json:"y,omitempty"`
+}
+
+type JWKS struct {
+	Keys []JWK `json:"keys"`
+}
+
+func newJWK(publicKey interface{}) (*JWK, error) {
+	switch k := publicKey.(type) {
+	case *rsa.PublicKey:
+		return &JWK{
+			Kty: "RSA",
+			N:   encodeBigInt(k.N, 0),
+			E:   encodeBigInt(big.NewInt(int64(k.E)), 0),
+		}, nil
+	case *ecdsa.PublicKey:
+		size := (k.Curve.Params().BitSize + 7) / 8
+		return &JWK{
+			Kty: "EC",
+			Crv: k.Curve.Params().Name,
+			X:   encodeBigInt(k.X, size),
+			Y:   encodeBigInt(k.Y, size),
+		}, nil
+	case ed25519.PublicKey:
+		return &JWK{
+			Kty: "OKP",
+			Crv: "Ed25519",
+			X:   base64.RawURLEncoding.EncodeToString(k),
+		}, nil
+	}
+
+	return nil, fmt.Errorf("newJWK: unsupported public key type %T", publicKey)
+}
+
+// thumbprint computes the RFC 7638 thumbprint of the key which is used as its default kid
+func (j *JWK) thumbprint() string {
+	var members interface{}
+	switch j.Kty {
+	case "RSA":
+		members = struct {
+			E   string `json:"e"`
+			Kty string `json:"kty"`
+			N   string `json:"n"`
+		}{j.E, j.Kty, j.N}
+	case "EC":
+		members = struct {
+			Crv string `json:"crv"`
+			Kty string `json:"kty"`
+			X   string `json:"x"`
+			Y   string `json:"y"`
+		}{j.Crv, j.Kty, j.X, j.Y}
+	default:
+		members = struct {
+			Crv string `json:"crv"`
+			Kty string `json:"kty"`
+			X   string `json:"x"`
+		}{j.Crv, j.Kty, j.X}
+	}
+
+	bytes, _ := json.Marshal(members)
+	sum := sha256.Sum256(bytes)
+
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+func encodeBigInt(n *big.Int, size int) string {
+	bytes := n.Bytes()
+	if len(bytes) < size {
+		bytes = append(make([]byte, size-len(bytes)), bytes...)
+	}
+
+	return base64.RawURLEncoding.EncodeToString(bytes)
+}
@@ -0,0 +1,382 @@
+package keys
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/dgrijalva/jwt-go"
+
+	"authservice/repository"
+)
+
+type Key struct {
+	Id        string
+	Algorithm string
+
+	private crypto.Signer
+	public  crypto.PublicKey
+}
+
+type KeySet interface {
+	SigningKey() *Key
+	VerificationKey(kid string) (*Key, error)
+	JWKS() *JWKS
+	Rotate(ctx context.Context) (*Key, error)
+}
+
+type keyRing struct {
+	ring   *ring
+	static map[string]*Key
+
+	mu       sync.RWMutex
+	active   *Key
+	keys     map[string]*Key
+	order    []string
+	loadedAt time.Time
+	missedAt time.Time
+}
+
+// LoadKeySet builds the signing key ring. The key in signingKeyFile seeds the ring the first time it is
+// used, after which the ring stored in redis is authoritative and rotated keys are shared by all replicas.
+// Keys in verificationKeyFiles are verify-only and never expire.
+func LoadKeySet(ctx context.Context, r repository.RedisQueryer, signingKeyFile string, verificationKeyFiles []string, secret string, retention time.Duration) (KeySet, error) {
+	signingKey, err := LoadKey(signingKeyFile)
+	if err != nil {
+		return nil, fmt.Errorf("loadKeySet: %s", err)
+	}
+
+	if signingKey.private == nil {
+		return nil, fmt.Errorf("loadKeySet: %s does not contain a private key", signingKeyFile)
+	}
+
+	rg, err := newRing("signing", r, secret, retention)
+	if err != nil {
+		return nil, fmt.Errorf("loadKeySet: %s", err)
+	}
+
+	kr := &keyRing{
+		ring:   rg,
+		static: map[string]*Key{},
+	}
+	for _, file := range verificationKeyFiles {
+		key, err := LoadKey(file)
+		if err != nil {
+			return nil, fmt.Errorf("loadKeySet: %s", err)
+		}
+
+		kr.static[key.Id] = key
+	}
+
+	material, err := x509.MarshalPKCS8PrivateKey(signingKey.private)
+	if err != nil {
+		return nil, fmt.Errorf("loadKeySet: unable to encode signing key: %s", err)
+	}
+
+	err = rg.seed(ctx, signingKey.Id, material)
+	if err != nil {
+		return nil, fmt.Errorf("loadKeySet: %s", err)
+	}
+
+	err = kr.reload(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("loadKeySet: %s", err)
+	}
+
+	return kr, nil
+}
+
+func (k *keyRing) reload(ctx context.Context) error {
+	entries, err := k.ring.load(ctx)
+	if err != nil {
+		return fmt.Errorf("reload: %s", err)
+	}
+
+	return k.apply(entries)
+}
+
+func (k *keyRing) apply(entries []ringEntry) error {
+	loaded := map[string]*Key{}
+	var order []string
+	for _, entry := range entries {
+		material, err := k.ring.open(entry.Material)
+		if err != nil {
+			return fmt.Errorf("apply: key %s: %s", entry.Id, err)
+		}
+
+		private, err := x509.ParsePKCS8PrivateKey(material)
+		if err != nil {
+			return fmt.Errorf("apply: key %s: unable to parse key: %s", entry.Id, err)
+		}
+
+		key, err := NewKey(private)
+		if err != nil {
+			return fmt.Errorf("apply: key %s: %s", entry.Id, err)
+		}
+
+		loaded[key.Id] = key
+		order = append(order, key.Id)
+	}
+
+	if len(order) == 0 {
+		return fmt.Errorf("apply: no signing key available")
+	}
+
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	k.active = loaded[order[0]]
+	k.keys = loaded
+	k.order = order
+	k.loadedAt = time.Now()
+
+	return nil
+}
+
+func (k *keyRing) refresh() {
+	k.mu.RLock()
+	stale := time.Since(k.loadedAt) > refreshInterval
+	k.mu.RUnlock()
+	if stale {
+		_ = k.reload(context.Background())
+	}
+}
+
+func (k *keyRing) SigningKey() *Key {
+	k.refresh()
+
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+	return k.active
+}
+
+func (k *keyRing) VerificationKey(kid string) (*Key, error) {
+	k.refresh()
+
+	if key, ok := k.lookup(kid); ok {
+		return key, nil
+	}
+
+	// the token may have been signed with a key rotated in by another replica since the last reload
+	if k.reloadOnMiss() {
+		_ = k.reload(context.Background())
+		if key, ok := k.lookup(kid); ok {
+			return key, nil
+		}
+	}
+
+	return nil, fmt.Errorf("verificationKey: unknown key id: %s", kid)
+}
+
+// reloadOnMiss reports whether an unknown key id may reload the ring, which it may once per missReloadInterval
+func (k *keyRing) reloadOnMiss() bool {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	if time.Since(k.missedAt) < missReloadInterval {
+		return false
+	}
+
+	k.missedAt = time.Now()
+	return true
+}
+
+func (k *keyRing) lookup(kid string) (*Key, bool) {
+	if key, ok := k.static[kid]; ok {
+		return key, true
+	}
+
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+	key, ok := k.keys[kid]
+
+	return key, ok
+}
+
+func (k *keyRing) JWKS() *JWKS {
+	k.refresh()
+
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+	jwks := &JWKS{Keys: []JWK{}}
+	for _, kid := range k.order {
+		jwks.Keys = append(jwks.Keys, k.keys[kid].JWK())
+	}
+
+	for kid, key := range k.static {
+		if _, ok := k.keys[kid]; !ok {
+			jwks.Keys = append(jwks.Keys, key.JWK())
+		}
+	}
+
+	return jwks
+}
+
+// Rotate generates a new key of the same type as the active one and makes it active.
+// The previous key keeps verifying tokens until the retention period has passed.
+func (k *keyRing) Rotate(ctx context.Context) (*Key, error) {
+	var next *Key
+	entries, err := k.ring.rotate(ctx, func(active ringEntry) (string, []byte, error) {
+		k.mu.RLock()
+		current, ok := k.keys[active.Id]
+		k.mu.RUnlock()
+		if !ok {
+			return "", nil, fmt.Errorf("active key %s is not loaded", active.Id)
+		}
+
+		key, err := generateKey(current)
+		if err != nil {
+			return "", nil, err
+		}
+
+		material, err := x509.MarshalPKCS8PrivateKey(key.private)
+		if err != nil {
+			return "", nil, fmt.Errorf("unable to encode key: %s", err)
+		}
+
+		next = key
+		return key.Id, material, nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("rotate: %s", err)
+	}
+
+	err = k.apply(k.ring.prune(entries))
+	if err != nil {
+		return nil, fmt.Errorf("rotate: %s", err)
+	}
+
+	return next, nil
+}
+
+func generateKey(like *Key) (*Key, error) {
+	var private interface{}
+	var err error
+	switch pub := like.public.(type) {
+	case *rsa.PublicKey:
+		private, err = rsa.GenerateKey(rand.Reader, pub.N.BitLen())
+	case *ecdsa.PublicKey:
+		private, err = ecdsa.GenerateKey(pub.Curve, rand.Reader)
+	case ed25519.PublicKey:
+		_, private, err = ed25519.GenerateKey(rand.Reader)
+	default:
+		err = fmt.Errorf("unsupported key type %T", like.public)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("generateKey: %s", err)
+	}
+
+	return NewKey(private)
+}
+
+// LoadKey parses a PEM encoded private (PKCS#1, PKCS#8, SEC 1) or public (PKIX) key.
+func LoadKey(file string) (*Key, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, fmt.Errorf("loadKey: unable to read %s: %s", file, err)
+	}
+
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("loadKey: no PEM data found in %s", file)
+	}
+
+	var parsed interface{}
+	switch block.Type {
+	case "RSA PRIVATE KEY":
+		parsed, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+	case "EC PRIVATE KEY":
+		parsed, err = x509.ParseECPrivateKey(block.Bytes)
+	case "PRIVATE KEY":
+		parsed, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+	case "PUBLIC KEY":
+		parsed, err = x509.ParsePKIXPublicKey(block.Bytes)
+	default:
+		return nil, fmt.Errorf("loadKey: unsupported PEM block %q in %s", block.Type, file)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("loadKey: unable to parse %s: %s", file, err)
+	}
+
+	key, err := NewKey(parsed)
+	if err != nil {
+		return nil, fmt.Errorf("loadKey: %s: %s", file, err)
+	}
+
+	return key, nil
+}
+
+// NewKey wraps an RSA, ECDSA or Ed25519 key, deriving its JWS algorithm and RFC 7638 kid.
+func NewKey(k interface{}) (*Key, error) {
+	key := &Key{}
+	if signer, ok := k.(crypto.Signer); ok {
+		key.private = signer
+		key.public = signer.Public()
+	} else {
+		key.public = k
+	}
+
+	switch pub := key.public.(type) {
+	case *rsa.PublicKey:
+		if pub.N.BitLen() < 2048 {
+			return nil, fmt.Errorf("RSA keys must be at least 2048 bits")
+		}
+
+		key.Algorithm = jwt.SigningMethodRS256.Alg()
+	case *ecdsa.PublicKey:
+		switch pub.Curve {
+		case elliptic.P256():
+			key.Algorithm = jwt.SigningMethodES256.Alg()
+		case elliptic.P384():
+			key.Algorithm = jwt.SigningMethodES384.Alg()
+		case elliptic.P521():
+			key.Algorithm = jwt.SigningMethodES512.Alg()
+		default:
+			return nil, fmt.Errorf("unsupported elliptic curve: %s", pub.Curve.Params().Name)
+		}
+	case ed25519.PublicKey:
+		key.Algorithm = SigningMethodEdDSA.Alg()
+	default:
+		return nil, fmt.Errorf("unsupported key type %T", key.public)
+	}
+
+	jwk, err := newJWK(key.public)
+	if err != nil {
+		return nil, err
+	}
+
+	key.Id = jwk.thumbprint()
+
+	return key, nil
+}
+
+func (k *Key) SigningMethod() jwt.SigningMethod {
+	return jwt.GetSigningMethod(k.Algorithm)
+}
+
+// PrivateKey returns the key in the form expected by the jwt-go signing methods.
+func (k *Key) PrivateKey() interface{} {
+	return k.private
+}
+
+// PublicKey returns the key in the form expected by the jwt-go verification methods.
+func (k *Key) PublicKey() interface{} {
+	return k.public
+}
+
+func (k *Key) JWK() JWK {
+	jwk, _ := newJWK(k.public)
+	jwk.Kid = k.Id
+	jwk.Use = "sig"
+	jwk.Alg = k.Algorithm
+
+	return *jwk
+}
@@ -0,0 +1,73 @@
+package keys
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"authservice/repository"
+)
+
+// countingRedis fails every read and counts them
+type countingRedis struct {
+	repository.RedisQueryer
+	reads int
+}
+
+func (r *countingRedis) GetBytes(ctx context.Context, key string) ([]byte, error) {
+	r.reads++
+	return nil, fmt.Errorf("getBytes: unavailable")
+}
+
+func TestVerificationKeyLimitsReloadsForUnknownKeyIds(t *testing.T) {
+	redis := &countingRedis{}
+	rg, err := newRing("signing", redis, "secret", time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	kr := &keyRing{ring: rg, static: map[string]*Key{}, keys: map[string]*Key{}, loadedAt: time.Now()}
+	for i := 0; i < 100; i++ {
+		_, err = kr.VerificationKey(fmt.Sprintf("forged-%d", i))
+		if err == nil {
+			t.Fatal("unknown key id accepted")
+		}
+	}
+
+	if redis.reads != 1 {
+		t.Fatalf("ring read %d times, want once", redis.reads)
+	}
+
+	kr.missedAt = time.Now().Add(-missReloadInterval)
+	_, _ = kr.VerificationKey("forged")
+	if redis.reads != 2 {
+		t.Fatalf("ring read %d times, want a reload once the interval passed", redis.reads)
+	}
+}
+
+func TestSecretLimitsReloadsForUnknownVersions(t *testing.T) {
+	redis := &countingRedis{}
+	rg, err := newRing("refresh", redis, "secret", time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sr := &secretRing{ring: rg, secrets: map[byte][]byte{1: []byte("secret")}, active: 1, loadedAt: time.Now()}
+	for i := 2; i < 100; i++ {
+		_, ok := sr.Secret(byte(i))
+		if ok {
+			t.Fatal("unknown version accepted")
+		}
+	}
+
+	if redis.reads != 1 {
+		t.Fatalf("ring read %d times, want once", redis.reads)
+	}
+
+	sr.missedAt = time.Now().Add(-missReloadInterval)
+	_, _ = sr.Secret(200)
+	if redis.reads != 2 {
+		t.Fatalf("ring read %d times, want a reload once the interval passed", redis.reads)
+	}
+}
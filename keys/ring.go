@@ -0,0 +1,178 @@
+package keys
+
+import (
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"io"
+	"time"
+
+	"authservice/repository"
+)
+
+// refreshInterval is how often a replica re-reads the ring from redis to pick up rotations done elsewhere
+const refreshInterval = time.Minute
+
+// missReloadInterval is how often at most a token with an unknown key id makes a replica re-read the ring, anyone
+// can send such tokens
+const missReloadInterval = 5 * time.Second
+
+type ringEntry struct {
+	Id        string `json:"id"`
+	Material  []byte `json:"material"`
+	CreatedAt int64  `json:"createdAt"`
+	RetiredAt int64  `json:"retiredAt,omitempty"`
+}
+
+// ring persists a list of key entries in redis, the first entry being the active one.
+// Key material is sealed with AES-GCM so that redis never holds it in plain text.
+type ring struct {
+	name      string
+	redis     repository.RedisQueryer
+	aead      cipher.AEAD
+	retention time.Duration
+}
+
+func newRing(name string, r repository.RedisQueryer, secret string, retention time.Duration) (*ring, error) {
+	key := sha256.Sum256([]byte(secret))
+	block, err := aes.NewCipher(key[:])
+	if err != nil {
+		return nil, fmt.Errorf("newRing: unable to create block: %s", err)
+	}
+
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, fmt.Errorf("newRing: unable to create AEAD: %s", err)
+	}
+
+	return &ring{
+		name:      name,
+		redis:     r,
+		aead:      aead,
+		retention: retention,
+	}, nil
+}
+
+func (r *ring) key() string {
+	return fmt.Sprintf("keyring:%s", r.name)
+}
+
+// seed stores the initial entry unless another replica has already initialised the ring
+func (r *ring) seed(ctx context.Context, id string, material []byte) error {
+	sealed, err := r.seal(material)
+	if err != nil {
+		return fmt.Errorf("seed: %s", err)
+	}
+
+	entries := []ringEntry{{Id: id, Material: sealed, CreatedAt: time.Now().Unix()}}
+	bytes, _ := json.Marshal(entries)
+	_, err = r.redis.SetNX(ctx, r.key(), bytes, 0)
+	if err != nil {
+		return fmt.Errorf("seed: %s", err)
+	}
+
+	return nil
+}
+
+// load returns the entries that are still usable, dropping retired ones past the retention period
+func (r *ring) load(ctx context.Context) ([]ringEntry, error) {
+	bytes, err := r.redis.GetBytes(ctx, r.key())
+	if err != nil {
+		return nil, fmt.Errorf("load: %s", err)
+	}
+
+	var entries []ringEntry
+	err = json.Unmarshal(bytes, &entries)
+	if err != nil {
+		return nil, fmt.Errorf("load: unable to decode ring: %s", err)
+	}
+
+	return r.prune(entries), nil
+}
+
+// rotate retires the active entry and makes the one produced by next the new active entry
+func (r *ring) rotate(ctx context.Context, next func(active ringEntry) (string, []byte, error)) ([]ringEntry, error) {
+	lockKey := fmt.Sprintf("%s:lock", r.key())
+	locked, err := r.redis.SetNX(ctx, lockKey, 1, 30*time.Second)
+	if err != nil {
+		return nil, fmt.Errorf("rotate: %s", err)
+	}
+
+	if !locked {
+		return nil, fmt.Errorf("rotate: another rotation is in progress")
+	}
+
+	defer r.redis.Delete(ctx, lockKey)
+
+	entries, err := r.load(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("rotate: %s", err)
+	}
+
+	if len(entries) == 0 {
+		return nil, fmt.Errorf("rotate: ring is empty")
+	}
+
+	id, material, err := next(entries[0])
+	if err != nil {
+		return nil, fmt.Errorf("rotate: %s", err)
+	}
+
+	sealed, err := r.seal(material)
+	if err != nil {
+		return nil, fmt.Errorf("rotate: %s", err)
+	}
+
+	now := time.Now().Unix()
+	entries[0].RetiredAt = now
+	entries = append([]ringEntry{{Id: id, Material: sealed, CreatedAt: now}}, entries...)
+
+	bytes, _ := json.Marshal(entries)
+	err = r.redis.Set(ctx, r.key(), bytes, 0)
+	if err != nil {
+		return nil, fmt.Errorf("rotate: %s", err)
+	}
+
+	return entries, nil
+}
+
+func (r *ring) prune(entries []ringEntry) []ringEntry {
+	var res []ringEntry
+	cutoff := time.Now().Add(-r.retention).Unix()
+	for index, entry := range entries {
+		if index > 0 && entry.RetiredAt != 0 && entry.RetiredAt < cutoff {
+			continue
+		}
+
+		res = append(res, entry)
+	}
+
+	return res
+}
+
+func (r *ring) seal(material []byte) ([]byte, error) {
+	nonce := make([]byte, r.aead.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return nil, fmt.Errorf("seal: unable to read nonce: %s", err)
+	}
+
+	return r.aead.Seal(nonce, nonce, material, []byte(r.name)), nil
+}
+
+func (r *ring) open(sealed []byte) ([]byte, error) {
+	size := r.aead.NonceSize()
+	if len(sealed) < size {
+		return nil, fmt.Errorf("open: sealed material too short")
+	}
+
+	material, err := r.aead.Open(nil, sealed[:size], sealed[size:], []byte(r.name))
+	if err != nil {
+		return nil, fmt.Errorf("open: unable to open sealed material: %s", err)
+	}
+
+	return material, nil
+}
@@ -0,0 +1,182 @@
+package keys
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"fmt"
+	"io"
+	"strconv"
+	"sync"
+	"time"
+
+	"authservice/repository"
+)
+
+const secretLength = 32
+
+// SecretSet holds the symmetric secrets used to encrypt refresh tokens. Every token is prefixed with
+// the version byte of the secret it was encrypted with so that retired secrets can still decrypt it.
+type SecretSet interface {
+	ActiveSecret() (byte, []byte)
+	Secret(version byte) ([]byte, bool)
+	Rotate(ctx context.Context) (byte, error)
+}
+
+type secretRing struct {
+	ring *ring
+
+	mu       sync.RWMutex
+	active   byte
+	secrets  map[byte][]byte
+	loadedAt time.Time
+	missedAt time.Time
+}
+
+// LoadSecretSet builds the refresh secret ring, seeding it with a key derived from seedSecret the first time it is used
+func LoadSecretSet(ctx context.Context, r repository.RedisQueryer, seedSecret, secret string, retention time.Duration) (SecretSet, error) {
+	rg, err := newRing("refresh", r, secret, retention)
+	if err != nil {
+		return nil, fmt.Errorf("loadSecretSet: %s", err)
+	}
+
+	seed := sha256.Sum256([]byte(seedSecret))
+	err = rg.seed(ctx, "1", seed[:])
+	if err != nil {
+		return nil, fmt.Errorf("loadSecretSet: %s", err)
+	}
+
+	sr := &secretRing{ring: rg}
+	err = sr.reload(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("loadSecretSet: %s", err)
+	}
+
+	return sr, nil
+}
+
+func (s *secretRing) reload(ctx context.Context) error {
+	entries, err := s.ring.load(ctx)
+	if err != nil {
+		return fmt.Errorf("reload: %s", err)
+	}
+
+	return s.apply(entries)
+}
+
+func (s *secretRing) apply(entries []ringEntry) error {
+	secrets := map[byte][]byte{}
+	var active byte
+	for index, entry := range entries {
+		version, err := strconv.ParseUint(entry.Id, 10, 8)
+		if err != nil {
+			return fmt.Errorf("apply: invalid secret version %s", entry.Id)
+		}
+
+		material, err := s.ring.open(entry.Material)
+		if err != nil {
+			return fmt.Errorf("apply: secret %s: %s", entry.Id, err)
+		}
+
+		if index == 0 {
+			active = byte(version)
+		}
+
+		if _, ok := secrets[byte(version)]; !ok {
+			secrets[byte(version)] = material
+		}
+	}
+
+	if len(secrets) == 0 {
+		return fmt.Errorf("apply: no refresh secret available")
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.active = active
+	s.secrets = secrets
+	s.loadedAt = time.Now()
+
+	return nil
+}
+
+func (s *secretRing) refresh() {
+	s.mu.RLock()
+	stale := time.Since(s.loadedAt) > refreshInterval
+	s.mu.RUnlock()
+	if stale {
+		_ = s.reload(context.Background())
+	}
+}
+
+func (s *secretRing) ActiveSecret() (byte, []byte) {
+	s.refresh()
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.active, s.secrets[s.active]
+}
+
+func (s *secretRing) Secret(version byte) ([]byte, bool) {
+	s.refresh()
+
+	if secret, ok := s.lookup(version); ok {
+		return secret, true
+	}
+
+	if !s.reloadOnMiss() {
+		return nil, false
+	}
+
+	_ = s.reload(context.Background())
+	return s.lookup(version)
+}
+
+// reloadOnMiss reports whether an unknown version may reload the ring, which it may once per missReloadInterval
+func (s *secretRing) reloadOnMiss() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if time.Since(s.missedAt) < missReloadInterval {
+		return false
+	}
+
+	s.missedAt = time.Now()
+	return true
+}
+
+func (s *secretRing) lookup(version byte) ([]byte, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	secret, ok := s.secrets[version]
+
+	return secret, ok
+}
+
+// Rotate generates a new random secret with the next version number, wrapping around after 255.
+func (s *secretRing) Rotate(ctx context.Context) (byte, error) {
+	var next byte
+	entries, err := s.ring.rotate(ctx, func(active ringEntry) (string, []byte, error) {
+		version, err := strconv.ParseUint(active.Id, 10, 8)
+		if err != nil {
+			return "", nil, fmt.Errorf("invalid secret version %s", active.Id)
+		}
+
+		next = byte(version%255) + 1
+		secret := make([]byte, secretLength)
+		if _, err := io.ReadFull(rand.Reader, secret); err != nil {
+			return "", nil, fmt.Errorf("unable to generate secret: %s", err)
+		}
+
+		return strconv.Itoa(int(next)), secret, nil
+	})
+	if err != nil {
+		return 0, fmt.Errorf("rotate: %s", err)
+	}
+
+	err = s.apply(s.ring.prune(entries))
+	if err != nil {
+		return 0, fmt.Errorf("rotate: %s", err)
+	}
+
+	return next, nil
+}
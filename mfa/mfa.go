@@ -0,0 +1,462 @@
+package mfa
+
+import (
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base32"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"authservice/builder"
+	"authservice/constant"
+	"authservice/helper"
+	"authservice/models"
+	"authservice/repository"
+	"authservice/totp"
+)
+
+const (
+	recoveryCodeCount    = 10
+	recoveryCodeSize     = 10
+	challengeLifetime    = 5 * time.Minute
+	maxChallengeAttempts = 5
+	maxCodeAttempts      = 10
+	codeAttemptWindow    = 15 * time.Minute
+)
+
+type MFA interface {
+	IsEnabled(ctx context.Context, userId string) (bool, error)
+	EnrollTOTP(ctx context.Context, userId, account string) (*models.TOTPEnrollment, error)
+	ConfirmTOTP(ctx context.Context, userId, code string) (*models.RecoveryCodes, error)
+	DisableTOTP(ctx context.Context, userId, code string) error
+	RegenerateRecoveryCodes(ctx context.Context, userId, code string) (*models.RecoveryCodes, error)
+	Verify(ctx context.Context, userId, code string) error
+	Challenge(ctx context.Context, userId, clientId string, methods []string) (*models.MFAChallenge, error)
+	ReadChallenge(token string) (*models.MFAChallengeClaims, error)
+	OpenChallenge(ctx context.Context, token string) (*models.MFAChallengeClaims, error)
+	CloseChallenge(ctx context.Context, claims *models.MFAChallengeClaims) error
+}
+
+type mfa struct {
+	builder  builder.MFABuilder
+	postgres repository.PostgresQueryer
+	redis    repository.RedisQueryer
+	helper   helper.Helper
+	issuer   string
+	aead     cipher.AEAD
+}
+
+// NewMFA creates the second factor service, TOTP secrets are sealed with a key derived from secret before they are stored
+func NewMFA(b builder.MFABuilder, p repository.PostgresQueryer, r repository.RedisQueryer, h helper.Helper, issuer,
+	secret string) (MFA, error) {
+	key := sha256.Sum256([]byte(fmt.Sprintf("totp:%s", secret)))
+	block, err := aes.NewCipher(key[:])
+	if err != nil {
+		return nil, fmt.Errorf("newMFA: unable to create block: %s", err)
+	}
+
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, fmt.Errorf("newMFA: unable to create AEAD: %s", err)
+	}
+
+	return &mfa{
+		builder:  b,
+		postgres: p,
+		redis:    r,
+		helper:   h,
+		issuer:   issuer,
+		aead:     aead,
+	}, nil
+}
+
+func (m *mfa) getTOTP(ctx context.Context, userId string) (*models.TOTP, error) {
+	res, err := m.postgres.QueryScan(ctx, m.builder.GetTOTP(), userId)
+	if err != nil {
+		return nil, fmt.Errorf("getTOTP: unable to fetch TOTP: %s", err)
+	}
+
+	defer res.Close()
+	if !res.Next() {
+		return nil, nil
+	}
+
+	var t models.TOTP
+	err = res.Scan(&t)
+	if err != nil {
+		return nil, fmt.Errorf("getTOTP: unable to decode TOTP: %s", err)
+	}
+
+	return &t, nil
+}
+
+func (m *mfa) IsEnabled(ctx context.Context, userId string) (bool, error) {
+	t, err := m.getTOTP(ctx, userId)
+	if err != nil {
+		return false, fmt.Errorf("isEnabled: %s", err)
+	}
+
+	return t != nil && t.Confirmed, nil
+}
+
+// EnrollTOTP starts a new enrollment, replacing any earlier one that was never confirmed
+func (m *mfa) EnrollTOTP(ctx context.Context, userId, account string) (*models.TOTPEnrollment, error) {
+	secret, err := totp.GenerateSecret()
+	if err != nil {
+		return nil, fmt.Errorf("enrollTOTP: %s", err)
+	}
+
+	sealed, err := m.seal([]byte(secret))
+	if err != nil {
+		return nil, fmt.Errorf("enrollTOTP: %s", err)
+	}
+
+	affected, err := m.postgres.Exec(ctx, m.builder.UpsertTOTP(), userId, sealed)
+	if err != nil {
+		return nil, fmt.Errorf("enrollTOTP: unable to save TOTP: %s", err)
+	}
+
+	if affected == 0 {
+		return nil, fmt.Errorf("enrollTOTP: %w", models.ErrMFAAlreadyEnabled)
+	}
+
+	return &models.TOTPEnrollment{
+		Secret: secret,
+		URI:    totp.URI(m.issuer, account, secret),
+	}, nil
+}
+
+// ConfirmTOTP enables TOTP once the user proves their authenticator produces valid codes and hands out recovery codes
+func (m *mfa) ConfirmTOTP(ctx context.Context, userId, code string) (*models.RecoveryCodes, error) {
+	t, err := m.getTOTP(ctx, userId)
+	if err != nil {
+		return nil, fmt.Errorf("confirmTOTP: %s", err)
+	}
+
+	if t == nil {
+		return nil, fmt.Errorf("confirmTOTP: %w", models.ErrMFANotEnrolled)
+	}
+
+	if t.Confirmed {
+		return nil, fmt.Errorf("confirmTOTP: %w", models.ErrMFAAlreadyEnabled)
+	}
+
+	err = m.countAttempt(ctx, userId)
+	if err != nil {
+		return nil, fmt.Errorf("confirmTOTP: %w", err)
+	}
+
+	step, valid, err := m.validateTOTP(t, code)
+	if err != nil {
+		return nil, fmt.Errorf("confirmTOTP: %s", err)
+	}
+
+	if !valid {
+		return nil, fmt.Errorf("confirmTOTP: %w", models.ErrInvalidMFACode)
+	}
+
+	m.clearAttempts(ctx, userId)
+
+	var codes *models.RecoveryCodes
+	err = m.postgres.WithTx(ctx, func(tx repository.PostgresQueryer) error {
+		_, err := tx.Exec(ctx, m.builder.ConfirmTOTP(), userId, step)
+		if err != nil {
+			return fmt.Errorf("unable to confirm TOTP: %s", err)
+		}
+
+		codes, err = m.replaceRecoveryCodes(ctx, tx, userId)
+		return err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("confirmTOTP: %s", err)
+	}
+
+	m.publish(ctx, constant.EventMFAEnabled, userId)
+	return codes, nil
+}
+
+func (m *mfa) DisableTOTP(ctx context.Context, userId, code string) error {
+	err := m.Verify(ctx, userId, code)
+	if err != nil {
+		return fmt.Errorf("disableTOTP: %w", err)
+	}
+
+	err = m.postgres.WithTx(ctx, func(tx repository.PostgresQueryer) error {
+		_, err := tx.Exec(ctx, m.builder.DeleteTOTP(), userId)
+		if err != nil {
+			return fmt.Errorf("unable to delete TOTP: %s", err)
+		}
+
+		_, err = tx.Exec(ctx, m.builder.DeleteRecoveryCodes(), userId)
+		if err != nil {
+			return fmt.Errorf("unable to delete recovery codes: %s", err)
+		}
+
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("disableTOTP: %s", err)
+	}
+
+	m.publish(ctx, constant.EventMFADisabled, userId)
+	return nil
+}
+
+func (m *mfa) RegenerateRecoveryCodes(ctx context.Context, userId, code string) (*models.RecoveryCodes, error) {
+	err := m.Verify(ctx, userId, code)
+	if err != nil {
+		return nil, fmt.Errorf("regenerateRecoveryCodes: %w", err)
+	}
+
+	var codes *models.RecoveryCodes
+	err = m.postgres.WithTx(ctx, func(tx repository.PostgresQueryer) error {
+		codes, err = m.replaceRecoveryCodes(ctx, tx, userId)
+		return err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("regenerateRecoveryCodes: %s", err)
+	}
+
+	return codes, nil
+}
+
+// Verify accepts either a current TOTP code or an unused recovery code, both of them work only once. Every code
+// counts against the user, so a user failing too many of them is locked out whatever challenge they come with.
+func (m *mfa) Verify(ctx context.Context, userId, code string) error {
+	t, err := m.getTOTP(ctx, userId)
+	if err != nil {
+		return fmt.Errorf("verify: %s", err)
+	}
+
+	if t == nil || !t.Confirmed {
+		return fmt.Errorf("verify: %w", models.ErrMFANotEnrolled)
+	}
+
+	err = m.countAttempt(ctx, userId)
+	if err != nil {
+		return fmt.Errorf("verify: %w", err)
+	}
+
+	code = strings.TrimSpace(code)
+	if len(code) == totp.Digits {
+		step, valid, err := m.validateTOTP(t, code)
+		if err != nil {
+			return fmt.Errorf("verify: %s", err)
+		}
+
+		if !valid {
+			return fmt.Errorf("verify: %w", models.ErrInvalidMFACode)
+		}
+
+		affected, err := m.postgres.Exec(ctx, m.builder.UseTOTPStep(), userId, step)
+		if err != nil {
+			return fmt.Errorf("verify: unable to record TOTP use: %s", err)
+		}
+
+		if affected == 0 {
+			return fmt.Errorf("verify: %w", models.ErrInvalidMFACode)
+		}
+
+		m.clearAttempts(ctx, userId)
+		return nil
+	}
+
+	affected, err := m.postgres.Exec(ctx, m.builder.UseRecoveryCode(), userId, hashRecoveryCode(code))
+	if err != nil {
+		return fmt.Errorf("verify: unable to use recovery code: %s", err)
+	}
+
+	if affected == 0 {
+		return fmt.Errorf("verify: %w", models.ErrInvalidMFACode)
+	}
+
+	m.clearAttempts(ctx, userId)
+	m.publish(ctx, constant.EventRecoveryCodeUsed, userId)
+	return nil
+}
+
+// countAttempt counts a code attempt against the user before the code is checked and refuses it once the user
+// used up their attempts. The count outlives challenges, asking for a new one does not buy more guesses.
+func (m *mfa) countAttempt(ctx context.Context, userId string) error {
+	err := m.redis.Update(ctx, attemptsKey(userId), codeAttemptWindow, func(value []byte) ([]byte, error) {
+		attempts, _ := strconv.Atoi(string(value))
+		if attempts >= maxCodeAttempts {
+			return nil, models.ErrTooManyAttempts
+		}
+
+		return []byte(strconv.Itoa(attempts + 1)), nil
+	})
+	if err != nil {
+		return fmt.Errorf("countAttempt: %w", err)
+	}
+
+	return nil
+}
+
+func (m *mfa) clearAttempts(ctx context.Context, userId string) {
+	_ = m.redis.Delete(ctx, attemptsKey(userId))
+}
+
+func (m *mfa) validateTOTP(t *models.TOTP, code string) (int64, bool, error) {
+	secret, err := m.open(t.Secret)
+	if err != nil {
+		return 0, false, fmt.Errorf("validateTOTP: %s", err)
+	}
+
+	step, valid := totp.Validate(string(secret), code, time.Now(), t.LastUsedStep)
+	return step, valid, nil
+}
+
+func (m *mfa) replaceRecoveryCodes(ctx context.Context, tx repository.PostgresQueryer, userId string) (*models.RecoveryCodes, error) {
+	codes := make([]string, recoveryCodeCount)
+	hashes := make([]string, recoveryCodeCount)
+	for i := range codes {
+		code, err := newRecoveryCode()
+		if err != nil {
+			return nil, err
+		}
+
+		codes[i] = code
+		hashes[i] = hashRecoveryCode(code)
+	}
+
+	_, err := tx.Exec(ctx, m.builder.DeleteRecoveryCodes(), userId)
+	if err != nil {
+		return nil, fmt.Errorf("unable to delete recovery codes: %s", err)
+	}
+
+	_, err = tx.Exec(ctx, m.builder.AddRecoveryCodes(), userId, hashes)
+	if err != nil {
+		return nil, fmt.Errorf("unable to save recovery codes: %s", err)
+	}
+
+	return &models.RecoveryCodes{Codes: codes}, nil
+}
+
+// Challenge issues the token that carries a password login over to the second factor step
+func (m *mfa) Challenge(ctx context.Context, userId, clientId string, methods []string) (*models.MFAChallenge, error) {
+	expiry := time.Now().Add(challengeLifetime)
+	token, err := m.helper.Sign(constant.PurposeMFAChallenge, &models.MFAChallengeClaims{
+		Id:       m.helper.NewId(),
+		UserId:   userId,
+		ClientId: clientId,
+	}, expiry)
+	if err != nil {
+		return nil, fmt.Errorf("challenge: unable to sign challenge: %s", err)
+	}
+
+	return &models.MFAChallenge{
+		Token:     token,
+		Methods:   methods,
+		ExpiresAt: expiry.Unix(),
+	}, nil
+}
+
+// ReadChallenge validates the challenge token without counting an attempt
+func (m *mfa) ReadChallenge(token string) (*models.MFAChallengeClaims, error) {
+	var claims models.MFAChallengeClaims
+	err := m.helper.VerifySigned(constant.PurposeMFAChallenge, token, &claims)
+	if err != nil {
+		return nil, fmt.Errorf("readChallenge: %w: %s", models.ErrInvalidMFAChallenge, err)
+	}
+
+	return &claims, nil
+}
+
+// OpenChallenge validates the challenge token and counts an attempt against it, a challenge allows a
+// handful of attempts and none once it has been completed
+func (m *mfa) OpenChallenge(ctx context.Context, token string) (*models.MFAChallengeClaims, error) {
+	claims, err := m.ReadChallenge(token)
+	if err != nil {
+		return nil, fmt.Errorf("openChallenge: %w", err)
+	}
+
+	err = m.redis.Update(ctx, challengeKey(claims.Id), challengeLifetime, func(value []byte) ([]byte, error) {
+		attempts, _ := strconv.Atoi(string(value))
+		if attempts >= maxChallengeAttempts {
+			return nil, models.ErrTooManyAttempts
+		}
+
+		return []byte(strconv.Itoa(attempts + 1)), nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("openChallenge: %w", err)
+	}
+
+	return claims, nil
+}
+
+func (m *mfa) CloseChallenge(ctx context.Context, claims *models.MFAChallengeClaims) error {
+	err := m.redis.Set(ctx, challengeKey(claims.Id), maxChallengeAttempts, challengeLifetime)
+	if err != nil {
+		return fmt.Errorf("closeChallenge: %s", err)
+	}
+
+	return nil
+}
+
+func (m *mfa) publish(ctx context.Context, event, userId string) {
+	_ = m.helper.PublishSecurityEvent(ctx, &models.SecurityEvent{
+		Type:   event,
+		UserId: userId,
+		Time:   time.Now().UnixMilli(),
+	})
+}
+
+func (m *mfa) seal(secret []byte) ([]byte, error) {
+	nonce := make([]byte, m.aead.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return nil, fmt.Errorf("seal: unable to read nonce: %s", err)
+	}
+
+	return m.aead.Seal(nonce, nonce, secret, nil), nil
+}
+
+func (m *mfa) open(sealed []byte) ([]byte, error) {
+	size := m.aead.NonceSize()
+	if len(sealed) < size {
+		return nil, fmt.Errorf("open: sealed secret too short")
+	}
+
+	secret, err := m.aead.Open(nil, sealed[:size], sealed[size:], nil)
+	if err != nil {
+		return nil, fmt.Errorf("open: unable to open sealed secret: %s", err)
+	}
+
+	return secret, nil
+}
+
+func challengeKey(id string) string {
+	return fmt.Sprintf("mfa-challenge:%s", id)
+}
+
+func attemptsKey(userId string) string {
+	return fmt.Sprintf("mfa-attempts:%s", userId)
+}
+
+// newRecoveryCode returns a code like "abcde-fghij" carrying 80 bits of randomness
+func newRecoveryCode() (string, error) {
+	b := make([]byte, recoveryCodeSize)
+	if _, err := io.ReadFull(rand.Reader, b); err != nil {
+		return "", fmt.Errorf("unable to generate recovery code: %s", err)
+	}
+
+	code := strings.ToLower(base32.StdEncoding.EncodeToString(b))
+	return fmt.Sprintf("%s-%s", code[:8], code[8:]), nil
+}
+
+// hashRecoveryCode normalises the code as users type it and hashes it, recovery codes have too much entropy
+// to be brute forced so a fast hash is enough and lets them be looked up directly
+func hashRecoveryCode(code string) string {
+	code = strings.ToLower(strings.NewReplacer("-", "", " ", "").Replace(code))
+	sum := sha256.Sum256([]byte(code))
+
+	return hex.EncodeToString(sum[:])
+}
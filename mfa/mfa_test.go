@@ -0,0 +1,146 @@
+package mfa
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"authservice/builder"
+	"authservice/models"
+	"authservice/repository"
+	"authservice/totp"
+)
+
+// memoryRedis keeps the keys in a map, time outs are ignored
+type memoryRedis struct {
+	repository.RedisQueryer
+	values map[string][]byte
+}
+
+func (r *memoryRedis) Update(ctx context.Context, key string, timeOut time.Duration, update func(value []byte) ([]byte, error)) error {
+	value, err := update(r.values[key])
+	if err != nil {
+		return fmt.Errorf("update: %w", err)
+	}
+
+	if value != nil {
+		r.values[key] = value
+	}
+
+	return nil
+}
+
+func (r *memoryRedis) Delete(ctx context.Context, keys ...string) error {
+	for _, key := range keys {
+		delete(r.values, key)
+	}
+
+	return nil
+}
+
+// totpPostgres answers every query with one confirmed TOTP, and every update as applied
+type totpPostgres struct {
+	repository.PostgresQueryer
+	totp *models.TOTP
+}
+
+func (p *totpPostgres) QueryScan(ctx context.Context, query string, params ...interface{}) (repository.PgResult, error) {
+	return &totpResult{totp: p.totp}, nil
+}
+
+func (p *totpPostgres) Exec(ctx context.Context, query string, params ...interface{}) (int64, error) {
+	return 1, nil
+}
+
+type totpResult struct {
+	repository.PgResult
+	totp *models.TOTP
+	read bool
+}
+
+func (r *totpResult) Next() bool {
+	next := !r.read
+	r.read = true
+	return next
+}
+
+func (r *totpResult) Scan(dst interface{}) error {
+	*dst.(*models.TOTP) = *r.totp
+	return nil
+}
+
+func (r *totpResult) Close() {}
+
+func newTestMFA(t *testing.T) (*mfa, *memoryRedis, string) {
+	t.Helper()
+	secret, err := totp.GenerateSecret()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	redis := &memoryRedis{values: map[string][]byte{}}
+	postgres := &totpPostgres{totp: &models.TOTP{Confirmed: true}}
+	m, err := NewMFA(builder.NewMFABuilder(), postgres, redis, nil, "test", "secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	postgres.totp.Secret, err = m.(*mfa).seal([]byte(secret))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return m.(*mfa), redis, secret
+}
+
+func currentCode(t *testing.T, secret string) string {
+	t.Helper()
+	code, err := totp.Code(secret, totp.Step(time.Now()))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return code
+}
+
+func wrongCode(t *testing.T, secret string) string {
+	t.Helper()
+	code := currentCode(t, secret)
+	return code[:5] + string('0'+(code[5]-'0'+1)%10)
+}
+
+func TestVerifyLocksOutUserAcrossChallenges(t *testing.T) {
+	m, _, secret := newTestMFA(t)
+	ctx := context.Background()
+	for i := 0; i < maxCodeAttempts; i++ {
+		err := m.Verify(ctx, "user", wrongCode(t, secret))
+		if !errors.Is(err, models.ErrInvalidMFACode) {
+			t.Fatalf("attempt %d: got %v, want an invalid code", i+1, err)
+		}
+	}
+
+	// a new challenge goes through Verify all the same, so even the right code is refused now
+	err := m.Verify(ctx, "user", currentCode(t, secret))
+	if !errors.Is(err, models.ErrTooManyAttempts) {
+		t.Fatalf("got %v, want too many attempts", err)
+	}
+}
+
+func TestVerifyClearsAttemptsOnSuccess(t *testing.T) {
+	m, redis, secret := newTestMFA(t)
+	ctx := context.Background()
+	for i := 0; i < maxCodeAttempts-1; i++ {
+		_ = m.Verify(ctx, "user", wrongCode(t, secret))
+	}
+
+	err := m.Verify(ctx, "user", currentCode(t, secret))
+	if err != nil {
+		t.Fatalf("got %v, want the current code accepted", err)
+	}
+
+	if _, found := redis.values[attemptsKey("user")]; found {
+		t.Fatal("attempts kept after a successful code")
+	}
+}
@@ -0,0 +1,43 @@
+package middleware
+
+import (
+	"crypto/subtle"
+	"net/http"
+
+	"github.com/sirupsen/logrus"
+
+	"authservice/response"
+)
+
+type AdminValidator struct {
+	apiKey string
+	logger *logrus.Logger
+}
+
+func NewAdminValidator(l *logrus.Logger, apiKey string) *AdminValidator {
+	return &AdminValidator{
+		apiKey: apiKey,
+		logger: l,
+	}
+}
+
+// ValidateAdmin only lets requests carrying the configured admin API key through, admin routes are
+// disabled altogether when no key is configured
+func (a *AdminValidator) ValidateAdmin(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if a.apiKey == "" {
+			a.logger.Errorf("ValidateAdmin: admin API key is not configured")
+			response.Error{Error: "forbidden"}.Forbidden(w)
+			return
+		}
+
+		apiKey := r.Header.Get("X-Api-Key")
+		if subtle.ConstantTimeCompare([]byte(apiKey), []byte(a.apiKey)) != 1 {
+			a.logger.Errorf("ValidateAdmin: invalid admin API key")
+			response.Error{Error: "forbidden"}.Forbidden(w)
+			return
+		}
+
+		next(w, r)
+	}
+}
@@ -0,0 +1,84 @@
+package middleware
+
+import (
+	"net/http"
+
+	"github.com/sirupsen/logrus"
+
+	"authservice/client"
+	"authservice/response"
+)
+
+type ClientValidator struct {
+	clients client.Registry
+	logger  *logrus.Logger
+}
+
+func NewClientValidator(l *logrus.Logger, c client.Registry) *ClientValidator {
+	return &ClientValidator{
+		clients: c,
+		logger:  l,
+	}
+}
+
+// ValidateClient authenticates a confidential client using HTTP basic auth or the client_id and
+// client_secret form parameters
+func (c *ClientValidator) ValidateClient(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		clientId, clientSecret, ok := r.BasicAuth()
+		if !ok {
+			clientId = r.PostFormValue("client_id")
+			clientSecret = r.PostFormValue("client_secret")
+		}
+
+		cl, err := c.clients.Authenticate(clientId, clientSecret)
+		if err != nil {
+			c.logger.Errorf("ValidateClient: unable to authenticate client: %s", err)
+			w.Header().Set("WWW-Authenticate", `Basic realm="authservice"`)
+			response.Error{Error: "invalid_client"}.UnAuthorized(w)
+			return
+		}
+
+		r.Header.Set("clientId", cl.Id)
+		next(w, r)
+	}
+}
+
+// IdentifyClient is the lenient variant of ValidateClient for endpoints that public clients may call too.
+// Credentials are verified when present, a bare client_id must belong to a registered public client and requests
+// without any client information are let through anonymously.
+func (c *ClientValidator) IdentifyClient(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		r.Header.Del("clientId")
+		clientId, clientSecret, ok := r.BasicAuth()
+		if !ok {
+			clientId = r.PostFormValue("client_id")
+			clientSecret = r.PostFormValue("client_secret")
+		}
+
+		if clientSecret != "" {
+			c.ValidateClient(next)(w, r)
+			return
+		}
+
+		if clientId != "" {
+			cl, found := c.clients.Get(clientId)
+			if !found {
+				c.logger.Errorf("IdentifyClient: unknown client '%s'", clientId)
+				response.Error{Error: "invalid_client"}.UnAuthorized(w)
+				return
+			}
+
+			if cl.IsConfidential() {
+				c.logger.Errorf("IdentifyClient: client '%s' sent no secret", clientId)
+				w.Header().Set("WWW-Authenticate", `Basic realm="authservice"`)
+				response.Error{Error: "invalid_client"}.UnAuthorized(w)
+				return
+			}
+
+			r.Header.Set("clientId", clientId)
+		}
+
+		next(w, r)
+	}
+}
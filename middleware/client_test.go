@@ -0,0 +1,68 @@
+package middleware
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+
+	"authservice/client"
+	"authservice/models"
+)
+
+func TestIdentifyClientRequiresSecretOfConfidentialClients(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "clients.json")
+	err := os.WriteFile(file, []byte(`[{"id": "backend", "secret": "secret"}, {"id": "app"}]`), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	clients, err := client.LoadRegistry(file, models.TokenLifetime{AccessTokenTTL: time.Minute,
+		RefreshTokenTTL: time.Hour, SessionMaxLifetime: time.Hour})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name     string
+		form     url.Values
+		status   int
+		clientId string
+	}{
+		{"confidential client without secret", url.Values{"client_id": {"backend"}}, http.StatusUnauthorized, ""},
+		{"confidential client with wrong secret", url.Values{"client_id": {"backend"}, "client_secret": {"wrong"}}, http.StatusUnauthorized, ""},
+		{"confidential client with secret", url.Values{"client_id": {"backend"}, "client_secret": {"secret"}}, http.StatusOK, "backend"},
+		{"public client", url.Values{"client_id": {"app"}}, http.StatusOK, "app"},
+		{"unknown client", url.Values{"client_id": {"other"}}, http.StatusUnauthorized, ""},
+		{"anonymous", url.Values{}, http.StatusOK, ""},
+	}
+
+	l := logrus.New()
+	l.SetOutput(io.Discard)
+	validator := NewClientValidator(l, clients)
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			clientId := ""
+			handler := validator.IdentifyClient(func(w http.ResponseWriter, r *http.Request) {
+				clientId = r.Header.Get("clientId")
+			})
+
+			r := httptest.NewRequest(http.MethodPost, "/oauth/token", strings.NewReader(test.form.Encode()))
+			r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+			r.Header.Set("clientId", "backend")
+			w := httptest.NewRecorder()
+			handler(w, r)
+
+			if w.Code != test.status || clientId != test.clientId {
+				t.Fatalf("status %d for client '%s', want %d for '%s'", w.Code, clientId, test.status, test.clientId)
+			}
+		})
+	}
+}
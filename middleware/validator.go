@@ -19,13 +19,16 @@ type TokenValidator struct {
 
 func NewTokenValidator(l *logrus.Logger, a auth.Authorizer) *TokenValidator {
 	return &TokenValidator{
-		auth: a,
+		auth:   a,
 		logger: l,
 	}
 }
 
 func (t *TokenValidator) ValidateToken(next http.HandlerFunc) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
+		// the handlers trust these headers, so whatever the client sent in them is dropped
+		r.Header.Del("userId")
+		r.Header.Del("userName")
 		vars := mux.Vars(r)
 		userId, ok := vars["userId"]
 		if !ok {
@@ -56,8 +59,8 @@ func (t *TokenValidator) ValidateToken(next http.HandlerFunc) http.HandlerFunc {
 			return
 		}
 
-		r.Header.Add("userId", decodedUserId)
-		r.Header.Add("userName", fmt.Sprintf("%s", claims["name"]))
+		r.Header.Set("userId", decodedUserId)
+		r.Header.Set("userName", fmt.Sprintf("%s", claims["name"]))
 		next(w, r)
 	}
-}
\ No newline at end of file
+}
@@ -0,0 +1,95 @@
+package middleware
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gorilla/mux"
+	"github.com/sirupsen/logrus"
+
+	"authservice/auth"
+)
+
+type fakeAuthorizer struct {
+	auth.Authorizer
+	userId string
+}
+
+func (a *fakeAuthorizer) ValidateBearerToken(ctx context.Context, token string) (map[string]interface{}, error) {
+	if token != "Bearer valid" {
+		return nil, fmt.Errorf("invalid token")
+	}
+
+	return map[string]interface{}{"id": a.userId, "name": "Attacker"}, nil
+}
+
+func TestValidateTokenScopesToTokenUser(t *testing.T) {
+	tests := []struct {
+		name   string
+		method string
+		path   string
+		vars   map[string]string
+		token  string
+		status int
+	}{
+		{"sessions", http.MethodGet, "/users/attacker/sessions", map[string]string{"userId": "attacker"}, "Bearer valid", http.StatusOK},
+		{"session", http.MethodDelete, "/users/attacker/sessions/s1", map[string]string{"userId": "attacker", "sessionId": "s1"}, "Bearer valid", http.StatusOK},
+		{"identities", http.MethodGet, "/users/attacker/identities", map[string]string{"userId": "attacker"}, "Bearer valid", http.StatusOK},
+		{"identity", http.MethodDelete, "/users/attacker/identities/i1", map[string]string{"userId": "attacker", "identityId": "i1"}, "Bearer valid", http.StatusOK},
+		{"totp", http.MethodPost, "/users/attacker/mfa/totp", map[string]string{"userId": "attacker"}, "Bearer valid", http.StatusOK},
+		{"recovery codes", http.MethodPost, "/users/attacker/mfa/recovery-codes", map[string]string{"userId": "attacker"}, "Bearer valid", http.StatusOK},
+		{"passkeys", http.MethodGet, "/users/attacker/passkeys", map[string]string{"userId": "attacker"}, "Bearer valid", http.StatusOK},
+		{"deactivate", http.MethodPost, "/users/attacker/deactivate", map[string]string{"userId": "attacker"}, "Bearer valid", http.StatusOK},
+		{"other user's path", http.MethodGet, "/users/victim/sessions", map[string]string{"userId": "victim"}, "Bearer valid", http.StatusForbidden},
+		{"invalid token", http.MethodGet, "/users/victim/sessions", map[string]string{"userId": "victim"}, "Bearer forged", http.StatusUnauthorized},
+		{"missing token", http.MethodGet, "/users/victim/sessions", map[string]string{"userId": "victim"}, "", http.StatusUnauthorized},
+	}
+
+	l := logrus.New()
+	l.SetOutput(io.Discard)
+	validator := NewTokenValidator(l, &fakeAuthorizer{userId: "attacker"})
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var userIds, userNames []string
+			called := false
+			handler := validator.ValidateToken(func(w http.ResponseWriter, r *http.Request) {
+				called = true
+				userIds = r.Header.Values("userId")
+				userNames = r.Header.Values("userName")
+			})
+
+			r := httptest.NewRequest(test.method, test.path, nil)
+			r = mux.SetURLVars(r, test.vars)
+			if test.token != "" {
+				r.Header.Set("Authorization", test.token)
+			}
+			r.Header.Add("userId", "victim")
+			r.Header.Add("userName", "Victim")
+			w := httptest.NewRecorder()
+			handler(w, r)
+
+			if w.Code != test.status {
+				t.Fatalf("status %d, want %d", w.Code, test.status)
+			}
+
+			if test.status != http.StatusOK {
+				if called {
+					t.Fatalf("handler called for a rejected request")
+				}
+				return
+			}
+
+			if len(userIds) != 1 || userIds[0] != "attacker" {
+				t.Fatalf("userId headers %v, want only the token's user", userIds)
+			}
+
+			if len(userNames) != 1 || userNames[0] != "Attacker" {
+				t.Fatalf("userName headers %v, want only the token's name", userNames)
+			}
+		})
+	}
+}
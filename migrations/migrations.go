@@ -0,0 +1,287 @@
+package migrations
+
+import (
+	"context"
+	"embed"
+	"fmt"
+	"io/fs"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	pg "github.com/jackc/pgx/v4/pgxpool"
+)
+
+//go:embed sql/*.sql
+var files embed.FS
+
+// lockId is the key of the advisory lock held while migrating so that replicas starting together do not race
+const lockId = 7283541
+
+type Migration struct {
+	Version int
+	Name    string
+	Up      string
+	Down    string
+}
+
+type Status struct {
+	Version   int
+	Name      string
+	AppliedAt *time.Time
+}
+
+type Migrator interface {
+	Up(ctx context.Context) ([]*Migration, error)
+	Down(ctx context.Context, steps int) ([]*Migration, error)
+	Status(ctx context.Context) ([]*Status, error)
+}
+
+type migrator struct {
+	pool       *pg.Pool
+	migrations []*Migration
+}
+
+func NewMigrator(p *pg.Pool) (Migrator, error) {
+	migrations, err := load()
+	if err != nil {
+		return nil, fmt.Errorf("newMigrator: %s", err)
+	}
+
+	return &migrator{
+		pool:       p,
+		migrations: migrations,
+	}, nil
+}
+
+// load reads the embedded migrations named <version>_<name>.up.sql and <version>_<name>.down.sql in version order
+func load() ([]*Migration, error) {
+	entries, err := fs.ReadDir(files, "sql")
+	if err != nil {
+		return nil, fmt.Errorf("load: unable to read migrations: %s", err)
+	}
+
+	byVersion := map[int]*Migration{}
+	for _, entry := range entries {
+		name := entry.Name()
+		direction := ""
+		switch {
+		case strings.HasSuffix(name, ".up.sql"):
+			direction = "up"
+		case strings.HasSuffix(name, ".down.sql"):
+			direction = "down"
+		default:
+			return nil, fmt.Errorf("load: unexpected migration file %s", name)
+		}
+
+		parts := strings.SplitN(strings.TrimSuffix(name, fmt.Sprintf(".%s.sql", direction)), "_", 2)
+		version, err := strconv.Atoi(parts[0])
+		if err != nil || len(parts) != 2 {
+			return nil, fmt.Errorf("load: invalid migration file name %s", name)
+		}
+
+		content, err := files.ReadFile(path.Join("sql", name))
+		if err != nil {
+			return nil, fmt.Errorf("load: unable to read %s: %s", name, err)
+		}
+
+		m, ok := byVersion[version]
+		if !ok {
+			m = &Migration{Version: version, Name: parts[1]}
+			byVersion[version] = m
+		}
+
+		if m.Name != parts[1] {
+			return nil, fmt.Errorf("load: conflicting names for migration %d", version)
+		}
+
+		if direction == "up" {
+			m.Up = string(content)
+		} else {
+			m.Down = string(content)
+		}
+	}
+
+	var migrations []*Migration
+	for _, m := range byVersion {
+		if m.Up == "" || m.Down == "" {
+			return nil, fmt.Errorf("load: migration %d needs both an up and a down file", m.Version)
+		}
+
+		migrations = append(migrations, m)
+	}
+
+	sort.Slice(migrations, func(i, j int) bool {
+		return migrations[i].Version < migrations[j].Version
+	})
+
+	return migrations, nil
+}
+
+// Up applies every migration that has not been applied yet, each one in its own transaction
+func (m *migrator) Up(ctx context.Context) ([]*Migration, error) {
+	var applied []*Migration
+	err := m.locked(ctx, func(conn *pg.Conn) error {
+		versions, err := appliedVersions(ctx, conn)
+		if err != nil {
+			return err
+		}
+
+		for _, migration := range m.migrations {
+			if _, ok := versions[migration.Version]; ok {
+				continue
+			}
+
+			err = run(ctx, conn, migration.Up, `INSERT INTO schema_migrations(version, name) VALUES($1, $2)`,
+				migration.Version, migration.Name)
+			if err != nil {
+				return fmt.Errorf("migration %d_%s: %s", migration.Version, migration.Name, err)
+			}
+
+			applied = append(applied, migration)
+		}
+
+		return nil
+	})
+	if err != nil {
+		return applied, fmt.Errorf("up: %s", err)
+	}
+
+	return applied, nil
+}
+
+// Down reverts the last steps applied migrations, newest first
+func (m *migrator) Down(ctx context.Context, steps int) ([]*Migration, error) {
+	var reverted []*Migration
+	err := m.locked(ctx, func(conn *pg.Conn) error {
+		versions, err := appliedVersions(ctx, conn)
+		if err != nil {
+			return err
+		}
+
+		for i := len(m.migrations) - 1; i >= 0 && len(reverted) < steps; i-- {
+			migration := m.migrations[i]
+			if _, ok := versions[migration.Version]; !ok {
+				continue
+			}
+
+			err = run(ctx, conn, migration.Down, `DELETE FROM schema_migrations WHERE version = $1`, migration.Version)
+			if err != nil {
+				return fmt.Errorf("migration %d_%s: %s", migration.Version, migration.Name, err)
+			}
+
+			reverted = append(reverted, migration)
+		}
+
+		return nil
+	})
+	if err != nil {
+		return reverted, fmt.Errorf("down: %s", err)
+	}
+
+	return reverted, nil
+}
+
+func (m *migrator) Status(ctx context.Context) ([]*Status, error) {
+	var res []*Status
+	err := m.locked(ctx, func(conn *pg.Conn) error {
+		versions, err := appliedVersions(ctx, conn)
+		if err != nil {
+			return err
+		}
+
+		for _, migration := range m.migrations {
+			status := &Status{Version: migration.Version, Name: migration.Name}
+			if appliedAt, ok := versions[migration.Version]; ok {
+				status.AppliedAt = &appliedAt
+			}
+
+			res = append(res, status)
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("status: %s", err)
+	}
+
+	return res, nil
+}
+
+// locked runs fn on a dedicated connection holding the migration advisory lock, creating the
+// schema_migrations table first if needed
+func (m *migrator) locked(ctx context.Context, fn func(conn *pg.Conn) error) error {
+	conn, err := m.pool.Acquire(ctx)
+	if err != nil {
+		return fmt.Errorf("unable to acquire connection: %s", err)
+	}
+
+	defer conn.Release()
+	_, err = conn.Exec(ctx, `SELECT pg_advisory_lock($1)`, lockId)
+	if err != nil {
+		return fmt.Errorf("unable to acquire migration lock: %s", err)
+	}
+
+	defer conn.Exec(context.Background(), `SELECT pg_advisory_unlock($1)`, lockId)
+	_, err = conn.Exec(ctx, `CREATE TABLE IF NOT EXISTS schema_migrations (
+		version integer NOT NULL,
+		name character varying(255) NOT NULL,
+		applied_at timestamp with time zone NOT NULL DEFAULT now(),
+		CONSTRAINT schema_migrations_pkey PRIMARY KEY (version)
+	)`)
+	if err != nil {
+		return fmt.Errorf("unable to create schema_migrations: %s", err)
+	}
+
+	return fn(conn)
+}
+
+func appliedVersions(ctx context.Context, conn *pg.Conn) (map[int]time.Time, error) {
+	rows, err := conn.Query(ctx, `SELECT version, applied_at FROM schema_migrations`)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read schema_migrations: %s", err)
+	}
+
+	defer rows.Close()
+	versions := map[int]time.Time{}
+	for rows.Next() {
+		var version int
+		var appliedAt time.Time
+		err = rows.Scan(&version, &appliedAt)
+		if err != nil {
+			return nil, fmt.Errorf("unable to read schema_migrations: %s", err)
+		}
+
+		versions[version] = appliedAt
+	}
+
+	return versions, rows.Err()
+}
+
+// run executes the migration script and records it in schema_migrations within one transaction
+func run(ctx context.Context, conn *pg.Conn, script, record string, args ...interface{}) error {
+	tx, err := conn.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("unable to begin transaction: %s", err)
+	}
+
+	defer tx.Rollback(ctx)
+	_, err = tx.Exec(ctx, script)
+	if err != nil {
+		return fmt.Errorf("unable to execute script: %s", err)
+	}
+
+	_, err = tx.Exec(ctx, record, args...)
+	if err != nil {
+		return fmt.Errorf("unable to record migration: %s", err)
+	}
+
+	err = tx.Commit(ctx)
+	if err != nil {
+		return fmt.Errorf("unable to commit: %s", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,27 @@
+CREATE TABLE IF NOT EXISTS users (
+    p_id serial NOT NULL,
+    id character varying(100) NOT NULL,
+    first_name character varying(50) DEFAULT '',
+    last_name character varying(50) DEFAULT '',
+    phone character varying(15),
+    CONSTRAINT users_pkey PRIMARY KEY (id),
+    CONSTRAINT users_phone_key UNIQUE (phone)
+);
+
+-- deployments created from the former users.sql only have the columns above
+ALTER TABLE users
+    ADD COLUMN IF NOT EXISTS email character varying(255),
+    ADD COLUMN IF NOT EXISTS fb_email character varying(255),
+    ADD COLUMN IF NOT EXISTS password character varying(255),
+    ADD COLUMN IF NOT EXISTS dob timestamp with time zone,
+    ADD COLUMN IF NOT EXISTS gender character varying(20),
+    ADD COLUMN IF NOT EXISTS pan character varying(10),
+    ADD COLUMN IF NOT EXISTS aadhar character varying(12),
+    ADD COLUMN IF NOT EXISTS t_and_c boolean DEFAULT false,
+    ADD COLUMN IF NOT EXISTS verified boolean NOT NULL DEFAULT false,
+    ADD COLUMN IF NOT EXISTS deleted boolean NOT NULL DEFAULT false,
+    ADD COLUMN IF NOT EXISTS default_address character varying(100),
+    ADD COLUMN IF NOT EXISTS created_at timestamp with time zone NOT NULL DEFAULT now(),
+    ADD COLUMN IF NOT EXISTS updated_at timestamp with time zone NOT NULL DEFAULT now();
+
+CREATE UNIQUE INDEX IF NOT EXISTS users_email_key ON users (email);
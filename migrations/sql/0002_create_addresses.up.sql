@@ -0,0 +1,23 @@
+CREATE TABLE IF NOT EXISTS addresses (
+    id character varying(100) NOT NULL,
+    user_id character varying(100) NOT NULL,
+    name character varying(100),
+    phone character varying(15),
+    first_line character varying(255),
+    second_line character varying(255),
+    address_string text,
+    city character varying(100),
+    state character varying(100),
+    country character varying(100),
+    pincode character varying(10),
+    lat real,
+    long real,
+    deleted boolean NOT NULL DEFAULT false,
+    is_default boolean NOT NULL DEFAULT false,
+    created_at timestamp with time zone NOT NULL DEFAULT now(),
+    updated_at timestamp with time zone NOT NULL DEFAULT now(),
+    CONSTRAINT addresses_pkey PRIMARY KEY (id),
+    CONSTRAINT addresses_user_id_fkey FOREIGN KEY (user_id) REFERENCES users (id) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS addresses_user_id_idx ON addresses (user_id);
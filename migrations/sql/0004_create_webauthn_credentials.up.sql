@@ -0,0 +1,13 @@
+CREATE TABLE IF NOT EXISTS webauthn_credentials (
+    id character varying(1400) NOT NULL,
+    user_id character varying(100) NOT NULL,
+    name character varying(100),
+    public_key bytea NOT NULL,
+    sign_count bigint NOT NULL DEFAULT 0,
+    created_at timestamp with time zone NOT NULL DEFAULT now(),
+    last_used_at timestamp with time zone,
+    CONSTRAINT webauthn_credentials_pkey PRIMARY KEY (id),
+    CONSTRAINT webauthn_credentials_user_id_fkey FOREIGN KEY (user_id) REFERENCES users (id) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS webauthn_credentials_user_id_idx ON webauthn_credentials (user_id);
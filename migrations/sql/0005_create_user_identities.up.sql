@@ -0,0 +1,13 @@
+CREATE TABLE IF NOT EXISTS user_identities (
+    id character varying(100) NOT NULL,
+    user_id character varying(100) NOT NULL,
+    provider character varying(50) NOT NULL,
+    subject character varying(255) NOT NULL,
+    email character varying(255),
+    linked_at timestamp with time zone NOT NULL DEFAULT now(),
+    CONSTRAINT user_identities_pkey PRIMARY KEY (id),
+    CONSTRAINT user_identities_provider_subject_key UNIQUE (provider, subject),
+    CONSTRAINT user_identities_user_id_fkey FOREIGN KEY (user_id) REFERENCES users (id) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS user_identities_user_id_idx ON user_identities (user_id);
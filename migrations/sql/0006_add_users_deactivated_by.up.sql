@@ -0,0 +1,2 @@
+-- who deactivated the account, self or admin, accounts deactivated before this was recorded stay with the admins
+ALTER TABLE users ADD COLUMN IF NOT EXISTS deactivated_by character varying(20);
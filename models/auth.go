@@ -3,6 +3,7 @@ package models
 import (
 	"fmt"
 	"strings"
+	"time"
 	"unicode"
 
 	"authservice/constant"
@@ -13,15 +14,24 @@ type AuthUser struct {
 	RefreshToken string `json:"refreshToken,omitempty"`
 
 	User *User `json:"user,omitempty"`
+	// MFAChallenge is the only field set when a second factor is needed to complete the login
+	MFAChallenge *MFAChallenge `json:"mfa,omitempty"`
+	// IdentityLink is the only field set when an OAuth login matched an account that has to approve the link first
+	IdentityLink *IdentityLink `json:"identityLink,omitempty"`
 }
 
 type LoginUser struct {
-	Email     string `json:"email,omitempty"`
-	Phone     string `json:"phone,omitempty"`
-	Password  string `json:"password,omitempty"`
-	LoginType string `json:"type"`
-	Nonce     string `json:"nonce"`
-	OTP       string `json:"otp"`
+	Email      string     `json:"email,omitempty"`
+	Phone      string     `json:"phone,omitempty"`
+	Password   string     `json:"password,omitempty"`
+	LoginType  string     `json:"type"`
+	Nonce      string     `json:"nonce"`
+	OTP        string     `json:"otp"`
+	ClientId   string     `json:"clientId,omitempty"`
+	DeviceName string     `json:"deviceName,omitempty"`
+	Device     DeviceInfo `json:"-"`
+	// UserId is set from a verified OTP, never from the request
+	UserId string `json:"-"`
 }
 
 func (l *LoginUser) IsPasswordValid() bool {
@@ -42,7 +52,19 @@ type Token struct {
 
 type RefreshMeta struct {
 	UserClaims map[string]interface{}
+	FamilyId   string
+	IssuedAt   int64
 	Expiry     int64
+	// SessionStart is when the user logged in, tokens issued before it was tracked fall back to IssuedAt
+	SessionStart int64 `json:",omitempty"`
+}
+
+func (r *RefreshMeta) GetSessionStart() time.Time {
+	if r.SessionStart == 0 {
+		return time.Unix(r.IssuedAt, 0)
+	}
+
+	return time.Unix(r.SessionStart, 0)
 }
 
 func isPhoneValid(phone string) bool {
@@ -130,4 +152,4 @@ func (c ChangePasswordRequest) ValidateConfirmPassword() error {
 	}
 
 	return nil
-}
\ No newline at end of file
+}
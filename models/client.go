@@ -0,0 +1,65 @@
+package models
+
+type Client struct {
+	Id     string `json:"id"`
+	Secret string `json:"secret,omitempty"`
+	Name   string `json:"name"`
+	Type   string `json:"type"`
+	Scope  string `json:"scope,omitempty"`
+	// RedirectURIs are where OAuth sign ins of the client may be handed back to, matched exactly
+	RedirectURIs []string `json:"redirectUris,omitempty"`
+
+	// optional token lifetimes in seconds overriding the configured ones
+	AccessTokenTTL     int64 `json:"accessTokenTtl,omitempty"`
+	RefreshTokenTTL    int64 `json:"refreshTokenTtl,omitempty"`
+	SessionMaxLifetime int64 `json:"sessionMaxLifetime,omitempty"`
+}
+
+// IsConfidential reports whether the client can hold a secret, public clients (SPAs, mobile apps) cannot
+func (c *Client) IsConfidential() bool {
+	return c.Secret != ""
+}
+
+func (c *Client) AllowsRedirect(uri string) bool {
+	for _, allowed := range c.RedirectURIs {
+		if allowed == uri {
+			return true
+		}
+	}
+
+	return false
+}
+
+// AuthorizationGrant is the outcome of an OAuth sign in waiting for the client to exchange its code
+type AuthorizationGrant struct {
+	ClientId      string     `json:"clientId"`
+	RedirectURI   string     `json:"redirectUri"`
+	CodeChallenge string     `json:"codeChallenge"`
+	UserId        string     `json:"userId,omitempty"`
+	Device        DeviceInfo `json:"device"`
+	AuthUser      *AuthUser  `json:"authUser,omitempty"`
+}
+
+// TokenResponse answers a code exchange (RFC 6749), a sign in that needs a second factor or the approval of a link
+// carries the MFA challenge or the link token instead of the tokens
+type TokenResponse struct {
+	AccessToken  string        `json:"access_token,omitempty"`
+	TokenType    string        `json:"token_type,omitempty"`
+	RefreshToken string        `json:"refresh_token,omitempty"`
+	ExpiresIn    int64         `json:"expires_in,omitempty"`
+	User         *User         `json:"user,omitempty"`
+	MFAChallenge *MFAChallenge `json:"mfa,omitempty"`
+	IdentityLink *IdentityLink `json:"identityLink,omitempty"`
+}
+
+type Introspection struct {
+	Active    bool   `json:"active"`
+	Sub       string `json:"sub,omitempty"`
+	Username  string `json:"username,omitempty"`
+	Exp       int64  `json:"exp,omitempty"`
+	Iat       int64  `json:"iat,omitempty"`
+	Scope     string `json:"scope,omitempty"`
+	ClientId  string `json:"client_id,omitempty"`
+	SessionId string `json:"sid,omitempty"`
+	TokenType string `json:"token_type,omitempty"`
+}
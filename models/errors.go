@@ -0,0 +1,41 @@
+package models
+
+import "errors"
+
+var (
+	ErrUserNotFound        = errors.New("user not registered")
+	ErrUserExists          = errors.New("user is already registered")
+	ErrInvalidCredentials  = errors.New("invalid credentials")
+	ErrSessionLimitReached = errors.New("maximum number of active sessions reached")
+	ErrAccountDeactivated  = errors.New("account is deactivated")
+	ErrReactivationDenied  = errors.New("account was deactivated by an administrator")
+
+	ErrEmailNotVerified         = errors.New("email address is not verified")
+	ErrEmailAlreadyVerified     = errors.New("email address is already verified")
+	ErrInvalidVerificationToken = errors.New("invalid or expired verification token")
+	ErrResendCooldown           = errors.New("please wait before requesting another email")
+	ErrOAuthEmailMissing        = errors.New("the provider did not share an email address")
+
+	ErrOTPResendCooldown = errors.New("please wait before requesting another code")
+	ErrOTPDailyLimit     = errors.New("daily limit of codes reached, please try again tomorrow")
+	ErrPhoneNotSet       = errors.New("no phone number is registered for this account")
+	ErrInvalidMagicLink  = errors.New("invalid or expired login link")
+
+	ErrInvalidMFACode      = errors.New("invalid authentication code")
+	ErrInvalidMFAChallenge = errors.New("invalid or expired MFA challenge")
+	ErrMFANotEnrolled      = errors.New("two-factor authentication is not set up")
+	ErrMFAAlreadyEnabled   = errors.New("two-factor authentication is already enabled")
+	ErrTooManyAttempts     = errors.New("too many attempts, please try again later")
+
+	ErrInvalidPasskey  = errors.New("passkey could not be verified")
+	ErrPasskeyNotFound = errors.New("passkey not found")
+
+	ErrUnknownProvider     = errors.New("unknown provider")
+	ErrInvalidOAuthState   = errors.New("invalid or expired sign in attempt")
+	ErrInvalidRedirectURI  = errors.New("redirect uri is not registered for the client")
+	ErrInvalidGrant        = errors.New("invalid or expired authorization code")
+	ErrIdentityNotFound    = errors.New("linked account not found")
+	ErrIdentityInUse       = errors.New("this account is already linked to another user")
+	ErrInvalidIdentityLink = errors.New("invalid or expired link token")
+	ErrLastSignInMethod    = errors.New("the only way left to sign in can not be removed")
+)
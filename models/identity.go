@@ -0,0 +1,32 @@
+package models
+
+import "time"
+
+// Identity is an account at an OAuth provider linked to a user, Subject is the provider's id for the account
+type Identity struct {
+	Id       string     `json:"id" db:"id"`
+	UserId   string     `json:"-" db:"user_id"`
+	Provider string     `json:"provider" db:"provider"`
+	Subject  string     `json:"subject" db:"subject"`
+	Email    *string    `json:"email,omitempty" db:"email"`
+	LinkedAt *time.Time `json:"linkedAt,omitempty" db:"linked_at"`
+}
+
+// IdentityLink is handed out for a provider account that is not linked yet, a signed in user links it by
+// sending the token back
+type IdentityLink struct {
+	Token     string `json:"linkToken"`
+	Provider  string `json:"provider"`
+	Email     string `json:"email,omitempty"`
+	ExpiresAt int64  `json:"expiresAt"`
+}
+
+type IdentityLinkRequest struct {
+	Token string `json:"linkToken"`
+}
+
+type IdentityLinkClaims struct {
+	Provider string `json:"p"`
+	Subject  string `json:"s"`
+	Email    string `json:"e,omitempty"`
+}
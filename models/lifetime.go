@@ -0,0 +1,78 @@
+package models
+
+import (
+	"fmt"
+	"time"
+)
+
+// TokenLifetime decides how long the tokens of a session are valid. Refresh tokens slide forward on every
+// refresh, but neither token of a session is ever valid past SessionMaxLifetime counted from the login.
+type TokenLifetime struct {
+	AccessTokenTTL     time.Duration
+	RefreshTokenTTL    time.Duration
+	SessionMaxLifetime time.Duration
+}
+
+func (t *TokenLifetime) Validate() error {
+	if t.AccessTokenTTL <= 0 || t.RefreshTokenTTL <= 0 || t.SessionMaxLifetime <= 0 {
+		return fmt.Errorf("token lifetimes should be greater than zero")
+	}
+
+	if t.AccessTokenTTL >= t.RefreshTokenTTL {
+		return fmt.Errorf("access token lifetime should be shorter than the refresh token lifetime")
+	}
+
+	if t.RefreshTokenTTL > t.SessionMaxLifetime {
+		return fmt.Errorf("refresh token lifetime should not exceed the session max lifetime")
+	}
+
+	return nil
+}
+
+// Override returns a copy of the lifetime with the non zero lifetimes of the client applied
+func (t TokenLifetime) Override(c *Client) TokenLifetime {
+	if c.AccessTokenTTL > 0 {
+		t.AccessTokenTTL = time.Duration(c.AccessTokenTTL) * time.Second
+	}
+
+	if c.RefreshTokenTTL > 0 {
+		t.RefreshTokenTTL = time.Duration(c.RefreshTokenTTL) * time.Second
+	}
+
+	if c.SessionMaxLifetime > 0 {
+		t.SessionMaxLifetime = time.Duration(c.SessionMaxLifetime) * time.Second
+	}
+
+	return t
+}
+
+func (t *TokenLifetime) AccessTokenExpiry(sessionStart time.Time) time.Time {
+	return t.capped(time.Now().Add(t.AccessTokenTTL), sessionStart)
+}
+
+func (t *TokenLifetime) RefreshTokenExpiry(sessionStart time.Time) time.Time {
+	return t.capped(time.Now().Add(t.RefreshTokenTTL), sessionStart)
+}
+
+func (t *TokenLifetime) capped(expiry, sessionStart time.Time) time.Time {
+	sessionEnd := sessionStart.Add(t.SessionMaxLifetime)
+	if expiry.After(sessionEnd) {
+		return sessionEnd
+	}
+
+	return expiry
+}
+
+// Longest is the longest time any token issued under this lifetime can stay valid
+func (t *TokenLifetime) Longest() time.Duration {
+	longest := t.RefreshTokenTTL
+	if t.AccessTokenTTL > longest {
+		longest = t.AccessTokenTTL
+	}
+
+	if t.SessionMaxLifetime < longest {
+		return t.SessionMaxLifetime
+	}
+
+	return longest
+}
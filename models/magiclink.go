@@ -0,0 +1,33 @@
+package models
+
+import "time"
+
+// MagicLink configures login links. They point to URL when it is set, otherwise the token is sent on its own
+// for the app to exchange.
+type MagicLink struct {
+	URL string
+	TTL time.Duration
+}
+
+type MagicLinkRequest struct {
+	Email    string `json:"email"`
+	ClientId string `json:"clientId,omitempty"`
+}
+
+func (m *MagicLinkRequest) IsEmailValid() bool {
+	return isEmailValid(m.Email)
+}
+
+type MagicLinkLogin struct {
+	Token      string     `json:"token"`
+	DeviceName string     `json:"deviceName,omitempty"`
+	Device     DeviceInfo `json:"-"`
+}
+
+// MagicLinkClaims bind a login link to the address it was sent to, Id makes every link single use
+type MagicLinkClaims struct {
+	Id       string `json:"i"`
+	UserId   string `json:"u"`
+	Email    string `json:"m"`
+	ClientId string `json:"c,omitempty"`
+}
@@ -0,0 +1,44 @@
+package models
+
+type TOTPEnrollment struct {
+	Secret string `json:"secret"`
+	URI    string `json:"uri"`
+}
+
+type TOTP struct {
+	Secret       []byte `db:"secret"`
+	Confirmed    bool   `db:"confirmed"`
+	LastUsedStep int64  `db:"last_used_step"`
+}
+
+type MFACode struct {
+	Code string `json:"code"`
+}
+
+type RecoveryCodes struct {
+	Codes []string `json:"recoveryCodes"`
+}
+
+// MFAChallenge is returned by a successful first login step when the user has a second factor enabled,
+// the token is exchanged for the session on the MFA endpoint together with a code
+type MFAChallenge struct {
+	Token     string   `json:"challengeToken"`
+	Methods   []string `json:"methods"`
+	ExpiresAt int64    `json:"expiresAt"`
+}
+
+// MFALogin answers a challenge with either a TOTP or recovery code or a passkey assertion
+type MFALogin struct {
+	ChallengeToken string            `json:"challengeToken"`
+	Code           string            `json:"code,omitempty"`
+	Passkey        *PasskeyAssertion `json:"passkey,omitempty"`
+	DeviceName     string            `json:"deviceName,omitempty"`
+	Device         DeviceInfo        `json:"-"`
+}
+
+// MFAChallengeClaims carry the first login step over to the second one
+type MFAChallengeClaims struct {
+	Id       string `json:"i"`
+	UserId   string `json:"u"`
+	ClientId string `json:"c,omitempty"`
+}
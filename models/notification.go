@@ -29,3 +29,15 @@ func (e *Email) GetBytes() []byte {
 	bytes, _ := json.Marshal(e)
 	return bytes
 }
+
+type SecurityEvent struct {
+	Type     string `json:"type"`
+	UserId   string `json:"userId"`
+	FamilyId string `json:"familyId,omitempty"`
+	Time     int64  `json:"time"`
+}
+
+func (s *SecurityEvent) GetBytes() []byte {
+	bytes, _ := json.Marshal(s)
+	return bytes
+}
@@ -0,0 +1,26 @@
+package models
+
+// OAuthUser is the profile an identity provider asserts for a user after a successful sign in
+type OAuthUser struct {
+	Provider      string
+	Subject       string
+	Email         string
+	EmailVerified bool
+	FirstName     string
+	LastName      string
+}
+
+// OAuthFlow is what the service keeps about a sign in while the user is at the provider
+type OAuthFlow struct {
+	Provider string `json:"p"`
+	State    string `json:"s"`
+	Nonce    string `json:"n"`
+	Verifier string `json:"v"`
+	Intent   string `json:"i,omitempty"`
+
+	// set when the outcome is handed back to a client's redirect URI as a one-time code
+	ClientId      string `json:"c,omitempty"`
+	RedirectURI   string `json:"r,omitempty"`
+	CodeChallenge string `json:"cc,omitempty"`
+	ClientState   string `json:"cs,omitempty"`
+}
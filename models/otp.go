@@ -0,0 +1,34 @@
+package models
+
+import (
+	"strings"
+	"time"
+)
+
+// OTPLifetime is how long a code sent by SMS can be used
+const OTPLifetime = 2 * time.Minute
+
+// OTP is stored under the nonce handed to the client, Attempts counts the failed verifications. The purpose, the
+// identifier the code was requested with and the account it was sent for bind the nonce to one flow and one user.
+type OTP struct {
+	Code      string
+	Attempts  int
+	ExpiresAt int64
+	Purpose   string
+	UserId    string
+	Email     string `json:",omitempty"`
+	Phone     string `json:",omitempty"`
+	Channel   string
+	SentTo    string
+}
+
+// Matches reports whether the code is verified with the same identifier it was requested with
+func (o *OTP) Matches(email, phone string) bool {
+	return strings.EqualFold(o.Email, email) && o.Phone == phone
+}
+
+type OTPPolicy struct {
+	MaxAttempts    int
+	ResendCooldown time.Duration
+	DailyLimit     int
+}
@@ -0,0 +1,110 @@
+package models
+
+import "time"
+
+// Passkey is a WebAuthn credential registered by a user, Id is the base64url encoded credential id
+type Passkey struct {
+	Id         string     `json:"id" db:"id"`
+	UserId     string     `json:"-" db:"user_id"`
+	Name       *string    `json:"name,omitempty" db:"name"`
+	PublicKey  []byte     `json:"-" db:"public_key"`
+	SignCount  int64      `json:"-" db:"sign_count"`
+	CreatedAt  *time.Time `json:"createdAt,omitempty" db:"created_at"`
+	LastUsedAt *time.Time `json:"lastUsedAt,omitempty" db:"last_used_at"`
+}
+
+type PasskeyRelyingParty struct {
+	Id   string `json:"id,omitempty"`
+	Name string `json:"name"`
+}
+
+type PasskeyUser struct {
+	Id          string `json:"id"`
+	Name        string `json:"name"`
+	DisplayName string `json:"displayName"`
+}
+
+type PasskeyCredentialParameter struct {
+	Type string `json:"type"`
+	Alg  int    `json:"alg"`
+}
+
+type PasskeyCredentialDescriptor struct {
+	Type string `json:"type"`
+	Id   string `json:"id"`
+}
+
+type PasskeyAuthenticatorSelection struct {
+	ResidentKey      string `json:"residentKey"`
+	UserVerification string `json:"userVerification"`
+}
+
+// PasskeyCreationOptions are the publicKey options of navigator.credentials.create(), binary values are base64url encoded
+type PasskeyCreationOptions struct {
+	Challenge              string                        `json:"challenge"`
+	RP                     PasskeyRelyingParty           `json:"rp"`
+	User                   PasskeyUser                   `json:"user"`
+	PubKeyCredParams       []PasskeyCredentialParameter  `json:"pubKeyCredParams"`
+	Timeout                int64                         `json:"timeout"`
+	ExcludeCredentials     []PasskeyCredentialDescriptor `json:"excludeCredentials,omitempty"`
+	AuthenticatorSelection PasskeyAuthenticatorSelection `json:"authenticatorSelection"`
+	Attestation            string                        `json:"attestation"`
+}
+
+// PasskeyRequestOptions are the publicKey options of navigator.credentials.get()
+type PasskeyRequestOptions struct {
+	Challenge        string                        `json:"challenge"`
+	Timeout          int64                         `json:"timeout"`
+	RPId             string                        `json:"rpId"`
+	AllowCredentials []PasskeyCredentialDescriptor `json:"allowCredentials,omitempty"`
+	UserVerification string                        `json:"userVerification"`
+}
+
+// PasskeyLoginOptions pair the request options with the ceremony they belong to, the session id is sent back with the assertion
+type PasskeyLoginOptions struct {
+	SessionId string                 `json:"sessionId"`
+	PublicKey *PasskeyRequestOptions `json:"publicKey"`
+}
+
+type PasskeyAttestationResponse struct {
+	ClientDataJSON    string `json:"clientDataJSON"`
+	AttestationObject string `json:"attestationObject"`
+}
+
+type PasskeyRegistration struct {
+	Id       string                     `json:"id"`
+	Name     string                     `json:"name,omitempty"`
+	Response PasskeyAttestationResponse `json:"response"`
+}
+
+type PasskeyAssertionResponse struct {
+	ClientDataJSON    string `json:"clientDataJSON"`
+	AuthenticatorData string `json:"authenticatorData"`
+	Signature         string `json:"signature"`
+	UserHandle        string `json:"userHandle,omitempty"`
+}
+
+type PasskeyAssertion struct {
+	SessionId string                   `json:"sessionId"`
+	Id        string                   `json:"id"`
+	Response  PasskeyAssertionResponse `json:"response"`
+}
+
+type PasskeyLogin struct {
+	PasskeyAssertion
+	ClientId   string     `json:"clientId,omitempty"`
+	DeviceName string     `json:"deviceName,omitempty"`
+	Device     DeviceInfo `json:"-"`
+}
+
+// PasskeySession is the state of a pending ceremony kept until its assertion arrives
+type PasskeySession struct {
+	Challenge []byte
+	UserId    string `json:",omitempty"`
+	// SecondFactor sessions only prove presence, primary logins also need the user to be verified
+	SecondFactor bool `json:",omitempty"`
+}
+
+type PasskeyMFAOptions struct {
+	ChallengeToken string `json:"challengeToken"`
+}
@@ -0,0 +1,35 @@
+package models
+
+import (
+	"fmt"
+
+	"authservice/constant"
+)
+
+// SessionPolicy decides what happens when a user logs in on more devices than allowed.
+// ClientTypeLimits caps the sessions per client type (web, mobile...) on top of MaxSessions.
+type SessionPolicy struct {
+	Mode             string         `json:"mode"`
+	MaxSessions      int            `json:"maxSessions"`
+	ClientTypeLimits map[string]int `json:"clientTypeLimits,omitempty"`
+}
+
+func (s *SessionPolicy) Validate() error {
+	switch s.Mode {
+	case constant.SessionEvictOldest, constant.SessionDenyNew, constant.SessionUnlimited:
+	default:
+		return fmt.Errorf("invalid session policy mode '%s'", s.Mode)
+	}
+
+	if s.Mode != constant.SessionUnlimited && s.MaxSessions <= 0 {
+		return fmt.Errorf("max sessions should be greater than zero")
+	}
+
+	for clientType, limit := range s.ClientTypeLimits {
+		if limit <= 0 {
+			return fmt.Errorf("invalid session limit for client type '%s'", clientType)
+		}
+	}
+
+	return nil
+}
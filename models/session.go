@@ -2,20 +2,50 @@ package models
 
 import (
 	"encoding/json"
-)
+	"strings"
+	"time"
 
-// maxActiveTokens specifies the maximum no of devices a user can log in concurrently
-const maxActiveTokens = 3
+	"authservice/constant"
+)
 
 type UserMeta struct {
 	UserId        string
 	LastLoginTime int64
 	ActiveTokens  []ActiveToken
+	Policy        *SessionPolicy `json:",omitempty"`
+	// Deactivated mirrors the deleted flag of the user so that token checks do not need the database
+	Deactivated bool `json:",omitempty"`
 }
 
+// ActiveToken is the current token pair of a login session. SessionId stays the same across refreshes
+// and doubles as the id of the refresh token family.
 type ActiveToken struct {
+	SessionId    string
 	BearerToken  string
 	RefreshToken string
+	ClientId     string
+	ClientType   string
+	CreatedAt    int64
+	LastUsedAt   int64
+	IP           string
+	UserAgent    string
+	DeviceName   string
+}
+
+type DeviceInfo struct {
+	IP        string
+	UserAgent string
+	Name      string
+}
+
+type Session struct {
+	Id         string `json:"id"`
+	DeviceName string `json:"deviceName"`
+	IP         string `json:"ip,omitempty"`
+	UserAgent  string `json:"userAgent,omitempty"`
+	CreatedAt  int64  `json:"createdAt"`
+	LastUsedAt int64  `json:"lastUsedAt"`
+	Current    bool   `json:"current"`
 }
 
 func (u *UserMeta) GetBytes() []byte {
@@ -54,30 +84,125 @@ func (u *UserMeta) ClearToken(bearerToken string) {
 	u.ActiveTokens = newActiveTokens
 }
 
+func (u *UserMeta) ClearRefreshToken(refreshToken string) {
+	var newActiveTokens []ActiveToken
+	for _, activeToken := range u.ActiveTokens {
+		if activeToken.RefreshToken != refreshToken {
+			newActiveTokens = append(newActiveTokens, activeToken)
+		}
+	}
+
+	u.ActiveTokens = newActiveTokens
+}
+
 func (u *UserMeta) ClearAllTokens() {
 	u.ActiveTokens = []ActiveToken{}
 }
 
-func (u *UserMeta) AddToken(bearerToken, refreshToken string) {
-	noOfTokens := len(u.ActiveTokens)
-	if noOfTokens < maxActiveTokens {
-		u.ActiveTokens = append([]ActiveToken{
-			{
-				BearerToken: bearerToken,
-				RefreshToken: refreshToken,
-			},
-		}, u.ActiveTokens...)
-	} else {
-		u.ActiveTokens = append([]ActiveToken{
-			{
-				BearerToken: bearerToken,
-				RefreshToken: refreshToken,
-			},
-		}, u.ActiveTokens[0:noOfTokens-1]...)
+func (u *UserMeta) ContainsSession(sessionId string) bool {
+	for _, activeToken := range u.ActiveTokens {
+		if sessionId != "" && activeToken.SessionId == sessionId {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (u *UserMeta) ClearSession(sessionId string) {
+	var newActiveTokens []ActiveToken
+	for _, activeToken := range u.ActiveTokens {
+		if activeToken.SessionId != sessionId {
+			newActiveTokens = append(newActiveTokens, activeToken)
+		}
+	}
+
+	u.ActiveTokens = newActiveTokens
+}
+
+func (u *UserMeta) GetSessions(currentBearerToken string) []*Session {
+	sessions := make([]*Session, 0)
+	for _, activeToken := range u.ActiveTokens {
+		sessions = append(sessions, &Session{
+			Id:         activeToken.SessionId,
+			DeviceName: activeToken.DeviceName,
+			IP:         activeToken.IP,
+			UserAgent:  activeToken.UserAgent,
+			CreatedAt:  activeToken.CreatedAt,
+			LastUsedAt: activeToken.LastUsedAt,
+			Current:    activeToken.BearerToken == currentBearerToken,
+		})
+	}
+
+	return sessions
+}
+
+// AddToken stores a new session according to the user's own policy, or defaultPolicy when the user has none.
+// Sessions are kept newest first, so the oldest session is always the last matching one.
+func (u *UserMeta) AddToken(token ActiveToken, defaultPolicy *SessionPolicy) error {
+	policy := defaultPolicy
+	if u.Policy != nil {
+		policy = u.Policy
 	}
+
+	if policy.Mode != constant.SessionUnlimited {
+		if limit, ok := policy.ClientTypeLimits[token.ClientType]; ok {
+			err := u.makeRoom(limit, policy.Mode, func(activeToken ActiveToken) bool {
+				return activeToken.ClientType == token.ClientType
+			})
+			if err != nil {
+				return err
+			}
+		}
+
+		err := u.makeRoom(policy.MaxSessions, policy.Mode, func(ActiveToken) bool {
+			return true
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	u.ActiveTokens = append([]ActiveToken{token}, u.ActiveTokens...)
+	return nil
 }
 
-func (u *UserMeta) ReplaceBearerToken(oldBearerToken, newBearerToken, refreshToken string) bool {
+// makeRoom evicts the oldest sessions matching the filter until a new one fits within limit,
+// or refuses the new session when the policy does not allow evictions
+func (u *UserMeta) makeRoom(limit int, mode string, matches func(ActiveToken) bool) error {
+	var indexes []int
+	for index, activeToken := range u.ActiveTokens {
+		if matches(activeToken) {
+			indexes = append(indexes, index)
+		}
+	}
+
+	if limit <= 0 || len(indexes) < limit {
+		return nil
+	}
+
+	if mode == constant.SessionDenyNew {
+		return ErrSessionLimitReached
+	}
+
+	evict := map[int]bool{}
+	for _, index := range indexes[limit-1:] {
+		evict[index] = true
+	}
+
+	var newActiveTokens []ActiveToken
+	for index, activeToken := range u.ActiveTokens {
+		if !evict[index] {
+			newActiveTokens = append(newActiveTokens, activeToken)
+		}
+	}
+
+	u.ActiveTokens = newActiveTokens
+	return nil
+}
+
+// RotateTokens replaces both tokens of the pair, so the old refresh token can never be used again
+func (u *UserMeta) RotateTokens(oldBearerToken, refreshToken, newBearerToken, newRefreshToken string) bool {
 	tokenIndex := -1
 	for index, activeToken := range u.ActiveTokens {
 		if activeToken.RefreshToken == refreshToken && activeToken.BearerToken == oldBearerToken {
@@ -88,8 +213,57 @@ func (u *UserMeta) ReplaceBearerToken(oldBearerToken, newBearerToken, refreshTok
 
 	if tokenIndex > -1 {
 		u.ActiveTokens[tokenIndex].BearerToken = newBearerToken
+		u.ActiveTokens[tokenIndex].RefreshToken = newRefreshToken
+		u.ActiveTokens[tokenIndex].LastUsedAt = time.Now().UnixMilli()
 		return true
 	}
 
 	return false
-}
\ No newline at end of file
+}
+
+// GetName returns the name the client gave the device or a rough description derived from the user agent
+func (d *DeviceInfo) GetName() string {
+	if d.Name != "" {
+		return d.Name
+	}
+
+	ua := d.UserAgent
+	browser := ""
+	switch {
+	case strings.Contains(ua, "Edg/"):
+		browser = "Edge"
+	case strings.Contains(ua, "Chrome/"):
+		browser = "Chrome"
+	case strings.Contains(ua, "Firefox/"):
+		browser = "Firefox"
+	case strings.Contains(ua, "Safari/"):
+		browser = "Safari"
+	}
+
+	platform := ""
+	switch {
+	case strings.Contains(ua, "iPhone"):
+		platform = "iPhone"
+	case strings.Contains(ua, "iPad"):
+		platform = "iPad"
+	case strings.Contains(ua, "Android"):
+		platform = "Android"
+	case strings.Contains(ua, "Windows"):
+		platform = "Windows"
+	case strings.Contains(ua, "Mac OS X"):
+		platform = "Mac"
+	case strings.Contains(ua, "Linux"):
+		platform = "Linux"
+	}
+
+	switch {
+	case browser != "" && platform != "":
+		return browser + " on " + platform
+	case platform != "":
+		return platform
+	case browser != "":
+		return browser
+	}
+
+	return "Unknown device"
+}
@@ -122,6 +122,22 @@ func (u *User) GetTAndC() bool {
 	return false
 }
 
+func (u *User) GetVerified() bool {
+	if u.Verified != nil {
+		return *u.Verified
+	}
+
+	return false
+}
+
+func (u *User) GetDeleted() bool {
+	if u.Deleted != nil {
+		return *u.Deleted
+	}
+
+	return false
+}
+
 func (u *User) GetLastName() string {
 	if u.LastName != nil {
 		return *u.LastName
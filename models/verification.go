@@ -0,0 +1,24 @@
+package models
+
+import "time"
+
+// EmailVerification configures how email addresses are verified. Links point to URL when it is set,
+// otherwise the token is sent on its own for the user to paste into the app.
+type EmailVerification struct {
+	Required       bool
+	URL            string
+	TTL            time.Duration
+	ResendCooldown time.Duration
+}
+
+type VerifyEmailRequest struct {
+	Token string `json:"token,omitempty"`
+	Email string `json:"email,omitempty"`
+}
+
+// EmailVerificationClaims bind a verification token to the address it was sent to,
+// so that it stops working once the user changes their email
+type EmailVerificationClaims struct {
+	UserId string `json:"u"`
+	Email  string `json:"m"`
+}
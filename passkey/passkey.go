@@ -0,0 +1,351 @@
+package passkey
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"authservice/builder"
+	"authservice/constant"
+	"authservice/helper"
+	"authservice/models"
+	"authservice/repository"
+	"authservice/webauthn"
+)
+
+const (
+	ceremonyTimeout   = 5 * time.Minute
+	defaultName       = "Passkey"
+	credentialType    = "public-key"
+	userVerification  = "preferred"
+	residentKey       = "preferred"
+	attestationNone   = "none"
+	maxPasskeyNameLen = 100
+)
+
+type Passkey interface {
+	List(ctx context.Context, userId string) ([]*models.Passkey, error)
+	HasPasskeys(ctx context.Context, userId string) (bool, error)
+	BeginRegistration(ctx context.Context, user *models.User) (*models.PasskeyCreationOptions, error)
+	FinishRegistration(ctx context.Context, userId string, registration *models.PasskeyRegistration) (*models.Passkey, error)
+	BeginLogin(ctx context.Context, userId string, secondFactor bool) (*models.PasskeyLoginOptions, error)
+	FinishLogin(ctx context.Context, assertion *models.PasskeyAssertion, secondFactor bool) (string, error)
+	Delete(ctx context.Context, userId, id string) error
+}
+
+type passkey struct {
+	builder  builder.PasskeyBuilder
+	postgres repository.PostgresQueryer
+	redis    repository.RedisQueryer
+	helper   helper.Helper
+	rp       *webauthn.RelyingParty
+}
+
+func NewPasskey(b builder.PasskeyBuilder, p repository.PostgresQueryer, r repository.RedisQueryer, h helper.Helper,
+	rp *webauthn.RelyingParty) Passkey {
+	return &passkey{
+		builder:  b,
+		postgres: p,
+		redis:    r,
+		helper:   h,
+		rp:       rp,
+	}
+}
+
+func (p *passkey) List(ctx context.Context, userId string) ([]*models.Passkey, error) {
+	res, err := p.postgres.QueryScan(ctx, p.builder.GetPasskeys(), userId)
+	if err != nil {
+		return nil, fmt.Errorf("list: unable to fetch passkeys: %s", err)
+	}
+
+	defer res.Close()
+	passkeys := []*models.Passkey{}
+	for res.Next() {
+		var pk models.Passkey
+		err = res.Scan(&pk)
+		if err != nil {
+			return nil, fmt.Errorf("list: unable to decode passkey: %s", err)
+		}
+
+		passkeys = append(passkeys, &pk)
+	}
+
+	return passkeys, nil
+}
+
+func (p *passkey) HasPasskeys(ctx context.Context, userId string) (bool, error) {
+	passkeys, err := p.List(ctx, userId)
+	if err != nil {
+		return false, fmt.Errorf("hasPasskeys: %s", err)
+	}
+
+	return len(passkeys) > 0, nil
+}
+
+func (p *passkey) get(ctx context.Context, id string) (*models.Passkey, error) {
+	res, err := p.postgres.QueryScan(ctx, p.builder.GetPasskey(), id)
+	if err != nil {
+		return nil, fmt.Errorf("get: unable to fetch passkey: %s", err)
+	}
+
+	defer res.Close()
+	if !res.Next() {
+		return nil, nil
+	}
+
+	var pk models.Passkey
+	err = res.Scan(&pk)
+	if err != nil {
+		return nil, fmt.Errorf("get: unable to decode passkey: %s", err)
+	}
+
+	return &pk, nil
+}
+
+// BeginRegistration returns the options for navigator.credentials.create(), the user's existing passkeys are
+// excluded so that an authenticator is not registered twice
+func (p *passkey) BeginRegistration(ctx context.Context, user *models.User) (*models.PasskeyCreationOptions, error) {
+	challenge, err := webauthn.NewChallenge()
+	if err != nil {
+		return nil, fmt.Errorf("beginRegistration: %s", err)
+	}
+
+	passkeys, err := p.List(ctx, user.GetId())
+	if err != nil {
+		return nil, fmt.Errorf("beginRegistration: %s", err)
+	}
+
+	err = p.redis.Set(ctx, registrationKey(user.GetId()), webauthn.Encoding.EncodeToString(challenge), ceremonyTimeout)
+	if err != nil {
+		return nil, fmt.Errorf("beginRegistration: unable to store challenge: %s", err)
+	}
+
+	name := user.GetEmail()
+	if name == "" {
+		name = user.GetPhone()
+	}
+
+	options := &models.PasskeyCreationOptions{
+		Challenge: webauthn.Encoding.EncodeToString(challenge),
+		RP:        models.PasskeyRelyingParty{Id: p.rp.ID, Name: p.rp.Name},
+		User: models.PasskeyUser{
+			Id:          webauthn.Encoding.EncodeToString([]byte(user.GetId())),
+			Name:        name,
+			DisplayName: fmt.Sprintf("%s %s", user.GetFirstName(), user.GetLastName()),
+		},
+		Timeout: ceremonyTimeout.Milliseconds(),
+		AuthenticatorSelection: models.PasskeyAuthenticatorSelection{
+			ResidentKey:      residentKey,
+			UserVerification: userVerification,
+		},
+		Attestation: attestationNone,
+	}
+	for _, alg := range webauthn.SupportedAlgorithms {
+		options.PubKeyCredParams = append(options.PubKeyCredParams, models.PasskeyCredentialParameter{Type: credentialType, Alg: alg})
+	}
+
+	for _, pk := range passkeys {
+		options.ExcludeCredentials = append(options.ExcludeCredentials, models.PasskeyCredentialDescriptor{Type: credentialType, Id: pk.Id})
+	}
+
+	return options, nil
+}
+
+func (p *passkey) FinishRegistration(ctx context.Context, userId string, registration *models.PasskeyRegistration) (*models.Passkey, error) {
+	encoded, err := p.redis.GetDelString(ctx, registrationKey(userId))
+	if p.redis.IsRedisNil(err) {
+		return nil, fmt.Errorf("finishRegistration: %w: no pending registration", models.ErrInvalidPasskey)
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("finishRegistration: unable to read challenge: %s", err)
+	}
+
+	challenge, _ := webauthn.Encoding.DecodeString(encoded)
+	clientData, attestation, err := decode(registration.Response.ClientDataJSON, registration.Response.AttestationObject)
+	if err != nil {
+		return nil, fmt.Errorf("finishRegistration: %w: %s", models.ErrInvalidPasskey, err)
+	}
+
+	credential, err := p.rp.VerifyRegistration(challenge, clientData, attestation, false)
+	if err != nil {
+		return nil, fmt.Errorf("finishRegistration: %w: %s", models.ErrInvalidPasskey, err)
+	}
+
+	name := registration.Name
+	if name == "" {
+		name = defaultName
+	}
+
+	if len(name) > maxPasskeyNameLen {
+		name = name[:maxPasskeyNameLen]
+	}
+
+	id := webauthn.Encoding.EncodeToString(credential.Id)
+	affected, err := p.postgres.Exec(ctx, p.builder.AddPasskey(), id, userId, name, credential.PublicKey, int64(credential.SignCount))
+	if err != nil {
+		return nil, fmt.Errorf("finishRegistration: unable to save passkey: %s", err)
+	}
+
+	if affected == 0 {
+		return nil, fmt.Errorf("finishRegistration: %w: credential is already registered", models.ErrInvalidPasskey)
+	}
+
+	p.publish(ctx, constant.EventPasskeyAdded, userId)
+	now := time.Now()
+	return &models.Passkey{Id: id, UserId: userId, Name: &name, CreatedAt: &now}, nil
+}
+
+// BeginLogin starts an authentication ceremony. Without a user id any discoverable passkey may answer it,
+// second factor ceremonies are limited to the passkeys of the user.
+func (p *passkey) BeginLogin(ctx context.Context, userId string, secondFactor bool) (*models.PasskeyLoginOptions, error) {
+	challenge, err := webauthn.NewChallenge()
+	if err != nil {
+		return nil, fmt.Errorf("beginLogin: %s", err)
+	}
+
+	options := &models.PasskeyRequestOptions{
+		Challenge:        webauthn.Encoding.EncodeToString(challenge),
+		Timeout:          ceremonyTimeout.Milliseconds(),
+		RPId:             p.rp.ID,
+		UserVerification: "required",
+	}
+	if secondFactor {
+		options.UserVerification = "discouraged"
+	}
+
+	if userId != "" {
+		passkeys, err := p.List(ctx, userId)
+		if err != nil {
+			return nil, fmt.Errorf("beginLogin: %s", err)
+		}
+
+		if len(passkeys) == 0 {
+			return nil, fmt.Errorf("beginLogin: %w", models.ErrPasskeyNotFound)
+		}
+
+		for _, pk := range passkeys {
+			options.AllowCredentials = append(options.AllowCredentials, models.PasskeyCredentialDescriptor{Type: credentialType, Id: pk.Id})
+		}
+	}
+
+	sessionId := p.helper.NewId()
+	session := p.helper.Marshal(&models.PasskeySession{Challenge: challenge, UserId: userId, SecondFactor: secondFactor})
+	err = p.redis.Set(ctx, sessionKey(sessionId), session, ceremonyTimeout)
+	if err != nil {
+		return nil, fmt.Errorf("beginLogin: unable to store session: %s", err)
+	}
+
+	return &models.PasskeyLoginOptions{SessionId: sessionId, PublicKey: options}, nil
+}
+
+// FinishLogin verifies the assertion of a ceremony started with BeginLogin and returns the id of the user it
+// belongs to. Every ceremony can be answered once.
+func (p *passkey) FinishLogin(ctx context.Context, assertion *models.PasskeyAssertion, secondFactor bool) (string, error) {
+	value, err := p.redis.GetDelString(ctx, sessionKey(assertion.SessionId))
+	if p.redis.IsRedisNil(err) {
+		return "", fmt.Errorf("finishLogin: %w: unknown or expired session", models.ErrInvalidPasskey)
+	}
+
+	if err != nil {
+		return "", fmt.Errorf("finishLogin: unable to read session: %s", err)
+	}
+
+	var session models.PasskeySession
+	err = json.Unmarshal([]byte(value), &session)
+	if err != nil {
+		return "", fmt.Errorf("finishLogin: unable to decode session: %s", err)
+	}
+
+	if session.SecondFactor != secondFactor {
+		return "", fmt.Errorf("finishLogin: %w: session was started for another flow", models.ErrInvalidPasskey)
+	}
+
+	pk, err := p.get(ctx, assertion.Id)
+	if err != nil {
+		return "", fmt.Errorf("finishLogin: %s", err)
+	}
+
+	if pk == nil || (session.UserId != "" && pk.UserId != session.UserId) {
+		return "", fmt.Errorf("finishLogin: %w: unknown credential", models.ErrInvalidPasskey)
+	}
+
+	if assertion.Response.UserHandle != "" {
+		userHandle, err := webauthn.Encoding.DecodeString(assertion.Response.UserHandle)
+		if err != nil || string(userHandle) != pk.UserId {
+			return "", fmt.Errorf("finishLogin: %w: user handle mismatch", models.ErrInvalidPasskey)
+		}
+	}
+
+	clientData, authData, err := decode(assertion.Response.ClientDataJSON, assertion.Response.AuthenticatorData)
+	if err != nil {
+		return "", fmt.Errorf("finishLogin: %w: %s", models.ErrInvalidPasskey, err)
+	}
+
+	signature, err := webauthn.Encoding.DecodeString(assertion.Response.Signature)
+	if err != nil {
+		return "", fmt.Errorf("finishLogin: %w: invalid signature encoding", models.ErrInvalidPasskey)
+	}
+
+	result, err := p.rp.VerifyAssertion(session.Challenge, clientData, authData, signature, pk.PublicKey, !secondFactor)
+	if err != nil {
+		return "", fmt.Errorf("finishLogin: %w: %s", models.ErrInvalidPasskey, err)
+	}
+
+	// a counter that does not move forward points to a cloned authenticator
+	affected, err := p.postgres.Exec(ctx, p.builder.UsePasskey(), pk.Id, int64(result.SignCount))
+	if err != nil {
+		return "", fmt.Errorf("finishLogin: unable to update passkey: %s", err)
+	}
+
+	if affected == 0 {
+		return "", fmt.Errorf("finishLogin: %w: signature counter did not increase", models.ErrInvalidPasskey)
+	}
+
+	return pk.UserId, nil
+}
+
+func (p *passkey) Delete(ctx context.Context, userId, id string) error {
+	affected, err := p.postgres.Exec(ctx, p.builder.DeletePasskey(), id, userId)
+	if err != nil {
+		return fmt.Errorf("delete: unable to delete passkey: %s", err)
+	}
+
+	if affected == 0 {
+		return fmt.Errorf("delete: %w", models.ErrPasskeyNotFound)
+	}
+
+	p.publish(ctx, constant.EventPasskeyRemoved, userId)
+	return nil
+}
+
+func (p *passkey) publish(ctx context.Context, event, userId string) {
+	_ = p.helper.PublishSecurityEvent(ctx, &models.SecurityEvent{
+		Type:   event,
+		UserId: userId,
+		Time:   time.Now().UnixMilli(),
+	})
+}
+
+func decode(clientData, data string) ([]byte, []byte, error) {
+	decodedClientData, err := webauthn.Encoding.DecodeString(clientData)
+	if err != nil {
+		return nil, nil, fmt.Errorf("invalid client data encoding")
+	}
+
+	decodedData, err := webauthn.Encoding.DecodeString(data)
+	if err != nil {
+		return nil, nil, fmt.Errorf("invalid authenticator data encoding")
+	}
+
+	return decodedClientData, decodedData, nil
+}
+
+func registrationKey(userId string) string {
+	return fmt.Sprintf("passkey:registration:%s", userId)
+}
+
+func sessionKey(id string) string {
+	return fmt.Sprintf("passkey:session:%s", id)
+}
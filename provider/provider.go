@@ -0,0 +1,430 @@
+package provider
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gorilla/sessions"
+	"github.com/markbates/goth"
+	"github.com/markbates/goth/providers/apple"
+	"github.com/markbates/goth/providers/facebook"
+	"github.com/markbates/goth/providers/github"
+	"github.com/markbates/goth/providers/google"
+	"github.com/markbates/goth/providers/microsoftonline"
+	"github.com/markbates/goth/providers/openidConnect"
+	"github.com/sirupsen/logrus"
+	"golang.org/x/oauth2"
+
+	"authservice/config"
+	"authservice/models"
+)
+
+const (
+	sessionName     = "oauth_flow"
+	flowKey         = "flow"
+	flowLifetime    = 10 * time.Minute
+	callbackPath    = "/user/callback"
+	randomSize      = 32
+	challengeMethod = "S256"
+)
+
+// Registry runs the sign in with the enabled OAuth providers
+type Registry interface {
+	Enabled(name string) bool
+	Begin(w http.ResponseWriter, r *http.Request, flow *models.OAuthFlow) (string, error)
+	Complete(w http.ResponseWriter, r *http.Request) (*models.OAuthUser, *models.OAuthFlow, error)
+	Clear(w http.ResponseWriter, r *http.Request) error
+}
+
+// Settings of a single provider, Type is one of the config provider types
+type Settings struct {
+	Name         string
+	Type         string
+	ClientId     string
+	ClientSecret string
+	DiscoveryURL string
+	Scopes       []string
+}
+
+// Options of the registry, the first session key signs and encrypts new cookies while the others are still accepted
+type Options struct {
+	PublicURL     string
+	SessionKeys   []string
+	SecureCookies bool
+}
+
+type provider struct {
+	name   string
+	config *oauth2.Config
+	goth   goth.Provider
+	// authParams are sent along with every authorization request of the provider
+	authParams []oauth2.AuthCodeOption
+}
+
+type registry struct {
+	providers map[string]*provider
+	store     *sessions.CookieStore
+}
+
+// NewRegistry sets up the providers, an issuer that can not be discovered is left out
+func NewRegistry(l *logrus.Logger, settings []*Settings, options *Options) Registry {
+	callbackURL := options.PublicURL + callbackPath
+	providers := map[string]*provider{}
+	for _, s := range settings {
+		p, err := newProvider(s, callbackURL)
+		if err != nil {
+			l.Errorf("NewRegistry: unable to init provider %s: %s", s.Name, err)
+			continue
+		}
+
+		providers[s.Name] = p
+	}
+
+	return &registry{
+		providers: providers,
+		store:     newStore(options),
+	}
+}
+
+func newStore(options *Options) *sessions.CookieStore {
+	var keyPairs [][]byte
+	for _, key := range options.SessionKeys {
+		hashKey := sha256.Sum256([]byte("oauth-session-hash:" + key))
+		blockKey := sha256.Sum256([]byte("oauth-session-block:" + key))
+		keyPairs = append(keyPairs, hashKey[:], blockKey[:])
+	}
+
+	store := sessions.NewCookieStore(keyPairs...)
+	store.MaxAge(int(flowLifetime.Seconds()))
+	store.Options.Path = "/"
+	store.Options.HttpOnly = true
+	store.Options.Secure = options.SecureCookies
+	// apple posts the callback from its own site, which a lax cookie would not be sent along with
+	store.Options.SameSite = http.SameSiteLaxMode
+	if options.SecureCookies {
+		store.Options.SameSite = http.SameSiteNoneMode
+	}
+
+	return store
+}
+
+func newProvider(s *Settings, callbackURL string) (*provider, error) {
+	p := &provider{
+		name: s.Name,
+		config: &oauth2.Config{
+			ClientID:     s.ClientId,
+			ClientSecret: s.ClientSecret,
+			RedirectURL:  callbackURL,
+		},
+	}
+
+	var gp interface {
+		goth.Provider
+		SetName(name string)
+	}
+	switch s.Type {
+	case config.ProviderGoogle:
+		p.config.Scopes = defaultScopes(s.Scopes, "openid", "email", "profile")
+		p.config.Endpoint = oauth2.Endpoint{
+			AuthURL:  "https://accounts.google.com/o/oauth2/auth",
+			TokenURL: "https://oauth2.googleapis.com/token",
+		}
+		gp = google.New(s.ClientId, s.ClientSecret, callbackURL)
+	case config.ProviderGithub:
+		p.config.Scopes = defaultScopes(s.Scopes, "read:user", "user:email")
+		p.config.Endpoint = oauth2.Endpoint{AuthURL: github.AuthURL, TokenURL: github.TokenURL}
+		gp = github.New(s.ClientId, s.ClientSecret, callbackURL)
+	case config.ProviderMicrosoft:
+		p.config.Scopes = defaultScopes(s.Scopes, "openid", "User.Read")
+		p.config.Endpoint = oauth2.Endpoint{
+			AuthURL:  "https://login.microsoftonline.com/common/oauth2/v2.0/authorize",
+			TokenURL: "https://login.microsoftonline.com/common/oauth2/v2.0/token",
+		}
+		gp = microsoftonline.New(s.ClientId, s.ClientSecret, callbackURL)
+	case config.ProviderApple:
+		p.config.Scopes = defaultScopes(s.Scopes, apple.ScopeEmail, apple.ScopeName)
+		p.config.Endpoint = oauth2.Endpoint{
+			AuthURL:   "https://appleid.apple.com/auth/authorize",
+			TokenURL:  "https://appleid.apple.com/auth/token",
+			AuthStyle: oauth2.AuthStyleInParams,
+		}
+		// apple only hands out the email when the callback is posted
+		p.authParams = append(p.authParams, oauth2.SetAuthURLParam("response_mode", "form_post"))
+		gp = apple.New(s.ClientId, s.ClientSecret, callbackURL, nil)
+	case config.ProviderFacebook:
+		p.config.Scopes = defaultScopes(s.Scopes, "email")
+		p.config.Endpoint = oauth2.Endpoint{
+			AuthURL:  "https://www.facebook.com/dialog/oauth",
+			TokenURL: "https://graph.facebook.com/oauth/access_token",
+		}
+		gp = facebook.New(s.ClientId, s.ClientSecret, callbackURL)
+	case config.ProviderOIDC:
+		op, err := openidConnect.New(s.ClientId, s.ClientSecret, callbackURL, s.DiscoveryURL)
+		if err != nil {
+			return nil, fmt.Errorf("newProvider: unable to discover issuer: %s", err)
+		}
+
+		p.config.Scopes = defaultScopes(s.Scopes, "openid", "email", "profile")
+		if !contains(p.config.Scopes, "openid") {
+			p.config.Scopes = append(p.config.Scopes, "openid")
+		}
+
+		p.config.Endpoint = oauth2.Endpoint{AuthURL: op.OpenIDConfig.AuthEndpoint, TokenURL: op.OpenIDConfig.TokenEndpoint}
+		gp = op
+	default:
+		return nil, fmt.Errorf("newProvider: unknown provider type %s", s.Type)
+	}
+
+	gp.SetName(s.Name)
+	p.goth = gp
+	return p, nil
+}
+
+func (r *registry) Enabled(name string) bool {
+	_, found := r.providers[name]
+	return found
+}
+
+// Begin stores the flow and returns the URL to send the browser to
+func (r *registry) Begin(w http.ResponseWriter, req *http.Request, flow *models.OAuthFlow) (string, error) {
+	p, found := r.providers[flow.Provider]
+	if !found {
+		return "", fmt.Errorf("begin: %w", models.ErrUnknownProvider)
+	}
+
+	var err error
+	for _, value := range []*string{&flow.State, &flow.Nonce, &flow.Verifier} {
+		*value, err = randomString()
+		if err != nil {
+			return "", fmt.Errorf("begin: %s", err)
+		}
+	}
+
+	err = r.save(w, req, flow)
+	if err != nil {
+		return "", fmt.Errorf("begin: %s", err)
+	}
+
+	challenge := sha256.Sum256([]byte(flow.Verifier))
+	params := append([]oauth2.AuthCodeOption{
+		oauth2.SetAuthURLParam("code_challenge", base64.RawURLEncoding.EncodeToString(challenge[:])),
+		oauth2.SetAuthURLParam("code_challenge_method", challengeMethod),
+		oauth2.SetAuthURLParam("nonce", flow.Nonce),
+	}, p.authParams...)
+
+	return p.config.AuthCodeURL(flow.State, params...), nil
+}
+
+// Complete finishes the sign in the provider redirected back for, the stored flow is spent either way
+func (r *registry) Complete(w http.ResponseWriter, req *http.Request) (*models.OAuthUser, *models.OAuthFlow, error) {
+	flow, err := r.load(req)
+	if err != nil {
+		return nil, nil, fmt.Errorf("complete: %s", err)
+	}
+
+	err = r.Clear(w, req)
+	if err != nil {
+		return nil, nil, fmt.Errorf("complete: %s", err)
+	}
+
+	if flow == nil || subtle.ConstantTimeCompare([]byte(flow.State), []byte(req.FormValue("state"))) != 1 {
+		return nil, nil, fmt.Errorf("complete: %w: state does not match", models.ErrInvalidOAuthState)
+	}
+
+	if reason := req.FormValue("error"); reason != "" {
+		return nil, nil, fmt.Errorf("complete: %w: provider returned %s", models.ErrInvalidOAuthState, reason)
+	}
+
+	p, found := r.providers[flow.Provider]
+	if !found {
+		return nil, nil, fmt.Errorf("complete: %w", models.ErrUnknownProvider)
+	}
+
+	token, err := p.config.Exchange(req.Context(), req.FormValue("code"),
+		oauth2.SetAuthURLParam("code_verifier", flow.Verifier))
+	if err != nil {
+		return nil, nil, fmt.Errorf("complete: %w: unable to exchange code: %s", models.ErrInvalidOAuthState, err)
+	}
+
+	user, err := p.fetchUser(token, flow.Nonce)
+	if err != nil {
+		return nil, nil, fmt.Errorf("complete: %w: %s", models.ErrInvalidOAuthState, err)
+	}
+
+	return user, flow, nil
+}
+
+// Clear drops the stored flow of the browser
+func (r *registry) Clear(w http.ResponseWriter, req *http.Request) error {
+	session, _ := r.store.New(req, sessionName)
+	session.Values = map[interface{}]interface{}{}
+	session.Options.MaxAge = -1
+	err := session.Save(req, w)
+	if err != nil {
+		return fmt.Errorf("clear: unable to clear session: %s", err)
+	}
+
+	return nil
+}
+
+func (r *registry) save(w http.ResponseWriter, req *http.Request, flow *models.OAuthFlow) error {
+	value, err := json.Marshal(flow)
+	if err != nil {
+		return fmt.Errorf("save: unable to encode flow: %s", err)
+	}
+
+	// a new session replaces a sign in the browser did not finish
+	session, _ := r.store.New(req, sessionName)
+	session.Values[flowKey] = string(value)
+	err = session.Save(req, w)
+	if err != nil {
+		return fmt.Errorf("save: unable to save session: %s", err)
+	}
+
+	return nil
+}
+
+// load returns the stored flow, nil when there is none or the cookie does not decode with any of the keys
+func (r *registry) load(req *http.Request) (*models.OAuthFlow, error) {
+	session, err := r.store.New(req, sessionName)
+	if err != nil || session.IsNew {
+		return nil, nil
+	}
+
+	value, _ := session.Values[flowKey].(string)
+	if value == "" {
+		return nil, nil
+	}
+
+	var flow models.OAuthFlow
+	err = json.Unmarshal([]byte(value), &flow)
+	if err != nil {
+		return nil, fmt.Errorf("load: unable to decode flow: %s", err)
+	}
+
+	return &flow, nil
+}
+
+// fetchUser reads the profile with goth and checks the nonce of the ID token
+func (p *provider) fetchUser(token *oauth2.Token, nonce string) (*models.OAuthUser, error) {
+	session := map[string]interface{}{
+		"AccessToken":  token.AccessToken,
+		"RefreshToken": token.RefreshToken,
+		"ExpiresAt":    token.Expiry,
+	}
+
+	if idToken, _ := token.Extra("id_token").(string); idToken != "" {
+		claims, err := decodeClaims(idToken)
+		if err != nil {
+			return nil, fmt.Errorf("fetchUser: %s", err)
+		}
+
+		tokenNonce, _ := claims["nonce"].(string)
+		if subtle.ConstantTimeCompare([]byte(tokenNonce), []byte(nonce)) != 1 {
+			return nil, fmt.Errorf("fetchUser: nonce does not match")
+		}
+
+		// apple has no profile endpoint and reads the user from the ID token claims
+		session["IDToken"] = idToken
+		session["sub"] = claims["sub"]
+		session["email"] = claims["email"]
+	}
+
+	value, err := json.Marshal(session)
+	if err != nil {
+		return nil, fmt.Errorf("fetchUser: unable to encode session: %s", err)
+	}
+
+	sess, err := p.goth.UnmarshalSession(string(value))
+	if err != nil {
+		return nil, fmt.Errorf("fetchUser: unable to decode session: %s", err)
+	}
+
+	gothUser, err := p.goth.FetchUser(sess)
+	if err != nil {
+		return nil, fmt.Errorf("fetchUser: unable to fetch user: %s", err)
+	}
+
+	return &models.OAuthUser{
+		Provider:      p.name,
+		Subject:       gothUser.UserID,
+		Email:         gothUser.Email,
+		EmailVerified: p.emailVerified(gothUser),
+		FirstName:     gothUser.FirstName,
+		LastName:      gothUser.LastName,
+	}, nil
+}
+
+// emailVerified tells if the provider vouches for the email
+func (p *provider) emailVerified(gothUser goth.User) bool {
+	switch p.goth.(type) {
+	case *apple.Provider, *github.Provider:
+		return true
+	}
+
+	for _, claim := range []string{"email_verified", "verified_email"} {
+		switch verified := gothUser.RawData[claim].(type) {
+		case bool:
+			return verified
+		case string:
+			return verified == "true"
+		}
+	}
+
+	return false
+}
+
+func decodeClaims(idToken string) (map[string]interface{}, error) {
+	parts := strings.Split(idToken, ".")
+	if len(parts) != 3 {
+		return nil, fmt.Errorf("decodeClaims: malformed ID token")
+	}
+
+	payload, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(parts[1], "="))
+	if err != nil {
+		return nil, fmt.Errorf("decodeClaims: unable to decode ID token: %s", err)
+	}
+
+	var claims map[string]interface{}
+	err = json.Unmarshal(payload, &claims)
+	if err != nil {
+		return nil, fmt.Errorf("decodeClaims: unable to decode ID token claims: %s", err)
+	}
+
+	return claims, nil
+}
+
+func randomString() (string, error) {
+	value := make([]byte, randomSize)
+	_, err := rand.Read(value)
+	if err != nil {
+		return "", fmt.Errorf("randomString: unable to read random bytes: %s", err)
+	}
+
+	return base64.RawURLEncoding.EncodeToString(value), nil
+}
+
+func defaultScopes(scopes []string, defaults ...string) []string {
+	if len(scopes) == 0 {
+		return defaults
+	}
+
+	return scopes
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,213 @@
+package provider
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+
+	"authservice/config"
+	"authservice/models"
+)
+
+// fakeIssuer is an OpenID Connect issuer that hands out one code for the last authorization request it was given
+type fakeIssuer struct {
+	*httptest.Server
+	mu        sync.Mutex
+	challenge string
+	nonce     string
+	claims    map[string]interface{}
+}
+
+func newFakeIssuer(t *testing.T) *fakeIssuer {
+	t.Helper()
+	issuer := &fakeIssuer{claims: map[string]interface{}{
+		"sub":            "subject",
+		"email":          "user@example.com",
+		"email_verified": true,
+		"given_name":     "Jane",
+		"family_name":    "Doe",
+	}}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		_ = json.NewEncoder(w).Encode(map[string]string{
+			"issuer":                 issuer.URL,
+			"authorization_endpoint": issuer.URL + "/authorize",
+			"token_endpoint":         issuer.URL + "/token",
+			"userinfo_endpoint":      issuer.URL + "/userinfo",
+		})
+	})
+	mux.HandleFunc("/token", issuer.token)
+	mux.HandleFunc("/userinfo", func(w http.ResponseWriter, r *http.Request) {
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{"sub": issuer.claims["sub"]})
+	})
+	issuer.Server = httptest.NewServer(mux)
+	t.Cleanup(issuer.Close)
+
+	return issuer
+}
+
+// authorize plays the sign in of the user at the issuer and returns the callback the browser is sent to
+func (i *fakeIssuer) authorize(t *testing.T, authURL string) url.Values {
+	t.Helper()
+	u, err := url.Parse(authURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	query := u.Query()
+	if query.Get("code_challenge_method") != challengeMethod || query.Get("redirect_uri") != "https://auth.example.com/user/callback" {
+		t.Fatalf("unexpected authorization request %s", authURL)
+	}
+
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	i.challenge = query.Get("code_challenge")
+	i.nonce = query.Get("nonce")
+
+	return url.Values{"state": {query.Get("state")}, "code": {"code"}}
+}
+
+func (i *fakeIssuer) token(w http.ResponseWriter, r *http.Request) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	verifier := sha256.Sum256([]byte(r.FormValue("code_verifier")))
+	if r.FormValue("code") != "code" || base64.RawURLEncoding.EncodeToString(verifier[:]) != i.challenge {
+		w.WriteHeader(http.StatusBadRequest)
+		_, _ = io.WriteString(w, `{"error":"invalid_grant"}`)
+		return
+	}
+
+	claims := map[string]interface{}{"iss": i.URL, "aud": "client", "exp": time.Now().Add(time.Hour).Unix(),
+		"nonce": i.nonce}
+	for claim, value := range i.claims {
+		claims[claim] = value
+	}
+
+	payload, _ := json.Marshal(claims)
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(map[string]interface{}{
+		"access_token": "access",
+		"token_type":   "Bearer",
+		"expires_in":   3600,
+		"id_token":     fmt.Sprintf("e30.%s.sig", base64.RawURLEncoding.EncodeToString(payload)),
+	})
+}
+
+func newTestRegistry(t *testing.T, issuer *fakeIssuer) Registry {
+	t.Helper()
+	l := logrus.New()
+	l.SetOutput(io.Discard)
+	r := NewRegistry(l, []*Settings{{
+		Name:         "acme",
+		Type:         config.ProviderOIDC,
+		ClientId:     "client",
+		ClientSecret: "secret",
+		DiscoveryURL: issuer.URL + "/.well-known/openid-configuration",
+	}}, &Options{PublicURL: "https://auth.example.com", SessionKeys: []string{"key"}})
+	if !r.Enabled("acme") {
+		t.Fatal("issuer was not discovered")
+	}
+
+	return r
+}
+
+// begin starts a sign in and returns the authorization URL and the cookie holding the flow
+func begin(t *testing.T, r Registry) (string, []*http.Cookie) {
+	t.Helper()
+	w := httptest.NewRecorder()
+	authURL, err := r.Begin(w, httptest.NewRequest(http.MethodGet, "/users/auth/acme", nil),
+		&models.OAuthFlow{Provider: "acme"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return authURL, w.Result().Cookies()
+}
+
+func callback(r Registry, values url.Values, cookies []*http.Cookie) (*models.OAuthUser, *models.OAuthFlow, error) {
+	req := httptest.NewRequest(http.MethodGet, "/user/callback?"+values.Encode(), nil)
+	for _, cookie := range cookies {
+		req.AddCookie(cookie)
+	}
+
+	return r.Complete(httptest.NewRecorder(), req)
+}
+
+func TestCompleteSignsInWithGenericIssuer(t *testing.T) {
+	issuer := newFakeIssuer(t)
+	r := newTestRegistry(t, issuer)
+	authURL, cookies := begin(t, r)
+	user, flow, err := callback(r, issuer.authorize(t, authURL), cookies)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if flow.Provider != "acme" || user.Provider != "acme" || user.Subject != "subject" ||
+		user.Email != "user@example.com" || !user.EmailVerified || user.FirstName != "Jane" {
+		t.Fatalf("signed in %+v with %+v", user, flow)
+	}
+}
+
+func TestCompleteRejects(t *testing.T) {
+	tests := map[string]func(issuer *fakeIssuer, values url.Values, cookies []*http.Cookie) []*http.Cookie{
+		"another state": func(issuer *fakeIssuer, values url.Values, cookies []*http.Cookie) []*http.Cookie {
+			values.Set("state", "forged")
+			return cookies
+		},
+		"no stored flow": func(issuer *fakeIssuer, values url.Values, cookies []*http.Cookie) []*http.Cookie {
+			return nil
+		},
+		"another nonce": func(issuer *fakeIssuer, values url.Values, cookies []*http.Cookie) []*http.Cookie {
+			issuer.nonce = "forged"
+			return cookies
+		},
+		"another verifier": func(issuer *fakeIssuer, values url.Values, cookies []*http.Cookie) []*http.Cookie {
+			issuer.challenge = "forged"
+			return cookies
+		},
+		"provider error": func(issuer *fakeIssuer, values url.Values, cookies []*http.Cookie) []*http.Cookie {
+			values.Set("error", "access_denied")
+			return cookies
+		},
+	}
+
+	for name, tamper := range tests {
+		t.Run(name, func(t *testing.T) {
+			issuer := newFakeIssuer(t)
+			r := newTestRegistry(t, issuer)
+			authURL, cookies := begin(t, r)
+			values := issuer.authorize(t, authURL)
+			cookies = tamper(issuer, values, cookies)
+			_, _, err := callback(r, values, cookies)
+			if !errors.Is(err, models.ErrInvalidOAuthState) {
+				t.Fatalf("got %v, want an invalid sign in", err)
+			}
+		})
+	}
+}
+
+func TestEmailVerifiedFollowsTheIssuer(t *testing.T) {
+	issuer := newFakeIssuer(t)
+	issuer.claims["email_verified"] = false
+	r := newTestRegistry(t, issuer)
+	authURL, cookies := begin(t, r)
+	user, _, err := callback(r, issuer.authorize(t, authURL), cookies)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if user.EmailVerified {
+		t.Fatal("unverified email reported verified")
+	}
+}
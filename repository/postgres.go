@@ -4,6 +4,7 @@ import (
 	"context"
 	"fmt"
 
+	"github.com/jackc/pgconn"
 	"github.com/jackc/pgx/v4"
 	pg "github.com/jackc/pgx/v4/pgxpool"
 )
@@ -12,10 +13,18 @@ type PostgresQueryer interface {
 	Query(ctx context.Context, query string, params ...interface{}) (pgx.Rows, error)
 	QueryScan(ctx context.Context, query string, params ...interface{}) (PgResult, error)
 	Exec(ctx context.Context, query string, params ...interface{}) (int64, error)
+	WithTx(ctx context.Context, fn func(tx PostgresQueryer) error) error
+}
+
+// executor is implemented by both the pool and a transaction, so the same queryer works on either
+type executor interface {
+	Query(ctx context.Context, sql string, args ...interface{}) (pgx.Rows, error)
+	Exec(ctx context.Context, sql string, args ...interface{}) (pgconn.CommandTag, error)
+	Begin(ctx context.Context) (pgx.Tx, error)
 }
 
 type queryer struct {
-	conn *pg.Pool
+	conn executor
 }
 
 func NewPgQueryer(d *pg.Pool) PostgresQueryer {
@@ -49,4 +58,27 @@ func (q *queryer) Exec(ctx context.Context, query string, params ...interface{})
 	}
 
 	return res.RowsAffected(), nil
-}
\ No newline at end of file
+}
+
+// WithTx runs fn in a transaction that is committed when fn returns no error and rolled back otherwise.
+// Called on the queryer handed to fn it creates a savepoint, so a failing nested call only undoes its own work.
+// Rows returned by the queryer must be closed before the next statement is run on it.
+func (q *queryer) WithTx(ctx context.Context, fn func(tx PostgresQueryer) error) error {
+	tx, err := q.conn.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("withTx: unable to begin transaction: %s", err)
+	}
+
+	defer tx.Rollback(ctx)
+	err = fn(&queryer{conn: tx})
+	if err != nil {
+		return err
+	}
+
+	err = tx.Commit(ctx)
+	if err != nil {
+		return fmt.Errorf("withTx: unable to commit transaction: %s", err)
+	}
+
+	return nil
+}
@@ -15,6 +15,9 @@ import (
 type RedisQueryer interface {
 	GetString(ctx context.Context, key string) (string, error)
 	Set(ctx context.Context, key string, value interface{}, timeOut time.Duration) error
+	SetNX(ctx context.Context, key string, value interface{}, timeOut time.Duration) (bool, error)
+	Delete(ctx context.Context, keys ...string) error
+	Update(ctx context.Context, key string, timeOut time.Duration, update func(value []byte) ([]byte, error)) error
 	GetBytes(ctx context.Context, key string) ([]byte, error)
 	GetDelString(ctx context.Context, key string) (string, error)
 	IsRedisNil(err error) bool
@@ -25,7 +28,10 @@ type redisQueryer struct {
 	client *redis.Client
 }
 
-const listenerChannel = "notification-listener"
+const (
+	listenerChannel  = "notification-listener"
+	maxUpdateRetries = 20
+)
 
 func NewRedisQueryer(d *redis.Client) RedisQueryer {
 	return &redisQueryer{
@@ -42,6 +48,67 @@ func (r *redisQueryer) Set(ctx context.Context, key string, value interface{}, t
 	return nil
 }
 
+func (r *redisQueryer) SetNX(ctx context.Context, key string, value interface{}, timeOut time.Duration) (bool, error) {
+	res := r.client.SetNX(ctx, key, value, timeOut)
+	if err := res.Err(); err != nil {
+		return false, fmt.Errorf("setNX: unable to set key in redis: %s", err)
+	}
+
+	return res.Val(), nil
+}
+
+func (r *redisQueryer) Delete(ctx context.Context, keys ...string) error {
+	res := r.client.Del(ctx, keys...)
+	if err := res.Err(); err != nil {
+		return fmt.Errorf("delete: unable to delete keys from redis: %s", err)
+	}
+
+	return nil
+}
+
+// Update atomically replaces the value of key with the one returned by update. The key is watched while update runs
+// and the whole read/modify/write is retried when another client changes it in between, so concurrent updates never
+// overwrite each other. update receives nil when the key does not exist and leaves the key untouched by returning nil.
+func (r *redisQueryer) Update(ctx context.Context, key string, timeOut time.Duration, update func(value []byte) ([]byte, error)) error {
+	txf := func(tx *redis.Tx) error {
+		value, err := tx.Get(ctx, key).Bytes()
+		if err != nil && err != redis.Nil {
+			return fmt.Errorf("unable to get value from redis: %s", err)
+		}
+
+		value, err = update(value)
+		if err != nil {
+			return err
+		}
+
+		if value == nil {
+			return nil
+		}
+
+		_, err = tx.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+			pipe.Set(ctx, key, value, timeOut)
+			return nil
+		})
+
+		return err
+	}
+
+	for i := 0; i < maxUpdateRetries; i++ {
+		err := r.client.Watch(ctx, txf, key)
+		if err == redis.TxFailedErr {
+			continue
+		}
+
+		if err != nil {
+			return fmt.Errorf("update: %w", err)
+		}
+
+		return nil
+	}
+
+	return fmt.Errorf("update: too many concurrent updates of key %s", key)
+}
+
 func (r *redisQueryer) GetString(ctx context.Context, key string) (string, error) {
 	res := r.client.Get(ctx, key)
 	if err := res.Err(); err != nil {
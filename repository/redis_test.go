@@ -0,0 +1,80 @@
+package repository
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sync"
+	"testing"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// TestUpdateConcurrentWriters runs against the redis in REDIS_TEST_ADDR, e.g. localhost:6379
+func TestUpdateConcurrentWriters(t *testing.T) {
+	addr, found := os.LookupEnv("REDIS_TEST_ADDR")
+	if !found {
+		t.Skip("REDIS_TEST_ADDR is not set")
+	}
+
+	ctx := context.Background()
+	client := redis.NewClient(&redis.Options{Addr: addr, PoolSize: 8})
+	defer client.Close()
+	q := NewRedisQueryer(client)
+	key := fmt.Sprintf("update-test:%s", t.Name())
+	err := q.Delete(ctx, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer q.Delete(ctx, key)
+
+	const writers = 4
+	const writes = 25
+	errs := make(chan error, writers*writes)
+	var wg sync.WaitGroup
+	for w := 0; w < writers; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			for i := 0; i < writes; i++ {
+				errs <- q.Update(ctx, key, 0, func(value []byte) ([]byte, error) {
+					var sessions []string
+					if value != nil {
+						err := json.Unmarshal(value, &sessions)
+						if err != nil {
+							return nil, err
+						}
+					}
+
+					sessions = append(sessions, fmt.Sprintf("%d-%d", w, i))
+					return json.Marshal(sessions)
+				})
+			}
+		}(w)
+	}
+
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	value, err := q.GetBytes(ctx, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var sessions []string
+	err = json.Unmarshal(value, &sessions)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(sessions) != writers*writes {
+		t.Fatalf("%d sessions, want %d", len(sessions), writers*writes)
+	}
+}
@@ -95,3 +95,41 @@ func (e Error) Conflict(w http.ResponseWriter) error {
 
 	return nil
 }
+
+func (e Error) NotFound(w http.ResponseWriter) error {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(http.StatusNotFound)
+	err := json.NewEncoder(w).Encode(e)
+	if err != nil {
+		return fmt.Errorf("NotFound: unable to encode to JSON: %s", err)
+	}
+
+	return nil
+}
+
+func (e Error) TooManyRequests(w http.ResponseWriter) error {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(http.StatusTooManyRequests)
+	err := json.NewEncoder(w).Encode(e)
+	if err != nil {
+		return fmt.Errorf("TooManyRequests: unable to encode to JSON: %s", err)
+	}
+
+	return nil
+}
+
+// Raw writes the body as is, without the success envelope, for endpoints that follow an external spec
+type Raw struct {
+	Body interface{}
+}
+
+func (r Raw) Send(w http.ResponseWriter) error {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(http.StatusOK)
+	err := json.NewEncoder(w).Encode(r.Body)
+	if err != nil {
+		return fmt.Errorf("Send: unable to encode to JSON: %s", err)
+	}
+
+	return nil
+}
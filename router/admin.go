@@ -0,0 +1,18 @@
+package router
+
+import (
+	"github.com/sirupsen/logrus"
+
+	"authservice/constant"
+	"authservice/factory"
+	"authservice/handler"
+)
+
+func (r *router) adminRoutes(f factory.Factory, l *logrus.Logger) {
+	adminValidator := f.AdminValidator()
+	r.HandleFunc("/admin/keys/{keyType}/rotate", adminValidator.ValidateAdmin(handler.RotateKeys(f, l))).Methods(constant.POST)
+	r.HandleFunc("/admin/users/{userId}/session-policy", adminValidator.ValidateAdmin(handler.SetSessionPolicy(f, l))).Methods(constant.PUT)
+	r.HandleFunc("/admin/users/{userId}/session-policy", adminValidator.ValidateAdmin(handler.DeleteSessionPolicy(f, l))).Methods(constant.DELETE)
+	r.HandleFunc("/admin/users/{userId}/deactivate", adminValidator.ValidateAdmin(handler.SetUserDeactivated(f, l, true))).Methods(constant.POST)
+	r.HandleFunc("/admin/users/{userId}/reactivate", adminValidator.ValidateAdmin(handler.SetUserDeactivated(f, l, false))).Methods(constant.POST)
+}
@@ -0,0 +1,16 @@
+package router
+
+import (
+	"github.com/sirupsen/logrus"
+
+	"authservice/constant"
+	"authservice/factory"
+	"authservice/handler"
+)
+
+func (r *router) oauthRoutes(f factory.Factory, l *logrus.Logger) {
+	clientValidator := f.ClientValidator()
+	r.HandleFunc("/oauth/introspect", clientValidator.ValidateClient(handler.IntrospectToken(f, l))).Methods(constant.POST)
+	r.HandleFunc("/oauth/token", clientValidator.IdentifyClient(handler.ExchangeCode(f, l))).Methods(constant.POST)
+	r.HandleFunc("/oauth/revoke", clientValidator.IdentifyClient(handler.RevokeToken(f, l))).Methods(constant.POST)
+}
@@ -24,6 +24,10 @@ type router struct {
 
 func (r *router) registerRoutes(f factory.Factory, l *logrus.Logger) {
 	r.HandleFunc("/health", handler.Health).Methods(constant.GET)
+	r.HandleFunc("/.well-known/jwks.json", handler.JWKS(f)).Methods(constant.GET)
 	r.userRoutes(f, l)
 	r.addressRoutes(f, l)
+	r.sessionRoutes(f, l)
+	r.oauthRoutes(f, l)
+	r.adminRoutes(f, l)
 }
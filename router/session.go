@@ -0,0 +1,15 @@
+package router
+
+import (
+	"github.com/sirupsen/logrus"
+
+	"authservice/constant"
+	"authservice/factory"
+	"authservice/handler"
+)
+
+func (r *router) sessionRoutes(f factory.Factory, l *logrus.Logger) {
+	tokenValidator := f.TokenValidator()
+	r.HandleFunc("/users/{userId}/sessions", tokenValidator.ValidateToken(handler.GetSessions(f, l))).Methods(constant.GET)
+	r.HandleFunc("/users/{userId}/sessions/{sessionId}", tokenValidator.ValidateToken(handler.DeleteSession(f, l))).Methods(constant.DELETE)
+}
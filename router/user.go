@@ -16,16 +16,36 @@ func (r *router) userRoutes(f factory.Factory, l *logrus.Logger) {
 	r.HandleFunc("/users/clear", handler.LogoutUser(f, l, true)).Methods(constant.GET)
 	r.HandleFunc("/users/refresh", handler.RefreshToken(f, l)).Methods(constant.POST)
 	r.HandleFunc("/users/auth/otp", handler.VerifyOTP(f, l, true)).Methods(constant.POST)
+	r.HandleFunc("/users/auth/mfa", handler.CompleteMFALogin(f, l)).Methods(constant.POST)
+	r.HandleFunc("/users/auth/mfa/passkey/options", handler.BeginMFAPasskey(f, l)).Methods(constant.POST)
+	r.HandleFunc("/users/auth/magic-link", handler.SendMagicLink(f, l)).Methods(constant.POST)
+	r.HandleFunc("/users/auth/magic-link/verify", handler.MagicLinkLogin(f, l)).Methods(constant.POST)
+	r.HandleFunc("/users/auth/passkey/options", handler.BeginPasskeyLogin(f, l)).Methods(constant.POST)
+	r.HandleFunc("/users/auth/passkey", handler.PasskeyLogin(f, l)).Methods(constant.POST)
 	r.HandleFunc("/users/auth/verify", handler.VerifyToken(f, l)).Methods(constant.GET)
+	r.HandleFunc("/users/verify-email", handler.VerifyEmail(f, l)).Methods(constant.POST)
+	r.HandleFunc("/users/verify-email/resend", handler.ResendVerificationEmail(f, l)).Methods(constant.POST)
 	r.HandleFunc("/users/reset", handler.ResetPassword(f, l)).Methods(constant.POST)
 	r.HandleFunc("/users/reset/verify", handler.VerifyOTP(f, l, false)).Methods(constant.POST)
 	r.HandleFunc("/users/reset/change", handler.ChangePassword(f, l, true)).Methods(constant.POST)
 	r.HandleFunc("/users/{userId}/change", tokenValidator.ValidateToken(handler.ChangePassword(f, l, false))).Methods(constant.POST)
 	r.HandleFunc("/users/{userId}", tokenValidator.ValidateToken(handler.UpdateUser(f, l))).Methods(constant.PATCH)
+	r.HandleFunc("/users/{userId}/deactivate", tokenValidator.ValidateToken(handler.DeactivateUser(f, l))).Methods(constant.POST)
+	r.HandleFunc("/users/reactivate", handler.ReactivateUser(f, l)).Methods(constant.POST)
+	r.HandleFunc("/users/{userId}/mfa/totp", tokenValidator.ValidateToken(handler.EnrollTOTP(f, l))).Methods(constant.POST)
+	r.HandleFunc("/users/{userId}/mfa/totp", tokenValidator.ValidateToken(handler.DisableTOTP(f, l))).Methods(constant.DELETE)
+	r.HandleFunc("/users/{userId}/mfa/totp/confirm", tokenValidator.ValidateToken(handler.ConfirmTOTP(f, l))).Methods(constant.POST)
+	r.HandleFunc("/users/{userId}/passkeys", tokenValidator.ValidateToken(handler.ListPasskeys(f, l))).Methods(constant.GET)
+	r.HandleFunc("/users/{userId}/passkeys", tokenValidator.ValidateToken(handler.FinishPasskeyRegistration(f, l))).Methods(constant.POST)
+	r.HandleFunc("/users/{userId}/passkeys/options", tokenValidator.ValidateToken(handler.BeginPasskeyRegistration(f, l))).Methods(constant.POST)
+	r.HandleFunc("/users/{userId}/passkeys/{passkeyId}", tokenValidator.ValidateToken(handler.DeletePasskey(f, l))).Methods(constant.DELETE)
+	r.HandleFunc("/users/{userId}/identities", tokenValidator.ValidateToken(handler.ListIdentities(f, l))).Methods(constant.GET)
+	r.HandleFunc("/users/{userId}/identities", tokenValidator.ValidateToken(handler.LinkIdentity(f, l))).Methods(constant.POST)
+	r.HandleFunc("/users/{userId}/identities/{identityId}", tokenValidator.ValidateToken(handler.UnlinkIdentity(f, l))).Methods(constant.DELETE)
+	r.HandleFunc("/users/{userId}/mfa/recovery-codes", tokenValidator.ValidateToken(handler.RegenerateRecoveryCodes(f, l))).Methods(constant.POST)
 
 	// OAuth routes
-	handler.InitProviders(f)
-	r.HandleFunc("/user/{provider}/auth", handler.OAuth()).Methods(constant.GET)
-	r.HandleFunc("/user/{provider}/logout", handler.Logout(l)).Methods(constant.GET)
-	r.HandleFunc("/user/callback", handler.OAuthCallback(f, l)).Methods(constant.GET)
+	r.HandleFunc("/user/{provider}/auth", handler.OAuth(f, l)).Methods(constant.GET)
+	r.HandleFunc("/user/{provider}/logout", handler.Logout(f, l)).Methods(constant.GET)
+	r.HandleFunc("/user/callback", handler.OAuthCallback(f, l)).Methods(constant.GET, constant.POST)
 }
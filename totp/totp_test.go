@@ -0,0 +1,78 @@
+package totp
+
+import (
+	"net/url"
+	"testing"
+	"time"
+)
+
+// rfcSecret is the SHA1 secret of the RFC 6238 test vectors, "12345678901234567890" base32 encoded
+const rfcSecret = "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"
+
+func TestCodeMatchesRFC6238Vectors(t *testing.T) {
+	// the RFC lists 8 digit codes, 6 digit codes are their last 6 digits
+	vectors := map[int64]string{
+		59:          "287082",
+		1111111109:  "081804",
+		1111111111:  "050471",
+		1234567890:  "005924",
+		2000000000:  "279037",
+		20000000000: "353130",
+	}
+
+	for unix, want := range vectors {
+		code, err := Code(rfcSecret, Step(time.Unix(unix, 0)))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if code != want {
+			t.Errorf("at %d got %s, want %s", unix, code, want)
+		}
+	}
+}
+
+func TestValidateAcceptsAdjacentStepsOnce(t *testing.T) {
+	at := time.Unix(1234567890, 0)
+	current := Step(at)
+	for _, step := range []int64{current - 1, current, current + 1} {
+		code, _ := Code(rfcSecret, step)
+		got, valid := Validate(rfcSecret, code, at, 0)
+		if !valid || got != step {
+			t.Fatalf("code of step %d: got %d %v", step, got, valid)
+		}
+
+		if _, valid := Validate(rfcSecret, code, at, step); valid {
+			t.Fatalf("code of step %d accepted again after it was used", step)
+		}
+	}
+
+	code, _ := Code(rfcSecret, current+2)
+	if _, valid := Validate(rfcSecret, code, at, 0); valid {
+		t.Fatal("code two steps ahead accepted")
+	}
+
+	if _, valid := Validate(rfcSecret, "12345", at, 0); valid {
+		t.Fatal("short code accepted")
+	}
+}
+
+func TestGenerateSecretWorksWithURI(t *testing.T) {
+	secret, err := GenerateSecret()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := Code(secret, 1); err != nil {
+		t.Fatalf("generated secret unusable: %s", err)
+	}
+
+	uri, err := url.Parse(URI("Auth Service", "user@example.com", secret))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if uri.Scheme != "otpauth" || uri.Query().Get("secret") != secret || uri.Query().Get("digits") != "6" {
+		t.Fatalf("unexpected URI %s", uri)
+	}
+}
@@ -0,0 +1,124 @@
+package user
+
+import (
+	"context"
+	"testing"
+
+	"authservice/builder"
+	"authservice/identity"
+	"authservice/mfa"
+	"authservice/models"
+	"authservice/passkey"
+	"authservice/repository"
+)
+
+// accountPostgres finds the same account for every email
+type accountPostgres struct {
+	repository.PostgresQueryer
+	user models.User
+}
+
+func (p *accountPostgres) QueryScan(ctx context.Context, query string, params ...interface{}) (repository.PgResult, error) {
+	return &userResult{user: p.user}, nil
+}
+
+// unlinkedIdentity knows no provider account and records the ones added
+type unlinkedIdentity struct {
+	identity.Identity
+	added []string
+}
+
+func (i *unlinkedIdentity) Find(ctx context.Context, provider, subject string) (string, error) {
+	return "", nil
+}
+
+func (i *unlinkedIdentity) Add(ctx context.Context, userId string, oauthUser *models.OAuthUser) error {
+	i.added = append(i.added, userId)
+	return nil
+}
+
+func (i *unlinkedIdentity) PendingLink(oauthUser *models.OAuthUser) (*models.IdentityLink, error) {
+	return &models.IdentityLink{Token: "link", Provider: oauthUser.Provider, Email: oauthUser.Email}, nil
+}
+
+func TestOAuthLoginNeverSignsIntoExistingAccountsUnproven(t *testing.T) {
+	tests := []struct {
+		name             string
+		providerVerified bool
+		accountVerified  bool
+		password         string
+	}{
+		{name: "unverified provider email", providerVerified: false, accountVerified: true},
+		{name: "unverified account email", providerVerified: true, accountVerified: false},
+		{name: "account with a password", providerVerified: true, accountVerified: true, password: "hash"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			id, email := "victim", "victim@example.com"
+			account := models.User{Id: &id, Email: &email, Verified: &test.accountVerified}
+			if test.password != "" {
+				account.Password = &test.password
+			}
+
+			identities := &unlinkedIdentity{}
+			us := NewUser(builder.NewUserBuilder(), &accountPostgres{user: account}, nil, nil, nil, nil, nil, nil, nil,
+				nil, nil, nil, identities)
+			res, err := us.OAuthLogin(context.Background(), &models.OAuthUser{Provider: "oidc", Subject: "attacker",
+				Email: email, EmailVerified: test.providerVerified}, "")
+			if err != nil {
+				t.Fatalf("got %v, want a pending link", err)
+			}
+
+			if res.IdentityLink == nil || res.BearerToken != "" || res.RefreshToken != "" || res.User != nil {
+				t.Fatalf("got %+v, want only a pending link", res)
+			}
+
+			if len(identities.added) != 0 {
+				t.Fatalf("provider account linked to %v", identities.added)
+			}
+		})
+	}
+}
+
+// linkedIdentity links every provider account to user "user"
+type linkedIdentity struct {
+	identity.Identity
+}
+
+func (i linkedIdentity) Find(ctx context.Context, provider, subject string) (string, error) {
+	return "user", nil
+}
+
+// noSecondFactor has neither TOTP nor passkeys set up for anyone
+type noSecondFactor struct {
+	mfa.MFA
+	passkey.Passkey
+}
+
+func (n noSecondFactor) IsEnabled(ctx context.Context, userId string) (bool, error) {
+	return false, nil
+}
+
+func (n noSecondFactor) HasPasskeys(ctx context.Context, userId string) (bool, error) {
+	return false, nil
+}
+
+func TestOAuthLoginLeavesTheSessionToTheCodeExchange(t *testing.T) {
+	id, verified := "user", true
+	redis := &sessionsRedis{}
+	us := NewUser(builder.NewUserBuilder(), &accountPostgres{user: models.User{Id: &id, Verified: &verified}}, redis, nil,
+		nil, nil, nil, &models.EmailVerification{}, noSecondFactor{}, noSecondFactor{}, nil, nil, linkedIdentity{})
+	res, err := us.OAuthLogin(context.Background(), &models.OAuthUser{Provider: "oidc", Subject: "subject"}, "app")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if res.User == nil || res.User.GetId() != "user" || res.BearerToken != "" || res.RefreshToken != "" {
+		t.Fatalf("got %+v, want only the user to sign in", res)
+	}
+
+	if len(redis.updated) != 0 {
+		t.Fatal("session started before the code was exchanged")
+	}
+}
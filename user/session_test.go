@@ -0,0 +1,149 @@
+package user
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"runtime"
+	"sync"
+	"testing"
+	"time"
+
+	"authservice/auth"
+	"authservice/builder"
+	"authservice/client"
+	"authservice/constant"
+	"authservice/helper"
+	"authservice/models"
+	"authservice/repository"
+)
+
+// watchedRedis keeps values in memory and, like WATCH, retries an update whose key changed while it ran
+type watchedRedis struct {
+	repository.RedisQueryer
+	mu       sync.Mutex
+	values   map[string][]byte
+	versions map[string]int
+}
+
+func (r *watchedRedis) Update(ctx context.Context, key string, timeOut time.Duration, update func(value []byte) ([]byte, error)) error {
+	for {
+		r.mu.Lock()
+		value, version := r.values[key], r.versions[key]
+		r.mu.Unlock()
+
+		runtime.Gosched()
+		value, err := update(value)
+		if err != nil {
+			return fmt.Errorf("update: %w", err)
+		}
+
+		if value == nil {
+			return nil
+		}
+
+		r.mu.Lock()
+		if r.versions[key] != version {
+			r.mu.Unlock()
+			continue
+		}
+
+		r.values[key] = value
+		r.versions[key]++
+		r.mu.Unlock()
+		return nil
+	}
+}
+
+// sessionHelper derives the tokens of a refresh from the claims and the family
+type sessionHelper struct {
+	helper.Helper
+}
+
+func (h sessionHelper) UnMarshal(data []byte, dest interface{}) error {
+	return json.Unmarshal(data, dest)
+}
+
+func (h sessionHelper) GetJWT(userClaims map[string]interface{}, expiry time.Time) (string, error) {
+	return fmt.Sprintf("rotated-bearer-%v", userClaims["n"]), nil
+}
+
+func (h sessionHelper) EncodeClaims(userClaims map[string]interface{}, familyId string, sessionStart, expiry time.Time) (string, error) {
+	return "rotated-" + familyId, nil
+}
+
+type defaultClients struct {
+	client.Registry
+}
+
+func (c defaultClients) Lifetime(id string) models.TokenLifetime {
+	return models.TokenLifetime{}
+}
+
+func TestConcurrentSessionUpdatesLoseNoSession(t *testing.T) {
+	const n = 20
+	userMeta := models.UserMeta{UserId: "user"}
+	for i := 0; i < 2*n; i++ {
+		userMeta.ActiveTokens = append(userMeta.ActiveTokens, models.ActiveToken{SessionId: fmt.Sprintf("old-%d", i),
+			BearerToken: fmt.Sprintf("bearer-%d", i), RefreshToken: fmt.Sprintf("refresh-%d", i)})
+	}
+
+	redis := &watchedRedis{values: map[string][]byte{"user": userMeta.GetBytes()}, versions: map[string]int{}}
+	policy := &models.SessionPolicy{Mode: constant.SessionUnlimited}
+	us := NewUser(builder.NewUserBuilder(), nil, redis, sessionHelper{}, nil, nil, policy, nil, nil, nil, nil, nil, nil).(*user)
+	authorizer := auth.NewAuthorizer(sessionHelper{}, redis, defaultClients{})
+
+	ctx := context.Background()
+	errs := make(chan error, 3*n)
+	var wg sync.WaitGroup
+	for i := 0; i < n; i++ {
+		wg.Add(3)
+		go func(i int) {
+			defer wg.Done()
+			errs <- us.UpdateActiveTokens(ctx, "user", models.ActiveToken{SessionId: fmt.Sprintf("new-%d", i)})
+		}(i)
+		go func(i int) {
+			defer wg.Done()
+			refreshMeta := &models.RefreshMeta{UserClaims: map[string]interface{}{"id": "user", "n": i},
+				FamilyId: fmt.Sprintf("old-%d", i)}
+			_, err := authorizer.RefreshTokens(ctx, refreshMeta, fmt.Sprintf("bearer-%d", i), fmt.Sprintf("refresh-%d", i))
+			errs <- err
+		}(i)
+		go func(i int) {
+			defer wg.Done()
+			errs <- authorizer.InvalidateTokens(ctx, "user", fmt.Sprintf("bearer-%d", n+i), false)
+		}(i)
+	}
+
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var got models.UserMeta
+	err := json.Unmarshal(redis.values["user"], &got)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(got.ActiveTokens) != 2*n {
+		t.Fatalf("%d sessions, want %d", len(got.ActiveTokens), 2*n)
+	}
+
+	for i := 0; i < n; i++ {
+		if !got.ContainsSession(fmt.Sprintf("new-%d", i)) {
+			t.Fatalf("login %d lost", i)
+		}
+
+		if !got.ContainsRefreshToken(fmt.Sprintf("rotated-old-%d", i)) {
+			t.Fatalf("refresh %d lost", i)
+		}
+
+		if got.ContainsBearerToken(fmt.Sprintf("bearer-%d", n+i)) {
+			t.Fatalf("logout %d lost", i)
+		}
+	}
+}
@@ -2,14 +2,23 @@ package user
 
 import (
 	"context"
+	"crypto/subtle"
+	"encoding/json"
 	"fmt"
+	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	"authservice/builder"
+	"authservice/client"
 	"authservice/constant"
+	"authservice/hasher"
 	"authservice/helper"
+	"authservice/identity"
+	"authservice/mfa"
 	"authservice/models"
+	"authservice/passkey"
 	"authservice/repository"
 )
 
@@ -17,14 +26,24 @@ type User interface {
 	Register(ctx context.Context, user *models.User) (*models.User, error)
 	GetUser(ctx context.Context, id, phone, email string) (bool, *models.User, error)
 	Login(ctx context.Context, user *models.LoginUser) (*models.AuthUser, error)
-	LoginWithOTP(ctx context.Context, user *models.LoginUser) (string, error)
-	VerifyOTP(ctx context.Context, user *models.LoginUser) (bool, error)
+	CompleteMFALogin(ctx context.Context, login *models.MFALogin) (*models.AuthUser, error)
+	LoginWithPasskey(ctx context.Context, login *models.PasskeyLogin) (*models.AuthUser, error)
+	SendMagicLink(ctx context.Context, req *models.MagicLinkRequest) error
+	LoginWithMagicLink(ctx context.Context, login *models.MagicLinkLogin) (*models.AuthUser, error)
+	SendOTP(ctx context.Context, purpose string, user *models.LoginUser) (string, error)
+	VerifyOTP(ctx context.Context, purpose string, user *models.LoginUser) (*models.OTP, error)
 	IsDeactivated(ctx context.Context, user *models.User) (bool, error)
-	OAuthLogin(ctx context.Context, user models.User) (*models.AuthUser, error)
+	OAuthLogin(ctx context.Context, oauthUser *models.OAuthUser, clientId string) (*models.AuthUser, error)
+	StartSession(ctx context.Context, userId, clientId string, device models.DeviceInfo) (*models.AuthUser, error)
 	ChangePassword(ctx context.Context, id string, cpr *models.ChangePasswordRequest) error
 	ResetPassword(ctx context.Context, cpr *models.ChangePasswordRequest) error
-	GetResetSecret(ctx context.Context, phone string) (string, error)
+	GetResetSecret(ctx context.Context, userId string) (string, error)
 	UpdateUser(ctx context.Context, user *models.User) (*models.User, error)
+	Deactivate(ctx context.Context, userId, by string) error
+	Reactivate(ctx context.Context, userId string) error
+	ReactivateWithCredentials(ctx context.Context, user *models.LoginUser) error
+	SendVerificationEmail(ctx context.Context, email string) error
+	VerifyEmail(ctx context.Context, token string) (*models.User, error)
 }
 
 type user struct {
@@ -32,95 +51,490 @@ type user struct {
 	postgres repository.PostgresQueryer
 	redis    repository.RedisQueryer
 	helper   helper.Helper
+	hasher   hasher.Hasher
+	clients  client.Registry
+	policy   *models.SessionPolicy
+
+	verification *models.EmailVerification
+	mfa          mfa.MFA
+	passkey      passkey.Passkey
+	otp          *models.OTPPolicy
+	magicLink    *models.MagicLink
+	identity     identity.Identity
 }
 
-func NewUser(b builder.UserBuilder, p repository.PostgresQueryer, r repository.RedisQueryer, h helper.Helper) User {
+// the hasher configuration is fixed for the lifetime of the process, so one dummy hash serves every user service
+var (
+	dummyOnce sync.Once
+	dummy     string
+)
+
+func NewUser(b builder.UserBuilder, p repository.PostgresQueryer, r repository.RedisQueryer, h helper.Helper, ph hasher.Hasher,
+	c client.Registry, sp *models.SessionPolicy, ev *models.EmailVerification, m mfa.MFA,
+	pk passkey.Passkey, op *models.OTPPolicy, ml *models.MagicLink, id identity.Identity) User {
 	return &user{
-		builder:  b,
-		postgres: p,
-		redis:    r,
-		helper:   h,
+		builder:      b,
+		postgres:     p,
+		redis:        r,
+		helper:       h,
+		hasher:       ph,
+		clients:      c,
+		policy:       sp,
+		verification: ev,
+		mfa:          m,
+		passkey:      pk,
+		otp:          op,
+		magicLink:    ml,
+		identity:     id,
 	}
 }
 
+// IsDeactivated reports whether the account was deactivated, reading it from the database when user was not loaded from it
 func (u *user) IsDeactivated(ctx context.Context, user *models.User) (bool, error) {
-	return false, nil
+	if user.Deleted != nil {
+		return *user.Deleted, nil
+	}
+
+	exists, us, err := u.GetUser(ctx, user.GetId(), "", "")
+	if err != nil {
+		return false, fmt.Errorf("isDeactivated: %s", err)
+	}
+
+	if !exists {
+		return false, fmt.Errorf("isDeactivated: %w", models.ErrUserNotFound)
+	}
+
+	return us.GetDeleted(), nil
 }
 
 func (u *user) Login(ctx context.Context, user *models.LoginUser) (*models.AuthUser, error) {
-	query := u.builder.Login(user.LoginType)
-	res, err := u.postgres.QueryScan(ctx, query, user.Email, user.Phone, u.helper.Hash(user.Password))
+	us, err := u.authenticate(ctx, user)
 	if err != nil {
-		return nil, fmt.Errorf("login: unable to query data: %s", err)
+		return nil, fmt.Errorf("login: %w", err)
 	}
 
-	defer res.Close()
-	if !res.Next() {
-		return nil, fmt.Errorf("login: user not found")
+	return u.completeLogin(ctx, us, user.ClientId, user.Device)
+}
+
+// completeLogin either issues the session or answers with an MFA challenge
+func (u *user) completeLogin(ctx context.Context, us *models.User, clientId string, device models.DeviceInfo) (*models.AuthUser, error) {
+	challenge, err := u.challengeLogin(ctx, us, clientId)
+	if err != nil {
+		return nil, fmt.Errorf("completeLogin: %w", err)
 	}
 
-	var us models.User
-	err = res.Scan(&us)
+	if challenge != nil {
+		return challenge, nil
+	}
+
+	return u.login(ctx, us, clientId, device)
+}
+
+// challengeLogin runs the account checks and answers with an MFA challenge when the user has a second factor
+func (u *user) challengeLogin(ctx context.Context, us *models.User, clientId string) (*models.AuthUser, error) {
+	if us.GetDeleted() {
+		return nil, fmt.Errorf("challengeLogin: %w", models.ErrAccountDeactivated)
+	}
+
+	if u.verification.Required && !us.GetVerified() {
+		return nil, fmt.Errorf("challengeLogin: %w", models.ErrEmailNotVerified)
+	}
+
+	methods, err := u.mfaMethods(ctx, us.GetId())
+	if err != nil {
+		return nil, fmt.Errorf("challengeLogin: %s", err)
+	}
+
+	if len(methods) == 0 {
+		return nil, nil
+	}
+
+	challenge, err := u.mfa.Challenge(ctx, us.GetId(), clientId, methods)
+	if err != nil {
+		return nil, fmt.Errorf("challengeLogin: %s", err)
+	}
+
+	return &models.AuthUser{MFAChallenge: challenge}, nil
+}
+
+// mfaMethods lists the second factors the user has set up, registered passkeys count as one
+func (u *user) mfaMethods(ctx context.Context, userId string) ([]string, error) {
+	var methods []string
+	enabled, err := u.mfa.IsEnabled(ctx, userId)
+	if err != nil {
+		return nil, fmt.Errorf("mfaMethods: %s", err)
+	}
+
+	if enabled {
+		methods = append(methods, constant.MFATOTP, constant.MFARecoveryCode)
+	}
+
+	hasPasskeys, err := u.passkey.HasPasskeys(ctx, userId)
+	if err != nil {
+		return nil, fmt.Errorf("mfaMethods: %s", err)
+	}
+
+	if hasPasskeys {
+		methods = append(methods, constant.MFAPasskey)
+	}
+
+	return methods, nil
+}
+
+// CompleteMFALogin finishes a login that was answered with an MFA challenge
+func (u *user) CompleteMFALogin(ctx context.Context, login *models.MFALogin) (*models.AuthUser, error) {
+	claims, err := u.mfa.OpenChallenge(ctx, login.ChallengeToken)
+	if err != nil {
+		return nil, fmt.Errorf("completeMFALogin: %w", err)
+	}
+
+	if login.Passkey != nil {
+		var userId string
+		userId, err = u.passkey.FinishLogin(ctx, login.Passkey, true)
+		if err == nil && userId != claims.UserId {
+			err = fmt.Errorf("%w: passkey belongs to another user", models.ErrInvalidPasskey)
+		}
+	} else {
+		err = u.mfa.Verify(ctx, claims.UserId, login.Code)
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("completeMFALogin: %w", err)
+	}
+
+	err = u.mfa.CloseChallenge(ctx, claims)
+	if err != nil {
+		return nil, fmt.Errorf("completeMFALogin: %s", err)
+	}
+
+	exists, us, err := u.GetUser(ctx, claims.UserId, "", "")
+	if err != nil {
+		return nil, fmt.Errorf("completeMFALogin: %s", err)
+	}
+
+	if !exists {
+		return nil, fmt.Errorf("completeMFALogin: %w", models.ErrUserNotFound)
+	}
+
+	if us.GetDeleted() {
+		return nil, fmt.Errorf("completeMFALogin: %w", models.ErrAccountDeactivated)
+	}
+
+	if u.verification.Required && !us.GetVerified() {
+		return nil, fmt.Errorf("completeMFALogin: %w", models.ErrEmailNotVerified)
+	}
+
+	return u.login(ctx, us, claims.ClientId, login.Device)
+}
+
+// LoginWithPasskey signs the user in with a passkey alone, which counts as a second factor
+func (u *user) LoginWithPasskey(ctx context.Context, login *models.PasskeyLogin) (*models.AuthUser, error) {
+	userId, err := u.passkey.FinishLogin(ctx, &login.PasskeyAssertion, false)
+	if err != nil {
+		return nil, fmt.Errorf("loginWithPasskey: %w", err)
+	}
+
+	exists, us, err := u.GetUser(ctx, userId, "", "")
+	if err != nil {
+		return nil, fmt.Errorf("loginWithPasskey: %s", err)
+	}
+
+	if !exists {
+		return nil, fmt.Errorf("loginWithPasskey: %w", models.ErrUserNotFound)
+	}
+
+	if us.GetDeleted() {
+		return nil, fmt.Errorf("loginWithPasskey: %w", models.ErrAccountDeactivated)
+	}
+
+	if u.verification.Required && !us.GetVerified() {
+		return nil, fmt.Errorf("loginWithPasskey: %w", models.ErrEmailNotVerified)
+	}
+
+	return u.login(ctx, us, login.ClientId, login.Device)
+}
+
+// SendMagicLink emails a single use login link, it shares the rate limits of the OTP codes
+func (u *user) SendMagicLink(ctx context.Context, req *models.MagicLinkRequest) error {
+	exists, us, err := u.GetUser(ctx, "", req.Email, "")
+	if err != nil {
+		return fmt.Errorf("sendMagicLink: %s", err)
+	}
+
+	if !exists || us.GetEmail() == "" {
+		return fmt.Errorf("sendMagicLink: %w", models.ErrUserNotFound)
+	}
+
+	if us.GetDeleted() {
+		return fmt.Errorf("sendMagicLink: %w", models.ErrAccountDeactivated)
+	}
+
+	err = u.limitOTP(ctx, us.GetId())
+	if err != nil {
+		return fmt.Errorf("sendMagicLink: %w", err)
+	}
+
+	token, err := u.helper.Sign(constant.PurposeMagicLink, &models.MagicLinkClaims{
+		Id:       u.helper.NewId(),
+		UserId:   us.GetId(),
+		Email:    us.GetEmail(),
+		ClientId: req.ClientId,
+	}, time.Now().Add(u.magicLink.TTL))
+	if err != nil {
+		return fmt.Errorf("sendMagicLink: unable to create token: %s", err)
+	}
+
+	message := fmt.Sprintf("Your POUSHAK login code is %s", token)
+	if u.magicLink.URL != "" {
+		message = fmt.Sprintf("Sign in to POUSHAK by opening %s?token=%s", u.magicLink.URL, token)
+	}
+
+	err = u.helper.SendEmail(ctx, constant.NotificationMagicLink, "Your login link", []string{us.GetEmail()}, message)
+	if err != nil {
+		return fmt.Errorf("sendMagicLink: %s", err)
+	}
+
+	return nil
+}
+
+// LoginWithMagicLink exchanges a login link for the session and verifies the email
+func (u *user) LoginWithMagicLink(ctx context.Context, login *models.MagicLinkLogin) (*models.AuthUser, error) {
+	var claims models.MagicLinkClaims
+	err := u.helper.VerifySigned(constant.PurposeMagicLink, login.Token, &claims)
+	if err != nil {
+		return nil, fmt.Errorf("loginWithMagicLink: %w: %s", models.ErrInvalidMagicLink, err)
+	}
+
+	unused, err := u.redis.SetNX(ctx, fmt.Sprintf("magic-link:used:%s", claims.Id), 1, u.magicLink.TTL)
+	if err != nil {
+		return nil, fmt.Errorf("loginWithMagicLink: unable to mark link as used: %s", err)
+	}
+
+	if !unused {
+		return nil, fmt.Errorf("loginWithMagicLink: %w: link was already used", models.ErrInvalidMagicLink)
+	}
+
+	exists, us, err := u.GetUser(ctx, claims.UserId, "", "")
 	if err != nil {
-		return nil, fmt.Errorf("login: unable to decode user: %s", err)
+		return nil, fmt.Errorf("loginWithMagicLink: %s", err)
 	}
 
+	if !exists || us.GetEmail() != claims.Email {
+		return nil, fmt.Errorf("loginWithMagicLink: %w: email address has changed", models.ErrInvalidMagicLink)
+	}
+
+	if !us.GetVerified() && !us.GetDeleted() {
+		_, err = u.postgres.Exec(ctx, u.builder.VerifyEmail(), us.GetId(), us.GetEmail())
+		if err != nil {
+			return nil, fmt.Errorf("loginWithMagicLink: unable to verify email: %s", err)
+		}
+
+		verified := true
+		us.Verified = &verified
+	}
+
+	return u.completeLogin(ctx, us, claims.ClientId, login.Device)
+}
+
+func (u *user) login(ctx context.Context, us *models.User, clientId string, device models.DeviceInfo) (*models.AuthUser, error) {
 	claims := map[string]interface{}{
 		"id":        us.GetId(),
 		"name": fmt.Sprintf("%s %s", us.GetFirstName(), us.GetLastName()),
 	}
-	token, err := u.helper.GetJWT(claims)
+	authUser, err := u.issueTokens(ctx, us.GetId(), claims, clientId, device)
 	if err != nil {
-		return nil, fmt.Errorf("login: unable to get JWT: %s", err)
+		return nil, fmt.Errorf("login: %w", err)
+	}
+
+	authUser.User = us
+	return authUser, nil
+}
+
+// authenticate loads the user and checks the password
+func (u *user) authenticate(ctx context.Context, user *models.LoginUser) (*models.User, error) {
+	if user.LoginType == "otp" {
+		exists, us, err := u.GetUser(ctx, user.UserId, "", "")
+		if err != nil {
+			return nil, fmt.Errorf("authenticate: %s", err)
+		}
+
+		if user.UserId == "" || !exists {
+			return nil, fmt.Errorf("authenticate: %w", models.ErrInvalidCredentials)
+		}
+
+		return us, nil
 	}
 
-	refreshToken, err := u.helper.EncodeClaims(claims)
+	query := u.builder.Login()
+	res, err := u.postgres.QueryScan(ctx, query, user.Email, user.Phone)
 	if err != nil {
-		return nil, fmt.Errorf("login: unable to get refresh token: %s", err)
+		return nil, fmt.Errorf("authenticate: unable to query data: %s", err)
+	}
+
+	defer res.Close()
+	var us models.User
+	found := res.Next()
+	if found {
+		err = res.Scan(&us)
+		if err != nil {
+			return nil, fmt.Errorf("authenticate: unable to decode user: %s", err)
+		}
+	}
+
+	// unknown users and users without a password take as long as a wrong password
+	passwordHash := us.GetPassword()
+	us.Password = nil
+	hasPassword := passwordHash != ""
+	if !hasPassword {
+		passwordHash = u.dummyHash()
 	}
 
-	err = u.UpdateActiveTokens(ctx, us.GetId(), token, refreshToken)
+	valid, err := u.hasher.Verify(user.Password, passwordHash)
 	if err != nil {
-		return nil, fmt.Errorf("login: unable to store user meta: %s", err)
+		return nil, fmt.Errorf("authenticate: unable to verify password: %s", err)
 	}
 
-	return &models.AuthUser{User: &us, BearerToken: token, RefreshToken: refreshToken}, nil
+	if !found || !hasPassword || !valid {
+		return nil, fmt.Errorf("authenticate: %w", models.ErrInvalidCredentials)
+	}
+
+	if u.hasher.NeedsRehash(passwordHash) {
+		_ = u.rehashPassword(ctx, us.GetId(), user.Password)
+	}
+
+	return &us, nil
+}
+
+func (u *user) dummyHash() string {
+	dummyOnce.Do(func() {
+		dummy, _ = u.hasher.Hash("dummy password")
+	})
+
+	return dummy
 }
 
-func (u *user) LoginWithOTP(ctx context.Context, user *models.LoginUser) (string, error) {
-	exists, _, err := u.GetUser(ctx, "", user.Email, user.Phone)
+// SendOTP sends a code for purpose by email or SMS, whichever the user asked with
+func (u *user) SendOTP(ctx context.Context, purpose string, user *models.LoginUser) (string, error) {
+	exists, us, err := u.GetUser(ctx, "", user.Email, user.Phone)
 	if err != nil {
-		return "", fmt.Errorf("LoginWithOTP: %s", err)
+		return "", fmt.Errorf("sendOTP: %s", err)
 	}
 
 	if !exists {
-		return "", fmt.Errorf("LoginWithOTP: user not registered")
+		return "", fmt.Errorf("sendOTP: %w", models.ErrUserNotFound)
+	}
+
+	if us.GetDeleted() {
+		return "", fmt.Errorf("sendOTP: %w", models.ErrAccountDeactivated)
+	}
+
+	channel, sentTo := constant.ChannelSMS, us.GetPhone()
+	if user.Email != "" {
+		channel, sentTo = constant.ChannelEmail, us.GetEmail()
+	}
+
+	if sentTo == "" {
+		return "", fmt.Errorf("sendOTP: %w", models.ErrPhoneNotSet)
 	}
 
-	nonce, err := u.helper.SendOTP(ctx, user.Phone)
+	err = u.limitOTP(ctx, us.GetId())
 	if err != nil {
-		return "", fmt.Errorf("LoginWithOTP: unable to send OTP: %s", err)
+		return "", fmt.Errorf("sendOTP: %w", err)
+	}
+
+	nonce, err := u.helper.SendOTP(ctx, &models.OTP{
+		Purpose: purpose,
+		UserId:  us.GetId(),
+		Email:   user.Email,
+		Phone:   user.Phone,
+		Channel: channel,
+		SentTo:  sentTo,
+	})
+	if err != nil {
+		return "", fmt.Errorf("sendOTP: unable to send OTP: %s", err)
 	}
 
 	return nonce, nil
 }
 
-func (u *user) VerifyOTP(ctx context.Context, user *models.LoginUser) (bool, error) {
-	savedOtp, err := u.redis.GetString(ctx, user.Nonce)
+// limitOTP enforces the resend cooldown and the daily number of codes of an account
+func (u *user) limitOTP(ctx context.Context, userId string) error {
+	ok, err := u.redis.SetNX(ctx, fmt.Sprintf("otp:cooldown:%s", userId), 1, u.otp.ResendCooldown)
+	if err != nil {
+		return fmt.Errorf("limitOTP: unable to set cooldown: %s", err)
+	}
+
+	if !ok {
+		return fmt.Errorf("limitOTP: %w", models.ErrOTPResendCooldown)
+	}
+
+	dailyKey := fmt.Sprintf("otp:daily:%s:%s", userId, time.Now().UTC().Format("20060102"))
+	err = u.redis.Update(ctx, dailyKey, 24*time.Hour, func(value []byte) ([]byte, error) {
+		sent, _ := strconv.Atoi(string(value))
+		if sent >= u.otp.DailyLimit {
+			return nil, models.ErrOTPDailyLimit
+		}
+
+		return []byte(strconv.Itoa(sent + 1)), nil
+	})
+	if err != nil {
+		return fmt.Errorf("limitOTP: %w", err)
+	}
+
+	return nil
+}
+
+// VerifyOTP returns the record of a valid code for the nonce, nil when the code is not valid
+func (u *user) VerifyOTP(ctx context.Context, purpose string, user *models.LoginUser) (*models.OTP, error) {
+	var verified *models.OTP
+	err := u.redis.Update(ctx, user.Nonce, models.OTPLifetime, func(value []byte) ([]byte, error) {
+		verified = nil
+		if value == nil {
+			return nil, nil
+		}
+
+		var otp models.OTP
+		err := json.Unmarshal(value, &otp)
+		if err != nil {
+			return nil, fmt.Errorf("unable to decode OTP: %s", err)
+		}
+
+		if time.Now().Unix() > otp.ExpiresAt {
+			return nil, nil
+		}
+
+		if otp.Attempts >= u.otp.MaxAttempts {
+			return nil, models.ErrTooManyAttempts
+		}
+
+		if otp.Purpose == purpose && otp.Matches(user.Email, user.Phone) &&
+			subtle.ConstantTimeCompare([]byte(otp.Code), []byte(user.OTP)) == 1 {
+			verified = &otp
+			otp.Attempts = u.otp.MaxAttempts
+		} else {
+			otp.Attempts++
+		}
+
+		return u.helper.Marshal(&otp), nil
+	})
 	if err != nil {
-		return false, fmt.Errorf("VerifyOTP: unable to get OTP: %s", err)
+		return nil, fmt.Errorf("verifyOTP: %w", err)
 	}
 
-	if savedOtp != user.OTP {
-		return false, nil
+	if verified != nil {
+		_ = u.redis.Delete(ctx, user.Nonce)
 	}
 
-	return true, nil
+	return verified, nil
 }
 
 func (u *user) GetUser(ctx context.Context, id, email, phone string) (bool, *models.User, error) {
+	return u.getUser(ctx, u.postgres, id, email, phone)
+}
+
+func (u *user) getUser(ctx context.Context, q repository.PostgresQueryer, id, email, phone string) (bool, *models.User, error) {
 	query := u.builder.GetUser()
-	res, err := u.postgres.QueryScan(ctx, query, id, email, phone)
+	res, err := q.QueryScan(ctx, query, id, email, phone)
 	if err != nil {
 		return false, nil, fmt.Errorf("GetUser: unable to fetch user: %s", err)
 	}
@@ -142,95 +556,239 @@ func (u *user) GetUser(ctx context.Context, id, email, phone string) (bool, *mod
 func (u *user) Register(ctx context.Context, user *models.User) (*models.User, error) {
 	id := u.helper.NewId()
 	user.Id = &id
-	query := u.builder.Register(user.GetMap())
-	_, err := u.postgres.Exec(ctx, query, user.GetDOB(), u.helper.Hash(user.GetPassword()))
+	passwordHash, err := u.hasher.Hash(user.GetPassword())
 	if err != nil {
-		if !strings.Contains(err.Error(), "duplicate key") {
-			return nil, fmt.Errorf("register: unable to save data: %s", err)
+		return nil, fmt.Errorf("register: unable to hash password: %s", err)
+	}
+
+	fields := user.GetMap()
+	fields["dob"] = user.GetDOB()
+	fields["password"] = passwordHash
+	query, args := u.builder.Register(fields)
+	_, err = u.postgres.Exec(ctx, query, args...)
+	if err != nil {
+		if strings.Contains(err.Error(), "duplicate key") {
+			return nil, fmt.Errorf("register: %w", models.ErrUserExists)
 		}
+
+		return nil, fmt.Errorf("register: unable to save data: %s", err)
 	}
 
 	user.Password = nil
 	user.ConfirmPassword = ""
+	if user.GetEmail() != "" {
+		// a failure to send is not fatal, the user can ask for the email again
+		_ = u.sendVerification(ctx, user.GetId(), user.GetEmail())
+	}
 
 	return user, nil
 }
 
-func (u *user) OAuthLogin(ctx context.Context, user models.User) (*models.AuthUser, error) {
-	query := u.builder.Login("")
-	res, err := u.postgres.QueryScan(ctx, query, user.Email)
+// OAuthLogin finds the user to sign in for the provider account, the session is started once the client exchanges its code
+func (u *user) OAuthLogin(ctx context.Context, oauthUser *models.OAuthUser, clientId string) (*models.AuthUser, error) {
+	userId, err := u.identity.Find(ctx, oauthUser.Provider, oauthUser.Subject)
+	if err != nil {
+		return nil, fmt.Errorf("oAuthLogin: %s", err)
+	}
+
+	if userId != "" {
+		exists, us, err := u.GetUser(ctx, userId, "", "")
+		if err != nil || !exists {
+			return nil, fmt.Errorf("oAuthLogin: unable to get user: %v", err)
+		}
+
+		return u.oAuthSignIn(ctx, us, clientId)
+	}
+
+	if oauthUser.Email == "" {
+		return nil, fmt.Errorf("oAuthLogin: %w", models.ErrOAuthEmailMissing)
+	}
+
+	res, err := u.postgres.QueryScan(ctx, u.builder.Login(), oauthUser.Email, nil)
 	if err != nil {
 		return nil, fmt.Errorf("oAuthLogin: unable to query data: %s", err)
 	}
 
 	if !res.Next() {
-		query := u.builder.OAuthRegister()
-		res, err := u.postgres.QueryScan(ctx, query, user.Email, user.FirstName, user.LastName)
+		res.Close()
+		us, err := u.oAuthRegister(ctx, oauthUser)
 		if err != nil {
-			return nil, fmt.Errorf("oAuthLogin: unable to register user: %s", err)
+			return nil, fmt.Errorf("oAuthLogin: %s", err)
 		}
 
-		if res.Next() {
-			err = res.Scan(&user)
-			res.Close()
-			if err != nil {
-				return nil, fmt.Errorf("oAuthLogin: unable to decode user: %s", err)
-			}
-		}
-	} else {
-		err = res.Scan(&user)
-		res.Close()
+		return u.oAuthSignIn(ctx, us, clientId)
+	}
+
+	var us models.User
+	err = res.Scan(&us)
+	res.Close()
+	if err != nil {
+		return nil, fmt.Errorf("oAuthLogin: unable to decode user: %s", err)
+	}
+
+	hasPassword := us.GetPassword() != ""
+	us.Password = nil
+	if hasPassword || !oauthUser.EmailVerified || !us.GetVerified() {
+		link, err := u.identity.PendingLink(oauthUser)
 		if err != nil {
-			return nil, fmt.Errorf("oAuthLogin: unable to decode user: %s", err)
+			return nil, fmt.Errorf("oAuthLogin: %s", err)
 		}
+
+		return &models.AuthUser{IdentityLink: link}, nil
 	}
 
-	claims := map[string]interface{}{
-		"id":        user.Id,
-		"firstName": user.FirstName,
-		"userType":  constant.User,
+	err = u.identity.Add(ctx, us.GetId(), oauthUser)
+	if err != nil {
+		return nil, fmt.Errorf("oAuthLogin: %w", err)
+	}
+
+	return u.oAuthSignIn(ctx, &us, clientId)
+}
+
+// oAuthSignIn answers with the user to start a session for, or with an MFA challenge
+func (u *user) oAuthSignIn(ctx context.Context, us *models.User, clientId string) (*models.AuthUser, error) {
+	challenge, err := u.challengeLogin(ctx, us, clientId)
+	if err != nil {
+		return nil, fmt.Errorf("oAuthSignIn: %w", err)
+	}
+
+	if challenge != nil {
+		return challenge, nil
 	}
-	token, err := u.helper.GetJWT(claims)
+
+	return &models.AuthUser{User: us}, nil
+}
+
+// StartSession issues the session of a sign in that was handed to a client as a code
+func (u *user) StartSession(ctx context.Context, userId, clientId string, device models.DeviceInfo) (*models.AuthUser, error) {
+	exists, us, err := u.GetUser(ctx, userId, "", "")
 	if err != nil {
-		return nil, fmt.Errorf("oAuthLogin: unable to get JWT: %s", err)
+		return nil, fmt.Errorf("startSession: %s", err)
+	}
+
+	if !exists {
+		return nil, fmt.Errorf("startSession: %w", models.ErrUserNotFound)
 	}
 
-	refreshToken, err := u.helper.EncodeClaims(claims)
+	if us.GetDeleted() {
+		return nil, fmt.Errorf("startSession: %w", models.ErrAccountDeactivated)
+	}
+
+	if u.verification.Required && !us.GetVerified() {
+		return nil, fmt.Errorf("startSession: %w", models.ErrEmailNotVerified)
+	}
+
+	return u.login(ctx, us, clientId, device)
+
+}
+
+// oAuthRegister creates the user linked to the provider account
+func (u *user) oAuthRegister(ctx context.Context, oauthUser *models.OAuthUser) (*models.User, error) {
+	res, err := u.postgres.QueryScan(ctx, u.builder.OAuthRegister(), u.helper.NewId(), oauthUser.FirstName,
+		oauthUser.LastName, oauthUser.Email, oauthUser.EmailVerified, u.helper.NewId(), oauthUser.Provider,
+		oauthUser.Subject)
 	if err != nil {
-		return nil, fmt.Errorf("oAuthLogin: unable to get refresh token: %s", err)
+		return nil, fmt.Errorf("oAuthRegister: unable to register user: %s", err)
 	}
 
-	err = u.UpdateActiveTokens(ctx, user.GetId(), token, refreshToken)
+	if !res.Next() {
+		res.Close()
+		return nil, fmt.Errorf("oAuthRegister: email was registered meanwhile")
+	}
+
+	var us models.User
+	err = res.Scan(&us)
+	res.Close()
 	if err != nil {
-		return nil, fmt.Errorf("oAuthLogin: unable to store user meta: %s", err)
+		return nil, fmt.Errorf("oAuthRegister: unable to decode user: %s", err)
 	}
 
-	return &models.AuthUser{User: &user, BearerToken: token, RefreshToken: refreshToken}, nil
+	if !us.GetVerified() {
+		// a failure to send is not fatal, the user can ask for the email again
+		_ = u.sendVerification(ctx, us.GetId(), us.GetEmail())
+	}
+
+	return &us, nil
 }
 
 func (u *user) ChangePassword(ctx context.Context, id string, cpr *models.ChangePasswordRequest) error {
-	query := u.builder.ChangePassword()
-	res, err := u.postgres.Exec(ctx, query, u.helper.Hash(cpr.NewPassword), u.helper.Hash(cpr.CurrentPassword), id)
+	err := u.postgres.WithTx(ctx, func(tx repository.PostgresQueryer) error {
+		passwordHash, err := u.getPassword(ctx, tx, id)
+		if err != nil {
+			return err
+		}
+
+		valid, err := u.hasher.Verify(cpr.CurrentPassword, passwordHash)
+		if err != nil {
+			return fmt.Errorf("unable to verify password: %s", err)
+		}
+
+		if !valid {
+			return fmt.Errorf("current password does not match")
+		}
+
+		newPasswordHash, err := u.hasher.Hash(cpr.NewPassword)
+		if err != nil {
+			return fmt.Errorf("unable to hash password: %s", err)
+		}
+
+		affected, err := tx.Exec(ctx, u.builder.ChangePassword(), newPasswordHash, id)
+		if err != nil {
+			return fmt.Errorf("unable to execute query: %s", err)
+		}
+
+		if affected == 0 {
+			return fmt.Errorf("no such user to update password")
+		}
+
+		return nil
+	})
 	if err != nil {
-		return fmt.Errorf("changePassword: unable to execute query: %s", err)
+		return fmt.Errorf("changePassword: %s", err)
 	}
 
-	if res == 0 {
-		return fmt.Errorf("no such user to update password")
+	return nil
+}
+
+// getPassword reads the password hash of the user, locking the row until the transaction ends
+func (u *user) getPassword(ctx context.Context, tx repository.PostgresQueryer, id string) (string, error) {
+	res, err := tx.QueryScan(ctx, u.builder.GetPassword(), id)
+	if err != nil {
+		return "", fmt.Errorf("unable to fetch password: %s", err)
 	}
 
-	return nil
+	defer res.Close()
+	if !res.Next() {
+		return "", fmt.Errorf("no such user to update password")
+	}
+
+	var passwordHash *string
+	err = res.Scan(&passwordHash)
+	if err != nil {
+		return "", fmt.Errorf("unable to decode password: %s", err)
+	}
+
+	if passwordHash == nil {
+		return "", fmt.Errorf("user has no password set")
+	}
+
+	return *passwordHash, nil
 }
 
+// ResetPassword sets the password of the account a reset secret was issued for, each secret works once
 func (u *user) ResetPassword(ctx context.Context, cpr *models.ChangePasswordRequest) error {
-	phone, err := u.redis.GetString(ctx, cpr.Nonce)
+	userId, err := u.redis.GetDelString(ctx, resetSecretKey(cpr.Nonce))
+	if err != nil {
+		return fmt.Errorf("resetPassword: unable to get user using nonce: %s", err)
+	}
+
+	passwordHash, err := u.hasher.Hash(cpr.NewPassword)
 	if err != nil {
-		return fmt.Errorf("resetPassword: unable to get phone using nonce: %s", err)
+		return fmt.Errorf("resetPassword: unable to hash password: %s", err)
 	}
 
-	fmt.Println(phone)
 	query := u.builder.ResetPassword()
-	res, err := u.postgres.Exec(ctx, query, u.helper.Hash(cpr.NewPassword), phone)
+	res, err := u.postgres.Exec(ctx, query, passwordHash, userId)
 	if err != nil {
 		return fmt.Errorf("resetPassword: unable to execute query: %s", err)
 	}
@@ -239,13 +797,13 @@ func (u *user) ResetPassword(ctx context.Context, cpr *models.ChangePasswordRequ
 		return fmt.Errorf("no such user to reset password")
 	}
 
-	_, _ = u.redis.GetDelString(ctx, cpr.Nonce)
 	return nil
 }
 
-func (u *user) GetResetSecret(ctx context.Context, phone string) (string, error) {
+// GetResetSecret issues the secret that lets the user whose reset OTP was verified choose a new password
+func (u *user) GetResetSecret(ctx context.Context, userId string) (string, error) {
 	nonce := u.helper.NewId()
-	err := 	u.redis.Set(ctx, nonce, phone, 2*time.Minute)
+	err := u.redis.Set(ctx, resetSecretKey(nonce), userId, 2*time.Minute)
 	if err != nil {
 		return "", fmt.Errorf("GetResetSecret: unable to store secret: %s", err)
 	}
@@ -254,45 +812,309 @@ func (u *user) GetResetSecret(ctx context.Context, phone string) (string, error)
 }
 
 func (u *user) UpdateUser(ctx context.Context, user *models.User) (*models.User, error) {
-	query := u.builder.UpdateUser(user.GetMap())
-	res, err := u.postgres.Exec(ctx, query, *user.Id)
+	var usr *models.User
+	err := u.postgres.WithTx(ctx, func(tx repository.PostgresQueryer) error {
+		query, args := u.builder.UpdateUser(user.GetId(), user.GetMap())
+		res, err := tx.Exec(ctx, query, args...)
+		if err != nil {
+			return fmt.Errorf("unable to execute query: %s", err)
+		}
+
+		if res == 0 {
+			return fmt.Errorf("no such user to update")
+		}
+
+		_, usr, err = u.getUser(ctx, tx, user.GetId(), "", "")
+		return err
+	})
 	if err != nil {
-		return nil, fmt.Errorf("UpdateUser: unable to execute query: %s", err)
+		return nil, fmt.Errorf("UpdateUser: %s", err)
 	}
 
-	if res == 0 {
-		return nil, fmt.Errorf("UpdateUser: no such user to update")
+	return usr, nil
+}
+
+func (u *user) rehashPassword(ctx context.Context, id, password string) error {
+	passwordHash, err := u.hasher.Hash(password)
+	if err != nil {
+		return fmt.Errorf("rehashPassword: unable to hash password: %s", err)
 	}
 
-	_, usr, _ := u.GetUser(ctx, user.GetId(), "", "")
-	return usr, nil
+	_, err = u.postgres.Exec(ctx, u.builder.ChangePassword(), passwordHash, id)
+	if err != nil {
+		return fmt.Errorf("rehashPassword: unable to execute query: %s", err)
+	}
+
+	return nil
 }
 
-func (u *user) UpdateActiveTokens(ctx context.Context, userId, bearerToken, refreshToken string) error {
-	var userMeta models.UserMeta
-	userMetaBytes, err := u.redis.GetBytes(ctx, userId)
-	if u.redis.IsRedisNil(err) {
-		userMeta = models.UserMeta{
-			UserId:        userId,
-			LastLoginTime: time.Now().UnixMilli(),
-			ActiveTokens:  []models.ActiveToken{
-				{
-					BearerToken: bearerToken,
-					RefreshToken: refreshToken,
-				},
-			},
+// issueTokens starts a new session for the user and stores its bearer/refresh token pair as an active token
+func (u *user) issueTokens(ctx context.Context, userId string, claims map[string]interface{}, clientId string, device models.DeviceInfo) (*models.AuthUser, error) {
+	sessionId := u.helper.NewId()
+	claims["sub"] = userId
+	claims["sid"] = sessionId
+	clientType := ""
+	if clientId != "" {
+		cl, ok := u.clients.Get(clientId)
+		if !ok {
+			return nil, fmt.Errorf("issueTokens: unknown client %s", clientId)
 		}
-	} else if err != nil {
-		return fmt.Errorf("updateActiveTokens: unable to get redis key: %s", err)
-	} else {
-		u.helper.UnMarshal(userMetaBytes, &userMeta)
-		userMeta.AddToken(bearerToken, refreshToken)
+
+		clientType = cl.Type
+		claims["client_id"] = cl.Id
+		if cl.Scope != "" {
+			claims["scope"] = cl.Scope
+		}
+	}
+
+	sessionStart := time.Now()
+	lifetime := u.clients.Lifetime(clientId)
+	token, err := u.helper.GetJWT(claims, lifetime.AccessTokenExpiry(sessionStart))
+	if err != nil {
+		return nil, fmt.Errorf("issueTokens: unable to get JWT: %s", err)
+	}
+
+	refreshToken, err := u.helper.EncodeClaims(claims, sessionId, sessionStart, lifetime.RefreshTokenExpiry(sessionStart))
+	if err != nil {
+		return nil, fmt.Errorf("issueTokens: unable to get refresh token: %s", err)
+	}
+
+	now := sessionStart.UnixMilli()
+	err = u.UpdateActiveTokens(ctx, userId, models.ActiveToken{
+		SessionId:    sessionId,
+		BearerToken:  token,
+		RefreshToken: refreshToken,
+		ClientId:     clientId,
+		ClientType:   clientType,
+		CreatedAt:    now,
+		LastUsedAt:   now,
+		IP:           device.IP,
+		UserAgent:    device.UserAgent,
+		DeviceName:   device.GetName(),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("issueTokens: unable to store user meta: %w", err)
+	}
+
+	return &models.AuthUser{BearerToken: token, RefreshToken: refreshToken}, nil
+}
+
+// UpdateActiveTokens adds the token pair to the user's sessions
+func (u *user) UpdateActiveTokens(ctx context.Context, userId string, activeToken models.ActiveToken) error {
+	err := u.redis.Update(ctx, userId, 0, func(value []byte) ([]byte, error) {
+		userMeta := models.UserMeta{UserId: userId}
+		if value != nil {
+			err := u.helper.UnMarshal(value, &userMeta)
+			if err != nil {
+				return nil, fmt.Errorf("unable to read token metadata: %s", err)
+			}
+		}
+
+		if userMeta.Deactivated {
+			return nil, models.ErrAccountDeactivated
+		}
+
+		err := userMeta.AddToken(activeToken, u.policy)
+		if err != nil {
+			return nil, err
+		}
+
+		userMeta.LastLoginTime = time.Now().UnixMilli()
+		return userMeta.GetBytes(), nil
+	})
+	if err != nil {
+		return fmt.Errorf("updateActiveTokens: %w", err)
+	}
+
+	return nil
+}
+
+// SendVerificationEmail sends a new verification email to the address, at most once per cooldown period
+func (u *user) SendVerificationEmail(ctx context.Context, email string) error {
+	exists, us, err := u.GetUser(ctx, "", email, "")
+	if err != nil {
+		return fmt.Errorf("sendVerificationEmail: %s", err)
+	}
+
+	if !exists || us.GetEmail() != email {
+		return fmt.Errorf("sendVerificationEmail: %w", models.ErrUserNotFound)
+	}
+
+	if us.GetVerified() {
+		return fmt.Errorf("sendVerificationEmail: %w", models.ErrEmailAlreadyVerified)
+	}
+
+	cooldownKey := fmt.Sprintf("verify-email:cooldown:%s", us.GetId())
+	allowed, err := u.redis.SetNX(ctx, cooldownKey, 1, u.verification.ResendCooldown)
+	if err != nil {
+		return fmt.Errorf("sendVerificationEmail: %s", err)
+	}
+
+	if !allowed {
+		return fmt.Errorf("sendVerificationEmail: %w", models.ErrResendCooldown)
+	}
+
+	err = u.sendVerification(ctx, us.GetId(), us.GetEmail())
+	if err != nil {
+		return fmt.Errorf("sendVerificationEmail: %s", err)
+	}
+
+	return nil
+}
+
+func (u *user) sendVerification(ctx context.Context, userId, email string) error {
+	token, err := u.helper.Sign(constant.PurposeEmailVerification, &models.EmailVerificationClaims{
+		UserId: userId,
+		Email:  email,
+	}, time.Now().Add(u.verification.TTL))
+	if err != nil {
+		return fmt.Errorf("sendVerification: unable to create token: %s", err)
+	}
+
+	message := fmt.Sprintf("Your POUSHAK email verification code is %s", token)
+	if u.verification.URL != "" {
+		message = fmt.Sprintf("Verify your POUSHAK email address by opening %s?token=%s", u.verification.URL, token)
+	}
+
+	err = u.helper.SendEmail(ctx, constant.NotificationVerifyEmail, "Verify your email address", []string{email}, message)
+	if err != nil {
+		return fmt.Errorf("sendVerification: %s", err)
+	}
+
+	return nil
+}
+
+// VerifyEmail marks the email address the token was issued for as verified
+func (u *user) VerifyEmail(ctx context.Context, token string) (*models.User, error) {
+	var claims models.EmailVerificationClaims
+	err := u.helper.VerifySigned(constant.PurposeEmailVerification, token, &claims)
+	if err != nil {
+		return nil, fmt.Errorf("verifyEmail: %w: %s", models.ErrInvalidVerificationToken, err)
+	}
+
+	affected, err := u.postgres.Exec(ctx, u.builder.VerifyEmail(), claims.UserId, claims.Email)
+	if err != nil {
+		return nil, fmt.Errorf("verifyEmail: unable to execute query: %s", err)
+	}
+
+	if affected == 0 {
+		return nil, fmt.Errorf("verifyEmail: %w: email address has changed", models.ErrInvalidVerificationToken)
+	}
+
+	_, us, err := u.GetUser(ctx, claims.UserId, "", "")
+	if err != nil {
+		return nil, fmt.Errorf("verifyEmail: %s", err)
+	}
+
+	return us, nil
+}
+
+// Deactivate marks the account as deactivated and signs the user out everywhere
+func (u *user) Deactivate(ctx context.Context, userId, by string) error {
+	err := u.setDeactivated(ctx, userId, true, &by)
+	if err != nil {
+		return fmt.Errorf("deactivate: %w", err)
+	}
+
+	return nil
+}
+
+func (u *user) Reactivate(ctx context.Context, userId string) error {
+	err := u.setDeactivated(ctx, userId, false, nil)
+	if err != nil {
+		return fmt.Errorf("reactivate: %w", err)
+	}
+
+	return nil
+}
+
+// ReactivateWithCredentials lets users reactivate an account they deactivated themselves
+func (u *user) ReactivateWithCredentials(ctx context.Context, user *models.LoginUser) error {
+	us, err := u.authenticate(ctx, user)
+	if err != nil {
+		return fmt.Errorf("reactivateWithCredentials: %w", err)
+	}
+
+	if !us.GetDeleted() {
+		return nil
+	}
+
+	affected, err := u.postgres.Exec(ctx, u.builder.ReactivateSelf(), us.GetId(), constant.DeactivatedBySelf)
+	if err != nil {
+		return fmt.Errorf("reactivateWithCredentials: unable to execute query: %s", err)
+	}
+
+	if affected == 0 {
+		return fmt.Errorf("reactivateWithCredentials: %w", models.ErrReactivationDenied)
+	}
+
+	err = u.syncDeactivated(ctx, us.GetId(), false)
+	if err != nil {
+		return fmt.Errorf("reactivateWithCredentials: %s", err)
+	}
+
+	return nil
+}
+
+// setDeactivated records the deactivation and who made it, by is nil on reactivation
+func (u *user) setDeactivated(ctx context.Context, userId string, deactivated bool, by *string) error {
+	affected, err := u.postgres.Exec(ctx, u.builder.SetDeactivated(), userId, deactivated, by)
+	if err != nil {
+		return fmt.Errorf("setDeactivated: unable to execute query: %s", err)
 	}
 
-	err = u.redis.Set(ctx, userId, userMeta.GetBytes(), 0)
+	if affected == 0 {
+		return fmt.Errorf("setDeactivated: %w", models.ErrUserNotFound)
+	}
+
+	err = u.syncDeactivated(ctx, userId, deactivated)
+	if err != nil {
+		return fmt.Errorf("setDeactivated: %s", err)
+	}
+
+	return nil
+}
+
+// syncDeactivated mirrors the deactivation in the sessions of the user and publishes it
+func (u *user) syncDeactivated(ctx context.Context, userId string, deactivated bool) error {
+	err := u.redis.Update(ctx, userId, 0, func(value []byte) ([]byte, error) {
+		if value == nil && !deactivated {
+			return nil, nil
+		}
+
+		userMeta := models.UserMeta{UserId: userId}
+		if value != nil {
+			err := u.helper.UnMarshal(value, &userMeta)
+			if err != nil {
+				return nil, fmt.Errorf("unable to read token metadata: %s", err)
+			}
+		}
+
+		userMeta.Deactivated = deactivated
+		if deactivated {
+			userMeta.ClearAllTokens()
+		}
+
+		return userMeta.GetBytes(), nil
+	})
 	if err != nil {
-		return fmt.Errorf("updateActiveTokens: unable to save to redis: %s", err)
+		return fmt.Errorf("syncDeactivated: unable to update sessions: %s", err)
 	}
 
+	event := constant.EventAccountReactivated
+	if deactivated {
+		event = constant.EventAccountDeactivated
+	}
+
+	_ = u.helper.PublishSecurityEvent(ctx, &models.SecurityEvent{
+		Type:   event,
+		UserId: userId,
+		Time:   time.Now().UnixMilli(),
+	})
+
 	return nil
-}
\ No newline at end of file
+}
+
+func resetSecretKey(nonce string) string {
+	return fmt.Sprintf("password-reset:%s", nonce)
+}
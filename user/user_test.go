@@ -0,0 +1,272 @@
+package user
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"authservice/builder"
+	"authservice/hasher"
+	"authservice/helper"
+	"authservice/mfa"
+	"authservice/models"
+	"authservice/repository"
+)
+
+// deactivatedPostgres finds one deactivated user and reactivates it only when allowed
+type deactivatedPostgres struct {
+	repository.PostgresQueryer
+	allowed  bool
+	executed []string
+}
+
+func (p *deactivatedPostgres) QueryScan(ctx context.Context, query string, params ...interface{}) (repository.PgResult, error) {
+	id, password, deleted := "user", "hash", true
+	return &userResult{user: models.User{Id: &id, Password: &password, Deleted: &deleted}}, nil
+}
+
+func (p *deactivatedPostgres) Exec(ctx context.Context, query string, params ...interface{}) (int64, error) {
+	p.executed = append(p.executed, query)
+	if p.allowed {
+		return 1, nil
+	}
+
+	return 0, nil
+}
+
+type userResult struct {
+	repository.PgResult
+	user models.User
+	read bool
+}
+
+func (r *userResult) Next() bool {
+	next := !r.read
+	r.read = true
+	return next
+}
+
+func (r *userResult) Scan(dst interface{}) error {
+	*dst.(*models.User) = r.user
+	return nil
+}
+
+func (r *userResult) Close() {}
+
+type acceptingHasher struct {
+	hasher.Hasher
+}
+
+func (h acceptingHasher) Verify(password, encodedHash string) (bool, error) {
+	return true, nil
+}
+
+func (h acceptingHasher) NeedsRehash(encodedHash string) bool {
+	return false
+}
+
+type sessionsRedis struct {
+	repository.RedisQueryer
+	updated []string
+}
+
+func (r *sessionsRedis) Update(ctx context.Context, key string, timeOut time.Duration, update func(value []byte) ([]byte, error)) error {
+	r.updated = append(r.updated, key)
+	return nil
+}
+
+type silentHelper struct {
+	helper.Helper
+}
+
+func (h silentHelper) PublishSecurityEvent(ctx context.Context, event *models.SecurityEvent) error {
+	return nil
+}
+
+func newReactivationUser(allowed bool) (User, *deactivatedPostgres, *sessionsRedis) {
+	postgres := &deactivatedPostgres{allowed: allowed}
+	redis := &sessionsRedis{}
+	us := NewUser(builder.NewUserBuilder(), postgres, redis, silentHelper{}, acceptingHasher{}, nil, nil, nil, nil, nil,
+		nil, nil, nil)
+
+	return us, postgres, redis
+}
+
+func TestReactivateWithCredentialsRefusesAdminDeactivation(t *testing.T) {
+	us, postgres, redis := newReactivationUser(false)
+	err := us.ReactivateWithCredentials(context.Background(), &models.LoginUser{Email: "user@example.com",
+		Password: "Password@123"})
+	if !errors.Is(err, models.ErrReactivationDenied) {
+		t.Fatalf("got %v, want reactivation denied", err)
+	}
+
+	if len(postgres.executed) != 1 || postgres.executed[0] != builder.NewUserBuilder().ReactivateSelf() {
+		t.Fatalf("executed %v, want only the self reactivation", postgres.executed)
+	}
+
+	if len(redis.updated) != 0 {
+		t.Fatal("sessions reactivated although the account was not")
+	}
+}
+
+func TestReactivateWithCredentialsRestoresSelfDeactivation(t *testing.T) {
+	us, _, redis := newReactivationUser(true)
+	err := us.ReactivateWithCredentials(context.Background(), &models.LoginUser{Email: "user@example.com",
+		Password: "Password@123"})
+	if err != nil {
+		t.Fatalf("got %v, want the account reactivated", err)
+	}
+
+	if len(redis.updated) != 1 || redis.updated[0] != "user" {
+		t.Fatalf("updated sessions of %v, want the user's", redis.updated)
+	}
+}
+
+// unverifiedPostgres finds one active user that has not verified the email yet
+type unverifiedPostgres struct {
+	repository.PostgresQueryer
+}
+
+func (p unverifiedPostgres) QueryScan(ctx context.Context, query string, params ...interface{}) (repository.PgResult, error) {
+	id, verified := "user", false
+	return &userResult{user: models.User{Id: &id, Verified: &verified}}, nil
+}
+
+// answeredMFA accepts every challenge of user "user" and every code
+type answeredMFA struct {
+	mfa.MFA
+}
+
+func (m answeredMFA) OpenChallenge(ctx context.Context, token string) (*models.MFAChallengeClaims, error) {
+	return &models.MFAChallengeClaims{Id: "challenge", UserId: "user"}, nil
+}
+
+func (m answeredMFA) Verify(ctx context.Context, userId, code string) error {
+	return nil
+}
+
+func (m answeredMFA) CloseChallenge(ctx context.Context, claims *models.MFAChallengeClaims) error {
+	return nil
+}
+
+func TestCompleteMFALoginRequiresVerifiedEmail(t *testing.T) {
+	redis := &sessionsRedis{}
+	us := NewUser(builder.NewUserBuilder(), unverifiedPostgres{}, redis, silentHelper{}, nil, nil, nil,
+		&models.EmailVerification{Required: true}, answeredMFA{}, nil, nil, nil, nil)
+	_, err := us.CompleteMFALogin(context.Background(), &models.MFALogin{ChallengeToken: "challenge", Code: "123456"})
+	if !errors.Is(err, models.ErrEmailNotVerified) {
+		t.Fatalf("got %v, want email not verified", err)
+	}
+
+	if len(redis.updated) != 0 {
+		t.Fatal("session created for an unverified user")
+	}
+}
+
+// duplicatePostgres fails every insert on a unique constraint
+type duplicatePostgres struct {
+	repository.PostgresQueryer
+}
+
+func (p duplicatePostgres) Exec(ctx context.Context, query string, params ...interface{}) (int64, error) {
+	return 0, fmt.Errorf("exec: ERROR: duplicate key value violates unique constraint \"users_email_key\" (SQLSTATE 23505)")
+}
+
+// mailingHelper records the emails that were sent
+type mailingHelper struct {
+	helper.Helper
+	sent []string
+}
+
+func (h *mailingHelper) NewId() string {
+	return "user"
+}
+
+func (h *mailingHelper) Sign(purpose string, data interface{}, expiry time.Time) (string, error) {
+	return "token", nil
+}
+
+func (h *mailingHelper) SendEmail(ctx context.Context, notificationType, subject string, to []string, message string) error {
+	h.sent = append(h.sent, to...)
+	return nil
+}
+
+func (h acceptingHasher) Hash(password string) (string, error) {
+	return "hash", nil
+}
+
+func TestRegisterReportsExistingUserWithoutEmail(t *testing.T) {
+	h := &mailingHelper{}
+	us := NewUser(builder.NewUserBuilder(), duplicatePostgres{}, nil, h, acceptingHasher{}, nil, nil,
+		&models.EmailVerification{}, nil, nil, nil, nil, nil)
+	email, password := "user@example.com", "Password@123"
+	_, err := us.Register(context.Background(), &models.User{Email: &email, Password: &password})
+	if !errors.Is(err, models.ErrUserExists) {
+		t.Fatalf("got %v, want user exists", err)
+	}
+
+	if len(h.sent) != 0 {
+		t.Fatalf("verification sent to %v for a user that was not created", h.sent)
+	}
+}
+
+// loginPostgres finds the given user, or none when it is nil
+type loginPostgres struct {
+	repository.PostgresQueryer
+	user *models.User
+}
+
+func (p loginPostgres) QueryScan(ctx context.Context, query string, params ...interface{}) (repository.PgResult, error) {
+	if p.user == nil {
+		return &userResult{read: true}, nil
+	}
+
+	return &userResult{user: *p.user}, nil
+}
+
+// recordingHasher accepts only "Password@123" and records the hashes it verified against
+type recordingHasher struct {
+	hasher.Hasher
+	verified []string
+}
+
+func (h *recordingHasher) Hash(password string) (string, error) {
+	return "dummy", nil
+}
+
+func (h *recordingHasher) Verify(password, encodedHash string) (bool, error) {
+	h.verified = append(h.verified, encodedHash)
+	return password == "Password@123", nil
+}
+
+func TestLoginFailsAlikeForUnknownUsersAndWrongPasswords(t *testing.T) {
+	id, password := "user", "hash"
+	tests := []struct {
+		name     string
+		user     *models.User
+		password string
+		verified string
+	}{
+		{"unknown user", nil, "Password@123", "dummy"},
+		{"user without password", &models.User{Id: &id}, "Password@123", "dummy"},
+		{"wrong password", &models.User{Id: &id, Password: &password}, "wrong", "hash"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			h := &recordingHasher{}
+			us := NewUser(builder.NewUserBuilder(), loginPostgres{user: test.user}, nil, silentHelper{}, h, nil, nil,
+				nil, nil, nil, nil, nil, nil)
+			_, err := us.Login(context.Background(), &models.LoginUser{Email: "user@example.com", Password: test.password})
+			if !errors.Is(err, models.ErrInvalidCredentials) {
+				t.Fatalf("got %v, want invalid credentials", err)
+			}
+
+			if len(h.verified) != 1 || h.verified[0] != test.verified {
+				t.Fatalf("verified against %v, want %s", h.verified, test.verified)
+			}
+		})
+	}
+}
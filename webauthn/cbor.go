@@ -0,0 +1,205 @@
+package webauthn
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math"
+)
+
+// maxDepth bounds nesting so that a crafted attestation cannot exhaust the stack
+const maxDepth = 16
+
+// decoder reads the subset of CBOR (RFC 8949) used by authenticators: definite length items only,
+// maps come back as map[interface{}]interface{} keyed by int64 or string
+type decoder struct {
+	data []byte
+	pos  int
+}
+
+// decodeCBOR decodes the single item at the start of data and returns it with the number of bytes it used
+func decodeCBOR(data []byte) (interface{}, int, error) {
+	d := &decoder{data: data}
+	v, err := d.value(0)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	return v, d.pos, nil
+}
+
+func (d *decoder) value(depth int) (interface{}, error) {
+	if depth > maxDepth {
+		return nil, fmt.Errorf("cbor: nesting too deep")
+	}
+
+	if d.pos >= len(d.data) {
+		return nil, fmt.Errorf("cbor: unexpected end of data")
+	}
+
+	initial := d.data[d.pos]
+	d.pos++
+	major, info := initial>>5, initial&0x1f
+	if major == 7 {
+		return d.simple(info)
+	}
+
+	n, err := d.argument(info)
+	if err != nil {
+		return nil, err
+	}
+
+	switch major {
+	case 0:
+		if n > math.MaxInt64 {
+			return nil, fmt.Errorf("cbor: integer overflow")
+		}
+
+		return int64(n), nil
+	case 1:
+		if n > math.MaxInt64 {
+			return nil, fmt.Errorf("cbor: integer overflow")
+		}
+
+		return -1 - int64(n), nil
+	case 2:
+		return d.bytes(n)
+	case 3:
+		b, err := d.bytes(n)
+		if err != nil {
+			return nil, err
+		}
+
+		return string(b), nil
+	case 4:
+		if n > uint64(len(d.data)-d.pos) {
+			return nil, fmt.Errorf("cbor: array too long")
+		}
+
+		arr := make([]interface{}, 0, n)
+		for i := uint64(0); i < n; i++ {
+			v, err := d.value(depth + 1)
+			if err != nil {
+				return nil, err
+			}
+
+			arr = append(arr, v)
+		}
+
+		return arr, nil
+	case 5:
+		if n > uint64(len(d.data)-d.pos) {
+			return nil, fmt.Errorf("cbor: map too long")
+		}
+
+		m := make(map[interface{}]interface{}, n)
+		for i := uint64(0); i < n; i++ {
+			k, err := d.value(depth + 1)
+			if err != nil {
+				return nil, err
+			}
+
+			switch k.(type) {
+			case int64, string:
+			default:
+				return nil, fmt.Errorf("cbor: unsupported map key type %T", k)
+			}
+
+			v, err := d.value(depth + 1)
+			if err != nil {
+				return nil, err
+			}
+
+			m[k] = v
+		}
+
+		return m, nil
+	default:
+		// tags carry no meaning for WebAuthn, the tagged item is returned as is
+		return d.value(depth + 1)
+	}
+}
+
+func (d *decoder) argument(info byte) (uint64, error) {
+	size := 0
+	switch {
+	case info < 24:
+		return uint64(info), nil
+	case info == 24:
+		size = 1
+	case info == 25:
+		size = 2
+	case info == 26:
+		size = 4
+	case info == 27:
+		size = 8
+	default:
+		return 0, fmt.Errorf("cbor: unsupported additional information %d", info)
+	}
+
+	if len(d.data)-d.pos < size {
+		return 0, fmt.Errorf("cbor: unexpected end of data")
+	}
+
+	buf := make([]byte, 8)
+	copy(buf[8-size:], d.data[d.pos:d.pos+size])
+	d.pos += size
+
+	return binary.BigEndian.Uint64(buf), nil
+}
+
+func (d *decoder) bytes(n uint64) ([]byte, error) {
+	if n > uint64(len(d.data)-d.pos) {
+		return nil, fmt.Errorf("cbor: unexpected end of data")
+	}
+
+	b := d.data[d.pos : d.pos+int(n)]
+	d.pos += int(n)
+
+	return b, nil
+}
+
+func (d *decoder) simple(info byte) (interface{}, error) {
+	switch info {
+	case 20:
+		return false, nil
+	case 21:
+		return true, nil
+	case 22, 23:
+		return nil, nil
+	case 25, 26, 27:
+		n, err := d.argument(info)
+		if err != nil {
+			return nil, err
+		}
+
+		switch info {
+		case 25:
+			return float64(float16(uint16(n))), nil
+		case 26:
+			return float64(math.Float32frombits(uint32(n))), nil
+		default:
+			return math.Float64frombits(n), nil
+		}
+	default:
+		return nil, fmt.Errorf("cbor: unsupported simple value %d", info)
+	}
+}
+
+func float16(h uint16) float32 {
+	sign := uint32(h>>15) << 31
+	exp := uint32(h>>10) & 0x1f
+	frac := uint32(h) & 0x3ff
+	switch exp {
+	case 0:
+		f := float32(frac) / 1024 / 16384
+		if sign != 0 {
+			return -f
+		}
+
+		return f
+	case 0x1f:
+		return math.Float32frombits(sign | 0x7f800000 | frac<<13)
+	default:
+		return math.Float32frombits(sign | (exp+112)<<23 | frac<<13)
+	}
+}
@@ -0,0 +1,117 @@
+package webauthn
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/sha256"
+	"fmt"
+	"math/big"
+)
+
+// COSE algorithm identifiers (RFC 8152) of the supported credential keys
+const (
+	AlgES256 = -7
+	AlgEdDSA = -8
+	AlgRS256 = -257
+)
+
+// SupportedAlgorithms lists the algorithms offered to authenticators, in order of preference
+var SupportedAlgorithms = []int{AlgES256, AlgEdDSA, AlgRS256}
+
+const (
+	coseKty    = 1
+	coseAlg    = 3
+	coseCrv    = -1
+	coseX      = -2
+	coseY      = -3
+	coseRSAN   = -1
+	coseRSAE   = -2
+	ktyOKP     = 1
+	ktyEC2     = 2
+	ktyRSA     = 3
+	crvP256    = 1
+	crvEd25519 = 6
+)
+
+// parsePublicKey reads a COSE encoded credential public key
+func parsePublicKey(data []byte) (int, crypto.PublicKey, error) {
+	v, n, err := decodeCBOR(data)
+	if err != nil {
+		return 0, nil, fmt.Errorf("parsePublicKey: %s", err)
+	}
+
+	if n != len(data) {
+		return 0, nil, fmt.Errorf("parsePublicKey: trailing data after key")
+	}
+
+	key, ok := v.(map[interface{}]interface{})
+	if !ok {
+		return 0, nil, fmt.Errorf("parsePublicKey: key is not a map")
+	}
+
+	kty, _ := key[int64(coseKty)].(int64)
+	alg, _ := key[int64(coseAlg)].(int64)
+	switch {
+	case kty == ktyEC2 && alg == AlgES256:
+		crv, _ := key[int64(coseCrv)].(int64)
+		x, _ := key[int64(coseX)].([]byte)
+		y, _ := key[int64(coseY)].([]byte)
+		if crv != crvP256 || len(x) != 32 || len(y) != 32 {
+			return 0, nil, fmt.Errorf("parsePublicKey: invalid EC2 key")
+		}
+
+		pub := &ecdsa.PublicKey{Curve: elliptic.P256(), X: new(big.Int).SetBytes(x), Y: new(big.Int).SetBytes(y)}
+		if !pub.Curve.IsOnCurve(pub.X, pub.Y) {
+			return 0, nil, fmt.Errorf("parsePublicKey: EC2 point is not on the curve")
+		}
+
+		return AlgES256, pub, nil
+	case kty == ktyOKP && alg == AlgEdDSA:
+		crv, _ := key[int64(coseCrv)].(int64)
+		x, _ := key[int64(coseX)].([]byte)
+		if crv != crvEd25519 || len(x) != ed25519.PublicKeySize {
+			return 0, nil, fmt.Errorf("parsePublicKey: invalid OKP key")
+		}
+
+		return AlgEdDSA, ed25519.PublicKey(x), nil
+	case kty == ktyRSA && alg == AlgRS256:
+		n, _ := key[int64(coseRSAN)].([]byte)
+		e, _ := key[int64(coseRSAE)].([]byte)
+		if len(n) < 256 || len(e) == 0 || len(e) > 4 {
+			return 0, nil, fmt.Errorf("parsePublicKey: invalid RSA key")
+		}
+
+		return AlgRS256, &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())}, nil
+	default:
+		return 0, nil, fmt.Errorf("parsePublicKey: unsupported key type %d with algorithm %d", kty, alg)
+	}
+}
+
+// verifySignature checks sig over data with the COSE encoded public key
+func verifySignature(publicKey, data, sig []byte) error {
+	alg, pub, err := parsePublicKey(publicKey)
+	if err != nil {
+		return fmt.Errorf("verifySignature: %s", err)
+	}
+
+	valid := false
+	switch alg {
+	case AlgES256:
+		digest := sha256.Sum256(data)
+		valid = ecdsa.VerifyASN1(pub.(*ecdsa.PublicKey), digest[:], sig)
+	case AlgEdDSA:
+		valid = ed25519.Verify(pub.(ed25519.PublicKey), data, sig)
+	case AlgRS256:
+		digest := sha256.Sum256(data)
+		valid = rsa.VerifyPKCS1v15(pub.(*rsa.PublicKey), crypto.SHA256, digest[:], sig) == nil
+	}
+
+	if !valid {
+		return fmt.Errorf("verifySignature: invalid signature")
+	}
+
+	return nil
+}
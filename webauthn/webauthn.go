@@ -0,0 +1,248 @@
+package webauthn
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+)
+
+const (
+	challengeSize = 32
+
+	typeCreate = "webauthn.create"
+	typeGet    = "webauthn.get"
+
+	flagUserPresent      = 0x01
+	flagUserVerified     = 0x04
+	flagAttestedCredData = 0x40
+	flagExtensionData    = 0x80
+)
+
+// Encoding is the base64url encoding WebAuthn uses for binary values in JSON
+var Encoding = base64.RawURLEncoding
+
+// RelyingParty verifies the registration and authentication ceremonies of one WebAuthn relying party
+type RelyingParty struct {
+	ID      string
+	Name    string
+	Origins []string
+}
+
+// Credential is a newly registered credential
+type Credential struct {
+	Id           []byte
+	PublicKey    []byte
+	SignCount    uint32
+	UserVerified bool
+}
+
+// Assertion is the outcome of a verified authentication ceremony
+type Assertion struct {
+	SignCount    uint32
+	UserVerified bool
+}
+
+type clientData struct {
+	Type        string `json:"type"`
+	Challenge   string `json:"challenge"`
+	Origin      string `json:"origin"`
+	CrossOrigin bool   `json:"crossOrigin"`
+}
+
+type authenticatorData struct {
+	rpIdHash     []byte
+	flags        byte
+	signCount    uint32
+	credentialId []byte
+	publicKey    []byte
+}
+
+// NewChallenge returns a random challenge for a ceremony
+func NewChallenge() ([]byte, error) {
+	challenge := make([]byte, challengeSize)
+	if _, err := io.ReadFull(rand.Reader, challenge); err != nil {
+		return nil, fmt.Errorf("newChallenge: unable to read random bytes: %s", err)
+	}
+
+	return challenge, nil
+}
+
+// VerifyRegistration checks the response of navigator.credentials.create() and returns the new credential.
+// Attestation is not requested, so the attestation statement is not verified and only the credential is kept.
+func (rp *RelyingParty) VerifyRegistration(challenge, clientDataJSON, attestationObject []byte, requireUV bool) (*Credential, error) {
+	err := rp.verifyClientData(typeCreate, challenge, clientDataJSON)
+	if err != nil {
+		return nil, fmt.Errorf("verifyRegistration: %s", err)
+	}
+
+	v, n, err := decodeCBOR(attestationObject)
+	if err != nil || n != len(attestationObject) {
+		return nil, fmt.Errorf("verifyRegistration: invalid attestation object: %v", err)
+	}
+
+	attestation, ok := v.(map[interface{}]interface{})
+	if !ok {
+		return nil, fmt.Errorf("verifyRegistration: attestation object is not a map")
+	}
+
+	rawAuthData, ok := attestation["authData"].([]byte)
+	if !ok {
+		return nil, fmt.Errorf("verifyRegistration: attestation object has no authenticator data")
+	}
+
+	authData, err := rp.verifyAuthenticatorData(rawAuthData, requireUV)
+	if err != nil {
+		return nil, fmt.Errorf("verifyRegistration: %s", err)
+	}
+
+	if authData.flags&flagAttestedCredData == 0 {
+		return nil, fmt.Errorf("verifyRegistration: authenticator data has no credential")
+	}
+
+	_, _, err = parsePublicKey(authData.publicKey)
+	if err != nil {
+		return nil, fmt.Errorf("verifyRegistration: %s", err)
+	}
+
+	return &Credential{
+		Id:           authData.credentialId,
+		PublicKey:    authData.publicKey,
+		SignCount:    authData.signCount,
+		UserVerified: authData.flags&flagUserVerified != 0,
+	}, nil
+}
+
+// VerifyAssertion checks the response of navigator.credentials.get() against the stored public key of the credential
+func (rp *RelyingParty) VerifyAssertion(challenge, clientDataJSON, rawAuthData, signature, publicKey []byte,
+	requireUV bool) (*Assertion, error) {
+	err := rp.verifyClientData(typeGet, challenge, clientDataJSON)
+	if err != nil {
+		return nil, fmt.Errorf("verifyAssertion: %s", err)
+	}
+
+	authData, err := rp.verifyAuthenticatorData(rawAuthData, requireUV)
+	if err != nil {
+		return nil, fmt.Errorf("verifyAssertion: %s", err)
+	}
+
+	clientDataHash := sha256.Sum256(clientDataJSON)
+	signed := append(append([]byte{}, rawAuthData...), clientDataHash[:]...)
+	err = verifySignature(publicKey, signed, signature)
+	if err != nil {
+		return nil, fmt.Errorf("verifyAssertion: %s", err)
+	}
+
+	return &Assertion{
+		SignCount:    authData.signCount,
+		UserVerified: authData.flags&flagUserVerified != 0,
+	}, nil
+}
+
+func (rp *RelyingParty) verifyClientData(ceremony string, challenge, clientDataJSON []byte) error {
+	var cd clientData
+	err := json.Unmarshal(clientDataJSON, &cd)
+	if err != nil {
+		return fmt.Errorf("invalid client data: %s", err)
+	}
+
+	if cd.Type != ceremony {
+		return fmt.Errorf("unexpected ceremony %s", cd.Type)
+	}
+
+	received, err := Encoding.DecodeString(cd.Challenge)
+	if err != nil || subtle.ConstantTimeCompare(received, challenge) != 1 {
+		return fmt.Errorf("challenge mismatch")
+	}
+
+	if cd.CrossOrigin {
+		return fmt.Errorf("cross origin ceremonies are not allowed")
+	}
+
+	for _, origin := range rp.Origins {
+		if cd.Origin == origin {
+			return nil
+		}
+	}
+
+	return fmt.Errorf("unexpected origin %s", cd.Origin)
+}
+
+func (rp *RelyingParty) verifyAuthenticatorData(data []byte, requireUV bool) (*authenticatorData, error) {
+	authData, err := parseAuthenticatorData(data)
+	if err != nil {
+		return nil, err
+	}
+
+	rpIdHash := sha256.Sum256([]byte(rp.ID))
+	if !bytes.Equal(authData.rpIdHash, rpIdHash[:]) {
+		return nil, fmt.Errorf("relying party id mismatch")
+	}
+
+	if authData.flags&flagUserPresent == 0 {
+		return nil, fmt.Errorf("user was not present")
+	}
+
+	if requireUV && authData.flags&flagUserVerified == 0 {
+		return nil, fmt.Errorf("user was not verified")
+	}
+
+	return authData, nil
+}
+
+// parseAuthenticatorData splits the authenticator data laid out as rpIdHash(32) flags(1) signCount(4)
+// followed by the attested credential data aaguid(16) idLength(2) id publicKey and the extensions when flagged
+func parseAuthenticatorData(data []byte) (*authenticatorData, error) {
+	if len(data) < 37 {
+		return nil, fmt.Errorf("authenticator data too short")
+	}
+
+	authData := &authenticatorData{
+		rpIdHash:  data[:32],
+		flags:     data[32],
+		signCount: binary.BigEndian.Uint32(data[33:37]),
+	}
+
+	rest := data[37:]
+	if authData.flags&flagAttestedCredData != 0 {
+		if len(rest) < 18 {
+			return nil, fmt.Errorf("attested credential data too short")
+		}
+
+		idLength := int(binary.BigEndian.Uint16(rest[16:18]))
+		rest = rest[18:]
+		if idLength == 0 || idLength > 1023 || len(rest) < idLength {
+			return nil, fmt.Errorf("invalid credential id length")
+		}
+
+		authData.credentialId = rest[:idLength]
+		rest = rest[idLength:]
+		_, n, err := decodeCBOR(rest)
+		if err != nil {
+			return nil, fmt.Errorf("invalid credential public key: %s", err)
+		}
+
+		authData.publicKey = rest[:n]
+		rest = rest[n:]
+	}
+
+	if authData.flags&flagExtensionData != 0 {
+		_, n, err := decodeCBOR(rest)
+		if err != nil {
+			return nil, fmt.Errorf("invalid extension data: %s", err)
+		}
+
+		rest = rest[n:]
+	}
+
+	if len(rest) != 0 {
+		return nil, fmt.Errorf("trailing authenticator data")
+	}
+
+	return authData, nil
+}
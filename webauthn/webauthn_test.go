@@ -0,0 +1,254 @@
+package webauthn
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/json"
+	"testing"
+)
+
+var testRP = &RelyingParty{ID: "example.com", Name: "Example", Origins: []string{"https://example.com"}}
+
+// softAuthenticator answers ceremonies like a platform authenticator would, with an ES256 or Ed25519 key
+type softAuthenticator struct {
+	id        []byte
+	signer    crypto.Signer
+	signCount uint32
+	flags     byte
+}
+
+func newSoftAuthenticator(t *testing.T, alg int) *softAuthenticator {
+	t.Helper()
+	var signer crypto.Signer
+	var err error
+	switch alg {
+	case AlgES256:
+		signer, err = ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	case AlgEdDSA:
+		_, signer, err = ed25519.GenerateKey(rand.Reader)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return &softAuthenticator{id: []byte("credential-id"), signer: signer, flags: flagUserPresent | flagUserVerified}
+}
+
+func (a *softAuthenticator) publicKey() []byte {
+	switch pub := a.signer.Public().(type) {
+	case *ecdsa.PublicKey:
+		x, y := make([]byte, 32), make([]byte, 32)
+		pub.X.FillBytes(x)
+		pub.Y.FillBytes(y)
+		return cborMap(coseKty, ktyEC2, coseAlg, AlgES256, coseCrv, crvP256, coseX, x, coseY, y)
+	case ed25519.PublicKey:
+		return cborMap(coseKty, ktyOKP, coseAlg, AlgEdDSA, coseCrv, crvEd25519, coseX, []byte(pub))
+	}
+
+	return nil
+}
+
+func (a *softAuthenticator) authData(rpId string, flags byte, credential bool) []byte {
+	rpIdHash := sha256.Sum256([]byte(rpId))
+	data := append(rpIdHash[:], flags, 0, 0, 0, 0)
+	binary.BigEndian.PutUint32(data[33:], a.signCount)
+	if credential {
+		data = append(data, make([]byte, 16)...)
+		data = binary.BigEndian.AppendUint16(data, uint16(len(a.id)))
+		data = append(append(data, a.id...), a.publicKey()...)
+	}
+
+	return data
+}
+
+func (a *softAuthenticator) register(challenge []byte) ([]byte, []byte) {
+	authData := a.authData(testRP.ID, a.flags|flagAttestedCredData, true)
+	return newClientData(typeCreate, challenge, testRP.Origins[0]), cborMap("fmt", "none", "attStmt",
+		cborMap(), "authData", authData)
+}
+
+func (a *softAuthenticator) assert(t *testing.T, challenge []byte) ([]byte, []byte, []byte) {
+	t.Helper()
+	a.signCount++
+	clientDataJSON := newClientData(typeGet, challenge, testRP.Origins[0])
+	authData := a.authData(testRP.ID, a.flags, false)
+	return clientDataJSON, authData, a.sign(t, authData, clientDataJSON)
+}
+
+func (a *softAuthenticator) sign(t *testing.T, authData, clientDataJSON []byte) []byte {
+	t.Helper()
+	clientDataHash := sha256.Sum256(clientDataJSON)
+	signed := append(append([]byte{}, authData...), clientDataHash[:]...)
+	var sig []byte
+	var err error
+	if _, ok := a.signer.(ed25519.PrivateKey); ok {
+		sig, err = a.signer.Sign(rand.Reader, signed, crypto.Hash(0))
+	} else {
+		digest := sha256.Sum256(signed)
+		sig, err = a.signer.Sign(rand.Reader, digest[:], crypto.SHA256)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return sig
+}
+
+func newClientData(ceremony string, challenge []byte, origin string) []byte {
+	data, _ := json.Marshal(&clientData{Type: ceremony, Challenge: Encoding.EncodeToString(challenge), Origin: origin})
+	return data
+}
+
+// cborRaw is an item that is already CBOR encoded
+type cborRaw []byte
+
+// cborMap encodes alternating keys and values as a CBOR map, []byte values become byte strings
+func cborMap(pairs ...interface{}) cborRaw {
+	out := cborHead(5, uint64(len(pairs)/2))
+	for _, item := range pairs {
+		out = append(out, cborItem(item)...)
+	}
+
+	return out
+}
+
+func cborItem(item interface{}) []byte {
+	switch v := item.(type) {
+	case int:
+		if v < 0 {
+			return cborHead(1, uint64(-1-v))
+		}
+
+		return cborHead(0, uint64(v))
+	case string:
+		return append(cborHead(3, uint64(len(v))), v...)
+	case cborRaw:
+		return v
+	case []byte:
+		return append(cborHead(2, uint64(len(v))), v...)
+	}
+
+	panic("cbor: unsupported item")
+}
+
+func cborHead(major byte, n uint64) []byte {
+	switch {
+	case n < 24:
+		return []byte{major<<5 | byte(n)}
+	case n < 1<<8:
+		return []byte{major<<5 | 24, byte(n)}
+	case n < 1<<16:
+		return binary.BigEndian.AppendUint16([]byte{major<<5 | 25}, uint16(n))
+	default:
+		return binary.BigEndian.AppendUint32([]byte{major<<5 | 26}, uint32(n))
+	}
+}
+
+func newTestChallenge(t *testing.T) []byte {
+	t.Helper()
+	challenge, err := NewChallenge()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return challenge
+}
+
+func TestRegistrationAndAssertion(t *testing.T) {
+	for name, alg := range map[string]int{"ES256": AlgES256, "EdDSA": AlgEdDSA} {
+		t.Run(name, func(t *testing.T) {
+			authenticator := newSoftAuthenticator(t, alg)
+			challenge := newTestChallenge(t)
+			clientDataJSON, attestation := authenticator.register(challenge)
+			credential, err := testRP.VerifyRegistration(challenge, clientDataJSON, attestation, true)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if string(credential.Id) != string(authenticator.id) || !credential.UserVerified {
+				t.Fatalf("registered %+v", credential)
+			}
+
+			challenge = newTestChallenge(t)
+			clientDataJSON, authData, sig := authenticator.assert(t, challenge)
+			assertion, err := testRP.VerifyAssertion(challenge, clientDataJSON, authData, sig, credential.PublicKey, true)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if assertion.SignCount != 1 || !assertion.UserVerified {
+				t.Fatalf("asserted %+v", assertion)
+			}
+		})
+	}
+}
+
+func TestVerifyRegistrationRejects(t *testing.T) {
+	authenticator := newSoftAuthenticator(t, AlgES256)
+	challenge := newTestChallenge(t)
+	clientDataJSON, attestation := authenticator.register(challenge)
+	otherRP := authenticator.authData("evil.example", flagUserPresent|flagAttestedCredData, true)
+	withoutUV := authenticator.authData(testRP.ID, flagUserPresent|flagAttestedCredData, true)
+	withoutUP := authenticator.authData(testRP.ID, flagUserVerified|flagAttestedCredData, true)
+	withoutCredential := authenticator.authData(testRP.ID, flagUserPresent|flagUserVerified, false)
+	crossOrigin, _ := json.Marshal(&clientData{Type: typeCreate, Challenge: Encoding.EncodeToString(challenge),
+		Origin: testRP.Origins[0], CrossOrigin: true})
+
+	tests := map[string]struct {
+		challenge, clientDataJSON, attestation []byte
+	}{
+		"another challenge": {newTestChallenge(t), clientDataJSON, attestation},
+		"another origin":    {challenge, newClientData(typeCreate, challenge, "https://evil.example"), attestation},
+		"another ceremony":  {challenge, newClientData(typeGet, challenge, testRP.Origins[0]), attestation},
+		"cross origin":      {challenge, crossOrigin, attestation},
+		"another rp id":     {challenge, clientDataJSON, cborMap("fmt", "none", "attStmt", cborMap(), "authData", otherRP)},
+		"user not verified": {challenge, clientDataJSON, cborMap("fmt", "none", "attStmt", cborMap(), "authData", withoutUV)},
+		"user not present":  {challenge, clientDataJSON, cborMap("fmt", "none", "attStmt", cborMap(), "authData", withoutUP)},
+		"no credential": {challenge, clientDataJSON, cborMap("fmt", "none", "attStmt", cborMap(), "authData",
+			withoutCredential)},
+		"trailing data": {challenge, clientDataJSON, append(append([]byte{}, attestation...), 0)},
+	}
+
+	for name, test := range tests {
+		_, err := testRP.VerifyRegistration(test.challenge, test.clientDataJSON, test.attestation, true)
+		if err == nil {
+			t.Errorf("%s: registration accepted", name)
+		}
+	}
+}
+
+func TestVerifyAssertionRejects(t *testing.T) {
+	authenticator := newSoftAuthenticator(t, AlgES256)
+	publicKey := authenticator.publicKey()
+	other := newSoftAuthenticator(t, AlgES256)
+	challenge := newTestChallenge(t)
+	clientDataJSON, authData, sig := authenticator.assert(t, challenge)
+	tamperedClientData := newClientData(typeGet, challenge, "https://example.com/")
+	authenticator.flags = flagUserPresent
+	_, withoutUV, withoutUVSig := authenticator.assert(t, challenge)
+
+	tests := map[string]struct {
+		challenge, clientDataJSON, authData, sig, publicKey []byte
+	}{
+		"another challenge":    {newTestChallenge(t), clientDataJSON, authData, sig, publicKey},
+		"another key":          {challenge, clientDataJSON, authData, sig, other.publicKey()},
+		"tampered client data": {challenge, tamperedClientData, authData, sig, publicKey},
+		"tampered signature":   {challenge, clientDataJSON, authData, append([]byte{}, sig[:len(sig)-1]...), publicKey},
+		"another ceremony": {challenge, newClientData(typeCreate, challenge, testRP.Origins[0]), authData, sig,
+			publicKey},
+		"user not verified": {challenge, clientDataJSON, withoutUV, withoutUVSig, publicKey},
+	}
+
+	for name, test := range tests {
+		_, err := testRP.VerifyAssertion(test.challenge, test.clientDataJSON, test.authData, test.sig, test.publicKey,
+			true)
+		if err == nil {
+			t.Errorf("%s: assertion accepted", name)
+		}
+	}
+}